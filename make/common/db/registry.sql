@@ -177,13 +177,69 @@ create table image_vulnerability (
  UNIQUE (repo_name, tag)
 );
 
+create table repository_tag (
+ id int NOT NULL AUTO_INCREMENT,
+ repo_name varchar (255) NOT NULL,
+ tag varchar (128) NOT NULL,
+ digest varchar (128) NOT NULL,
+ creation_time timestamp DEFAULT CURRENT_TIMESTAMP,
+ update_time timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ FOREIGN KEY (repo_name) REFERENCES repository(name) ON DELETE CASCADE,
+ INDEX digest (digest),
+ UNIQUE (repo_name, tag)
+);
+
+create table repository_daily_stat (
+ id int NOT NULL AUTO_INCREMENT,
+ project_id int NOT NULL,
+ repo_name varchar (255) NOT NULL,
+ tag varchar (128) NOT NULL,
+ day date NOT NULL,
+ pull_count int DEFAULT 0 NOT NULL,
+ push_count int DEFAULT 0 NOT NULL,
+ PRIMARY KEY (id),
+ FOREIGN KEY (project_id) REFERENCES project (project_id) ON DELETE CASCADE,
+ INDEX day_project (day, project_id),
+ UNIQUE (repo_name, tag, day)
+);
+
+create table upload_session (
+ id int NOT NULL AUTO_INCREMENT,
+ uuid varchar(64) NOT NULL,
+ user_id int NOT NULL,
+ project_name varchar(41) NOT NULL,
+ repo varchar(256),
+ tag varchar(128),
+ size bigint NOT NULL DEFAULT 0,
+ offset bigint NOT NULL DEFAULT 0,
+ status varchar(32) NOT NULL,
+ job_id int,
+ creation_time timestamp default CURRENT_TIMESTAMP,
+ update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ FOREIGN KEY (user_id) REFERENCES user(user_id),
+ UNIQUE (uuid)
+);
+
 create table job (
  job_id int NOT NULL AUTO_INCREMENT,
  type varchar (255) NOT NULL,
- message varchar (255) NOT NULL,
+ status varchar (64) NOT NULL DEFAULT 'pending',
+ progress int NOT NULL DEFAULT 0,
+ message varchar (1024) NOT NULL,
+ user_id int NOT NULL DEFAULT 0,
+ project_id int NOT NULL DEFAULT 0,
+ result text,
+ error_detail text,
+ start_time timestamp NULL,
+ end_time timestamp NULL,
  creation_time timestamp DEFAULT CURRENT_TIMESTAMP,
+ update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
  PRIMARY KEY (job_id),
- UNIQUE (job_id)
+ UNIQUE (job_id),
+ INDEX status_end_time (status, end_time),
+ INDEX user_type (user_id, type)
 );
 
 create table access_log (
@@ -210,7 +266,25 @@ create table replication_policy (
  description text,
  deleted tinyint (1) DEFAULT 0 NOT NULL,
  cron_str varchar(256),
+ /*
+ mode indicates the direction of the replication,
+ push means replicating the local project to the target,
+ pull means replicating the repositories on the target into the local project
+ */
+ mode varchar(16) NOT NULL DEFAULT 'push',
+ /*
+ repo_filter and tag_filter are comma separated globs, or regular expressions
+ prefixed with "regex:", the ones prefixed with "!" exclude the names they match
+ */
+ repo_filter varchar(256),
+ tag_filter varchar(256),
+ /*
+ verification is the result of the last verification of the policy in json
+ */
+ verification text,
  start_time timestamp NULL,
+ last_run_time timestamp NULL,
+ next_run_time timestamp NULL,
  creation_time timestamp DEFAULT CURRENT_TIMESTAMP,
  update_time timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
  PRIMARY KEY (id)
@@ -228,6 +302,18 @@ create table replication_target (
  1 means it's a regulart registry
  */
  target_type tinyint(1) NOT NULL DEFAULT 0,
+ /*
+ credential_type is basic or bearer, the token is used for bearer,
+ the password, token and client_key are encrypted
+ */
+ credential_type varchar(16) NOT NULL DEFAULT 'basic',
+ token text,
+ insecure tinyint(1) NOT NULL DEFAULT 0,
+ ca_cert text,
+ client_cert text,
+ client_key text,
+ bandwidth_limit int NOT NULL DEFAULT 0,
+ transfer_windows varchar(256),
  creation_time timestamp DEFAULT CURRENT_TIMESTAMP,
  update_time timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
  PRIMARY KEY (id)
@@ -240,11 +326,38 @@ create table replication_job (
  repository varchar(256) NOT NULL,
  operation  varchar(64) NOT NULL,
  tags   varchar(16384),
+ /*
+ job_type is the type of the job registered in job service, the jobs of types other than
+ replication have no policy and carry their parameters in json
+ */
+ job_type varchar(64) NOT NULL DEFAULT 'replication',
+ parameters text,
+ attempts int NOT NULL DEFAULT 0,
+ next_run_time timestamp NULL,
+ worker varchar(128),
+ heartbeat_time timestamp NULL,
+ /*
+ the statistics of the transfer in all the attempts of the job,
+ tag_results is a json object of the outcome of each tag, blobs is a json array
+ of the digests of the blobs counted so that a blob is counted once in all the attempts,
+ uploads is a json object of the locations of the upload sessions of the blobs
+ being pushed, so that the uploads are resumed when the job is retried
+ */
+ start_time timestamp NULL,
+ end_time timestamp NULL,
+ blobs_transferred int NOT NULL DEFAULT 0,
+ blobs_skipped int NOT NULL DEFAULT 0,
+ bytes_transferred bigint NOT NULL DEFAULT 0,
+ manifests int NOT NULL DEFAULT 0,
+ tag_results text,
+ blobs mediumtext,
+ uploads text,
  creation_time timestamp DEFAULT CURRENT_TIMESTAMP,
  update_time timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
  PRIMARY KEY (id),
  INDEX policy (policy_id),
- INDEX poid_uptime (policy_id, update_time)
+ INDEX poid_uptime (policy_id, update_time),
+ INDEX status_next_run (status, next_run_time)
  );
  
 create table properties (
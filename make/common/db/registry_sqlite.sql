@@ -133,7 +133,25 @@ create table replication_policy (
  description text,
  deleted tinyint (1) DEFAULT 0 NOT NULL,
  cron_str varchar(256),
+ /*
+ mode indicates the direction of the replication,
+ push means replicating the local project to the target,
+ pull means replicating the repositories on the target into the local project
+ */
+ mode varchar(16) NOT NULL DEFAULT 'push',
+ /*
+ repo_filter and tag_filter are comma separated globs, or regular expressions
+ prefixed with "regex:", the ones prefixed with "!" exclude the names they match
+ */
+ repo_filter varchar(256),
+ tag_filter varchar(256),
+ /*
+ verification is the result of the last verification of the policy in json
+ */
+ verification text,
  start_time timestamp NULL,
+ last_run_time timestamp NULL,
+ next_run_time timestamp NULL,
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP
  );
@@ -150,6 +168,18 @@ create table replication_target (
  1 means it's a regulart registry
  */
  target_type tinyint(1) NOT NULL DEFAULT 0,
+ /*
+ credential_type is basic or bearer, the token is used for bearer,
+ the password, token and client_key are encrypted
+ */
+ credential_type varchar(16) NOT NULL DEFAULT 'basic',
+ token text,
+ insecure tinyint(1) NOT NULL DEFAULT 0,
+ ca_cert text,
+ client_cert text,
+ client_key text,
+ bandwidth_limit int NOT NULL DEFAULT 0,
+ transfer_windows varchar(256),
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP
  );
@@ -161,6 +191,32 @@ create table replication_job (
  repository varchar(256) NOT NULL,
  operation  varchar(64) NOT NULL,
  tags   varchar(16384),
+ /*
+ job_type is the type of the job registered in job service, the jobs of types other than
+ replication have no policy and carry their parameters in json
+ */
+ job_type varchar(64) NOT NULL DEFAULT 'replication',
+ parameters text,
+ attempts int NOT NULL DEFAULT 0,
+ next_run_time timestamp NULL,
+ worker varchar(128),
+ heartbeat_time timestamp NULL,
+ /*
+ the statistics of the transfer in all the attempts of the job,
+ tag_results is a json object of the outcome of each tag, blobs is a json array
+ of the digests of the blobs counted so that a blob is counted once in all the attempts,
+ uploads is a json object of the locations of the upload sessions of the blobs
+ being pushed, so that the uploads are resumed when the job is retried
+ */
+ start_time timestamp NULL,
+ end_time timestamp NULL,
+ blobs_transferred int NOT NULL DEFAULT 0,
+ blobs_skipped int NOT NULL DEFAULT 0,
+ bytes_transferred bigint NOT NULL DEFAULT 0,
+ manifests int NOT NULL DEFAULT 0,
+ tag_results text,
+ blobs text,
+ uploads text,
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP
  );
@@ -119,3 +119,9 @@ func GetOrmer() orm.Ormer {
 func paginateForRawSQL(sql string, limit, offset int64) string {
 	return fmt.Sprintf("%s limit %d offset %d", sql, limit, offset)
 }
+
+// escapeLike escapes the wildcards of the LIKE pattern so that they are matched literally, the
+// pattern should be used with "escape '\\'"
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1025,6 +1025,9 @@ func TestAddRepTarget(t *testing.T) {
 	if tgt.Username != "admin" {
 		t.Errorf("Unexpected username in target: %s, expected admin", tgt.Username)
 	}
+	if tgt.CredentialType != models.TargetCredentialBasic {
+		t.Errorf("Unexpected credential type in target: %s, expected %s", tgt.CredentialType, models.TargetCredentialBasic)
+	}
 }
 
 func TestGetRepTargetByName(t *testing.T) {
@@ -1082,6 +1085,10 @@ func TestUpdateRepTarget(t *testing.T) {
 	target.URL = "http://new_url"
 	target.Username = "new_username"
 	target.Password = "new_password"
+	target.Type = models.TargetTypeRegistry
+	target.CredentialType = models.TargetCredentialBearer
+	target.Token = "token"
+	target.Insecure = 1
 
 	if err = UpdateRepTarget(*target); err != nil {
 		t.Fatalf("failed to update target: %v", err)
@@ -1107,6 +1114,22 @@ func TestUpdateRepTarget(t *testing.T) {
 	if target.Password != "new_password" {
 		t.Errorf("unexpected password: %s, expected: %s", target.Password, "new_password")
 	}
+
+	if target.Type != models.TargetTypeRegistry {
+		t.Errorf("unexpected type: %d, expected: %d", target.Type, models.TargetTypeRegistry)
+	}
+
+	if target.CredentialType != models.TargetCredentialBearer {
+		t.Errorf("unexpected credential type: %s, expected: %s", target.CredentialType, models.TargetCredentialBearer)
+	}
+
+	if target.Token != "token" {
+		t.Errorf("unexpected token: %s, expected: %s", target.Token, "token")
+	}
+
+	if target.Insecure != 1 {
+		t.Errorf("unexpected insecure: %d, expected: %d", target.Insecure, 1)
+	}
 }
 
 func TestFilterRepTargets(t *testing.T) {
@@ -1235,6 +1258,53 @@ func TestEnableRepPolicy(t *testing.T) {
 	}
 }
 
+func TestUpdateRepPolicySchedule(t *testing.T) {
+	next := time.Now().Add(time.Hour).Truncate(time.Minute)
+	updated, err := UpdateRepPolicySchedule(policyID, time.Time{}, time.Time{}, next)
+	if err != nil {
+		t.Fatalf("failed to update schedule of policy %d: %v", policyID, err)
+	}
+	if !updated {
+		t.Fatalf("schedule of policy %d is not updated", policyID)
+	}
+
+	// the schedule has been updated by others
+	updated, err = UpdateRepPolicySchedule(policyID, time.Time{}, time.Time{}, next.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to update schedule of policy %d: %v", policyID, err)
+	}
+	if updated {
+		t.Errorf("schedule of policy %d should not be updated", policyID)
+	}
+
+	last := next
+	updated, err = UpdateRepPolicySchedule(policyID, next, last, next.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to update schedule of policy %d: %v", policyID, err)
+	}
+	if !updated {
+		t.Fatalf("schedule of policy %d is not updated", policyID)
+	}
+
+	p, err := GetRepPolicy(policyID)
+	if err != nil {
+		t.Fatalf("failed to get policy %d: %v", policyID, err)
+	}
+	if !p.LastRunTime.Equal(last) || !p.NextRunTime.Equal(next.Add(time.Hour)) {
+		t.Errorf("unexpected schedule of policy %d: last %v, next %v", policyID, p.LastRunTime, p.NextRunTime)
+	}
+
+	if err = ResetRepPolicySchedule(policyID); err != nil {
+		t.Fatalf("failed to reset schedule of policy %d: %v", policyID, err)
+	}
+	if p, err = GetRepPolicy(policyID); err != nil {
+		t.Fatalf("failed to get policy %d: %v", policyID, err)
+	}
+	if !p.NextRunTime.IsZero() {
+		t.Errorf("next run time of policy %d is not reset: %v", policyID, p.NextRunTime)
+	}
+}
+
 func TestAddRepPolicy2(t *testing.T) {
 	policy2 := models.RepPolicy{
 		ProjectID:   3,
@@ -1289,6 +1359,9 @@ func TestAddRepJob(t *testing.T) {
 			"but in returned data:, Status: %s, Repository: %s, Operation: %s, PolicyID: %d, TagList: %v", id, models.JobPending, policyID, j.Status, j.Repository, j.Operation, j.PolicyID, j.TagList)
 		return
 	}
+	if j.Type != models.JobTypeReplication {
+		t.Errorf("unexpected type of job: %s != %s", j.Type, models.JobTypeReplication)
+	}
 }
 
 func TestUpdateRepJobStatus(t *testing.T) {
@@ -1314,6 +1387,73 @@ func TestUpdateRepJobStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateRepJobMetrics(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	end := time.Now()
+	job := &models.RepJob{
+		ID:               jobID,
+		StartTime:        start,
+		EndTime:          end,
+		BlobsTransferred: 2,
+		BlobsSkipped:     1,
+		BytesTransferred: 1024,
+		Manifests:        1,
+		TagResultMap: map[string]string{
+			"14.04":  models.TagResultTransferred,
+			"latest": models.TagResultSkipped,
+		},
+		BlobList: []string{"sha256:a", "sha256:b", "sha256:c"},
+	}
+	if err := UpdateRepJobMetrics(job); err != nil {
+		t.Fatalf("Error occurred in UpdateRepJobMetrics: %v, id: %d", err, jobID)
+	}
+
+	j, err := GetRepJob(jobID)
+	if err != nil {
+		t.Fatalf("Error occurred in GetRepJob: %v, id: %d", err, jobID)
+	}
+	if j.BlobsTransferred != 2 || j.BlobsSkipped != 1 || j.BytesTransferred != 1024 || j.Manifests != 1 {
+		t.Errorf("unexpected metrics of job %d: %+v", jobID, j)
+	}
+	if j.StartTime.IsZero() || j.EndTime.IsZero() {
+		t.Errorf("unexpected start time: %v and end time: %v of job %d", j.StartTime, j.EndTime, jobID)
+	}
+	if len(j.TagResultMap) != 2 || j.TagResultMap["latest"] != models.TagResultSkipped {
+		t.Errorf("unexpected results of tags of job %d: %v", jobID, j.TagResultMap)
+	}
+	if len(j.BlobList) != 3 {
+		t.Errorf("unexpected blobs of job %d: %v", jobID, j.BlobList)
+	}
+
+	stats, err := GetRepPolicyStats(policyID)
+	if err != nil {
+		t.Fatalf("Error occurred in GetRepPolicyStats: %v, policy ID: %d", err, policyID)
+	}
+	if stats.Jobs != 1 || stats.BlobsTransferred != 2 || stats.BytesTransferred != 1024 || stats.LastEndTime == nil {
+		t.Errorf("unexpected statistics of policy %d: %+v", policyID, stats)
+	}
+
+	stats, err = GetRepTargetStats(targetID)
+	if err != nil {
+		t.Fatalf("Error occurred in GetRepTargetStats: %v, target ID: %d", err, targetID)
+	}
+	if stats.Jobs < 1 || stats.BytesTransferred < 1024 {
+		t.Errorf("unexpected statistics of target %d: %+v", targetID, stats)
+	}
+
+	// reset the metrics
+	if err = UpdateRepJobMetrics(&models.RepJob{ID: jobID}); err != nil {
+		t.Fatalf("Error occurred in UpdateRepJobMetrics: %v, id: %d", err, jobID)
+	}
+	j, err = GetRepJob(jobID)
+	if err != nil {
+		t.Fatalf("Error occurred in GetRepJob: %v, id: %d", err, jobID)
+	}
+	if !j.StartTime.IsZero() || !j.EndTime.IsZero() {
+		t.Errorf("the start time: %v and end time: %v of job %d should be null", j.StartTime, j.EndTime, jobID)
+	}
+}
+
 func TestGetRepPolicyByProject(t *testing.T) {
 	p1, err := GetRepPolicyByProject(99)
 	if err != nil {
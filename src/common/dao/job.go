@@ -5,6 +5,7 @@ Copyright 2017 caicloud authors. All rights reserved.
 package dao
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/vmware/harbor/src/common/models"
@@ -21,13 +22,15 @@ func JobIdExists(jobId int64) bool {
 func CreateJob(job models.Job) (int64, error) {
 
 	o := GetOrmer()
-	p, err := o.Raw("insert into job (type, message, creation_time) values (?, ?, ?)").Prepare()
+	p, err := o.Raw(`insert into job (type, status, message, user_id, project_id, creation_time, update_time)
+		values (?, ?, ?, ?, ?, ?, ?)`).Prepare()
 	if err != nil {
 		return 0, err
 	}
+	defer p.Close()
 
 	now := time.Now()
-	r, err := p.Exec(job.Type, job.Message, now)
+	r, err := p.Exec(job.Type, models.JobPending, job.Message, job.UserID, job.ProjectID, now, now)
 	if err != nil {
 		return 0, err
 	}
@@ -44,12 +47,9 @@ func CreateJob(job models.Job) (int64, error) {
 func UpdateJobStatusById(jobId int64, message string) error {
 	o := GetOrmer()
 
-	sql := `update job set message = ? where job_id = ?`
-	params := make([]interface{}, 2)
-	params = append(params, message)
-	params = append(params, jobId)
+	sql := `update job set message = ?, update_time = ? where job_id = ?`
 
-	if _, err := o.Raw(sql, params).Exec(); err != nil {
+	if _, err := o.Raw(sql, message, time.Now(), jobId).Exec(); err != nil {
 		log.Errorf("Failed to update job message, error: %v", err)
 		return err
 	}
@@ -57,17 +57,77 @@ func UpdateJobStatusById(jobId int64, message string) error {
 	return nil
 }
 
+// StartJob marks the pending job as running, false is returned if the job is not pending,
+// e.g. it has been canceled.
+func StartJob(jobID int64) (bool, error) {
+	now := time.Now()
+	r, err := GetOrmer().Raw(`update job set status = ?, start_time = ?, update_time = ?
+		where job_id = ? and status = ?`, models.JobRunning, now, now, jobID, models.JobPending).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateJobProgress updates the progress and message of the running job.
+func UpdateJobProgress(jobID int64, progress int, message string) error {
+	_, err := GetOrmer().Raw(`update job set progress = ?, message = ?, update_time = ?
+		where job_id = ? and status = ?`, progress, message, time.Now(), jobID, models.JobRunning).Exec()
+	return err
+}
+
+// FinishJob records the final status of the job, the result is marshaled as JSON. The job which
+// has been finished or canceled is not updated.
+func FinishJob(jobID int64, status, message string, result interface{}, errorDetail string) error {
+	data := []byte{}
+	if result != nil {
+		var err error
+		if data, err = json.Marshal(result); err != nil {
+			return err
+		}
+	}
+
+	sql := `update job set status = ?, message = ?, result = ?, error_detail = ?, end_time = ?, update_time = ?`
+	if status == models.JobFinished {
+		sql += `, progress = 100`
+	}
+	sql += ` where job_id = ? and status in (?, ?)`
+
+	now := time.Now()
+	_, err := GetOrmer().Raw(sql, status, message, string(data), errorDetail, now, now,
+		jobID, models.JobPending, models.JobRunning).Exec()
+	return err
+}
+
+// CancelJob marks the pending or running job as canceled, false is returned if the job has
+// been finished. The running job stops when it finds out the cancellation.
+func CancelJob(jobID int64) (bool, error) {
+	now := time.Now()
+	r, err := GetOrmer().Raw(`update job set status = ?, end_time = ?, update_time = ?
+		where job_id = ? and status in (?, ?)`, models.JobCanceled, now, now,
+		jobID, models.JobPending, models.JobRunning).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// GetJobStatus returns the status of the job.
+func GetJobStatus(jobID int64) (string, error) {
+	var status string
+	err := GetOrmer().Raw(`select status from job where job_id = ?`, jobID).QueryRow(&status)
+	return status, err
+}
+
 // GetJobById ...
 func GetJobById(jobId int64) (*models.Job, error) {
 	o := GetOrmer()
 
-	sql := `select j.job_id, j.type, j.message, j.creation_time
-            from job j where j.job_id = ?`
-	params := make([]interface{}, 1)
-	params = append(params, jobId)
-
-	j := []models.Job{}
-	count, err := o.Raw(sql, params).QueryRows(&j)
+	sql := `select * from job j where j.job_id = ?`
+	j := []*models.Job{}
+	count, err := o.Raw(sql, jobId).QueryRows(&j)
 
 	if err != nil {
 		return nil, err
@@ -77,5 +137,64 @@ func GetJobById(jobId int64) (*models.Job, error) {
 		return nil, nil
 	}
 
-	return &j[0], nil
+	setJobResultData(j[0])
+	return j[0], nil
+}
+
+// ListJobs returns the total count and the jobs of the page which match the query,
+// the latest created ones are returned first.
+func ListJobs(query *models.JobQuery) (int64, []*models.Job, error) {
+	qs := GetOrmer().QueryTable(&models.Job{})
+	if len(query.Type) > 0 {
+		qs = qs.Filter("Type", query.Type)
+	}
+	if len(query.Status) > 0 {
+		qs = qs.Filter("Status", query.Status)
+	}
+	if query.UserID > 0 {
+		qs = qs.Filter("UserID", query.UserID)
+	}
+	if query.ProjectID > 0 {
+		qs = qs.Filter("ProjectID", query.ProjectID)
+	}
+
+	total, err := qs.Count()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	qs = qs.OrderBy("-CreationTime", "-JobID")
+	if query.PageSize > 0 {
+		page := query.Page
+		if page <= 0 {
+			page = 1
+		}
+		qs = qs.Limit(query.PageSize, (page-1)*query.PageSize)
+	}
+
+	jobs := []*models.Job{}
+	if _, err = qs.All(&jobs); err != nil {
+		return 0, nil, err
+	}
+
+	for _, job := range jobs {
+		setJobResultData(job)
+	}
+	return total, jobs, nil
+}
+
+// DeleteJobsBefore deletes the finished, failed and canceled jobs which ended before the time.
+func DeleteJobsBefore(t time.Time) (int64, error) {
+	r, err := GetOrmer().Raw(`delete from job where end_time < ? and status in (?, ?, ?)`,
+		t, models.JobFinished, models.JobError, models.JobCanceled).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+func setJobResultData(job *models.Job) {
+	if len(job.Result) > 0 {
+		job.ResultData = []byte(job.Result)
+	}
 }
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 caicloud authors. All rights reserved.
+*/
+
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	jobType := "test_job_lifecycle"
+	defer func() {
+		if _, err := GetOrmer().Raw(`delete from job where type = ?`, jobType).Exec(); err != nil {
+			t.Fatalf("failed to delete jobs of type %s: %v", jobType, err)
+		}
+	}()
+
+	finishedID, err := CreateJob(models.Job{Type: jobType, UserID: 1, ProjectID: 1})
+	if err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	canceledID, err := CreateJob(models.Job{Type: jobType, UserID: 2})
+	if err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+
+	if started, err := StartJob(finishedID); err != nil || !started {
+		t.Fatalf("failed to start job %d: %v", finishedID, err)
+	}
+	if started, err := StartJob(finishedID); err != nil || started {
+		t.Errorf("job %d should not be started twice: %v", finishedID, err)
+	}
+	if err = UpdateJobProgress(finishedID, 50, "half done"); err != nil {
+		t.Fatalf("failed to update progress of job %d: %v", finishedID, err)
+	}
+	if err = FinishJob(finishedID, models.JobFinished, "done", map[string]string{"key": "value"}, ""); err != nil {
+		t.Fatalf("failed to finish job %d: %v", finishedID, err)
+	}
+
+	job, err := GetJobById(finishedID)
+	if err != nil {
+		t.Fatalf("failed to get job %d: %v", finishedID, err)
+	}
+	if job.Status != models.JobFinished || job.Progress != 100 || job.Message != "done" ||
+		string(job.ResultData) != `{"key":"value"}` {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	if canceled, err := CancelJob(finishedID); err != nil || canceled {
+		t.Errorf("finished job %d should not be canceled: %v", finishedID, err)
+	}
+	if canceled, err := CancelJob(canceledID); err != nil || !canceled {
+		t.Fatalf("failed to cancel job %d: %v", canceledID, err)
+	}
+	if started, err := StartJob(canceledID); err != nil || started {
+		t.Errorf("canceled job %d should not be started: %v", canceledID, err)
+	}
+	if status, err := GetJobStatus(canceledID); err != nil || status != models.JobCanceled {
+		t.Errorf("unexpected status of job %d: %s, error: %v", canceledID, status, err)
+	}
+
+	total, jobs, err := ListJobs(&models.JobQuery{Type: jobType, PageSize: 1})
+	if err != nil {
+		t.Fatalf("failed to list jobs: %v", err)
+	}
+	if total != 2 || len(jobs) != 1 || jobs[0].JobID != canceledID {
+		t.Errorf("unexpected jobs: %d, %+v", total, jobs)
+	}
+
+	if total, _, err = ListJobs(&models.JobQuery{Type: jobType, UserID: 1}); err != nil || total != 1 {
+		t.Errorf("unexpected count of jobs of user 1: %d, error: %v", total, err)
+	}
+
+	if _, err = DeleteJobsBefore(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to delete jobs: %v", err)
+	}
+	if total, _, err = ListJobs(&models.JobQuery{Type: jobType}); err != nil || total != 0 {
+		t.Errorf("unexpected count of jobs after deleting: %d, error: %v", total, err)
+	}
+}
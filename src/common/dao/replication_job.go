@@ -16,6 +16,7 @@
 package dao
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -23,11 +24,15 @@ import (
 
 	"github.com/astaxie/beego/orm"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
 )
 
 // AddRepTarget ...
 func AddRepTarget(target models.RepTarget) (int64, error) {
 	o := GetOrmer()
+	if len(target.CredentialType) == 0 {
+		target.CredentialType = models.TargetCredentialBasic
+	}
 	return o.Insert(&target)
 }
 
@@ -77,7 +82,23 @@ func DeleteRepTarget(id int64) error {
 func UpdateRepTarget(target models.RepTarget) error {
 	o := GetOrmer()
 	target.UpdateTime = time.Now()
-	_, err := o.Update(&target, "URL", "Name", "Username", "Password", "UpdateTime")
+	if len(target.CredentialType) == 0 {
+		target.CredentialType = models.TargetCredentialBasic
+	}
+	_, err := o.Update(&target, "URL", "Name", "Username", "Password", "Type", "CredentialType",
+		"Token", "Insecure", "CACert", "ClientCert", "ClientKey", "BandwidthLimit", "TransferWindows", "UpdateTime")
+	return err
+}
+
+// UpdateRepTargetTransferSettings updates the bandwidth limit and transfer windows of the target
+func UpdateRepTargetTransferSettings(id int64, bandwidthLimit int, transferWindows string) error {
+	target := &models.RepTarget{
+		ID:              id,
+		BandwidthLimit:  bandwidthLimit,
+		TransferWindows: transferWindows,
+		UpdateTime:      time.Now(),
+	}
+	_, err := GetOrmer().Update(target, "BandwidthLimit", "TransferWindows", "UpdateTime")
 	return err
 }
 
@@ -106,14 +127,18 @@ func FilterRepTargets(name string) ([]*models.RepTarget, error) {
 // AddRepPolicy ...
 func AddRepPolicy(policy models.RepPolicy) (int64, error) {
 	o := GetOrmer()
-	sql := `insert into replication_policy (name, project_id, target_id, enabled, description, cron_str, start_time, creation_time, update_time ) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sql := `insert into replication_policy (name, project_id, target_id, enabled, description, cron_str, mode, repo_filter, tag_filter, start_time, creation_time, update_time ) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	p, err := o.Raw(sql).Prepare()
 	if err != nil {
 		return 0, err
 	}
 
 	params := []interface{}{}
-	params = append(params, policy.Name, policy.ProjectID, policy.TargetID, policy.Enabled, policy.Description, policy.CronStr)
+	if len(policy.Mode) == 0 {
+		policy.Mode = models.RepModePush
+	}
+	params = append(params, policy.Name, policy.ProjectID, policy.TargetID, policy.Enabled, policy.Description, policy.CronStr,
+		policy.Mode, policy.RepoFilter, policy.TagFilter)
 	now := time.Now()
 	if policy.Enabled == 1 {
 		params = append(params, now)
@@ -155,7 +180,9 @@ func FilterRepPolicies(name string, projectID int64) ([]*models.RepPolicy, error
 
 	sql := `select rp.id, rp.project_id, p.name as project_name, rp.target_id, 
 				rt.name as target_name, rp.name, rp.enabled, rp.description,
-				rp.cron_str, rp.start_time, rp.creation_time, rp.update_time, 
+				rp.cron_str, rp.mode, rp.repo_filter, rp.tag_filter,
+				rp.start_time, rp.last_run_time, rp.next_run_time,
+				rp.creation_time, rp.update_time, 
 				count(rj.status) as error_job_count 
 			from replication_policy rp 
 			left join project p on rp.project_id=p.project_id 
@@ -248,7 +275,8 @@ func GetRepPolicyByProjectAndTarget(projectID, targetID int64) ([]*models.RepPol
 func UpdateRepPolicy(policy *models.RepPolicy) error {
 	o := GetOrmer()
 	policy.UpdateTime = time.Now()
-	_, err := o.Update(policy, "TargetID", "Name", "Enabled", "Description", "CronStr", "UpdateTime")
+	_, err := o.Update(policy, "TargetID", "Name", "Enabled", "Description", "CronStr",
+		"Mode", "RepoFilter", "TagFilter", "UpdateTime")
 	return err
 }
 
@@ -294,12 +322,107 @@ func DisableRepPolicy(id int64) error {
 	return UpdateRepPolicyEnablement(id, 0)
 }
 
+// UpdateRepPolicyVerification stores the result of the last verification of the policy
+func UpdateRepPolicyVerification(id int64, verification string) error {
+	_, err := GetOrmer().Raw(`update replication_policy set verification = ? where id = ?`,
+		verification, id).Exec()
+	return err
+}
+
+// GetScheduledRepPolicies returns the enabled policies which have cron expressions
+func GetScheduledRepPolicies() ([]*models.RepPolicy, error) {
+	o := GetOrmer()
+	sql := `select * from replication_policy
+		where deleted = 0 and enabled = 1 and cron_str is not null and cron_str != ''`
+
+	var policies []*models.RepPolicy
+	if _, err := o.Raw(sql).QueryRows(&policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// UpdateRepPolicySchedule sets the next run time of the policy, which is cleared if it is zero,
+// and the last run time if it is not zero. The update only happens if the next run time in database is still the
+// one in parameter "previous" so that only one job service triggers a scheduled run.
+// It returns true if the policy is updated.
+func UpdateRepPolicySchedule(id int64, previous, lastRunTime, nextRunTime time.Time) (bool, error) {
+	sql := `update replication_policy set next_run_time = ?`
+	params := []interface{}{nextRunTime}
+	if nextRunTime.IsZero() {
+		params[0] = nil
+	}
+	if !lastRunTime.IsZero() {
+		sql += `, last_run_time = ?`
+		params = append(params, lastRunTime)
+	}
+	sql += ` where id = ?`
+	params = append(params, id)
+	if previous.IsZero() {
+		sql += ` and next_run_time is null`
+	} else {
+		sql += ` and next_run_time = ?`
+		params = append(params, previous)
+	}
+
+	r, err := GetOrmer().Raw(sql, params...).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ResetRepPolicySchedule clears the next run time of the policy so that it will be
+// computed again from the cron expression
+func ResetRepPolicySchedule(id int64) error {
+	_, err := GetOrmer().Raw(`update replication_policy set next_run_time = null where id = ?`, id).Exec()
+	return err
+}
+
+// IsRepPolicyRunning returns true if the policy has pending, running or retrying jobs
+func IsRepPolicyRunning(policyID int64) (bool, error) {
+	n, err := repJobPolicyIDQs(policyID).
+		Filter("status__in", models.JobPending, models.JobRunning, models.JobRetrying).
+		Count()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetReplicatedRepositories returns the repositories which have been replicated to the
+// registry of the URL successfully, the repository excluded is not included. The ones
+// replicated recently come first.
+func GetReplicatedRepositories(targetURL, excluded string, limit int) ([]string, error) {
+	sql := `select rj.repository from replication_job rj
+		join replication_policy rp on rj.policy_id = rp.id
+		join replication_target rt on rp.target_id = rt.id
+		where rt.url = ? and rj.operation = ? and rj.status = ? and rj.repository != ?
+		group by rj.repository
+		order by max(rj.update_time) desc
+		limit ?`
+
+	var repositories []string
+	if _, err := GetOrmer().Raw(sql, targetURL, models.RepOpTransfer, models.JobFinished,
+		excluded, limit).QueryRows(&repositories); err != nil {
+		return nil, err
+	}
+	return repositories, nil
+}
+
 // AddRepJob ...
 func AddRepJob(job models.RepJob) (int64, error) {
 	o := GetOrmer()
 	if len(job.Status) == 0 {
 		job.Status = models.JobPending
 	}
+	if len(job.Type) == 0 {
+		job.Type = models.JobTypeReplication
+	}
 	if len(job.TagList) > 0 {
 		job.Tags = strings.Join(job.TagList, ",")
 	}
@@ -406,6 +529,14 @@ func UpdateRepJobStatus(id int64, status string) error {
 	return err
 }
 
+// UpdateRepJobStatusOfWorker updates the status of the job only if it is held by the worker, so that
+// a worker which has lost the lease of the job doesn't overwrite the status set by the new holder.
+func UpdateRepJobStatusOfWorker(id int64, worker, status string) error {
+	_, err := GetOrmer().Raw(`update replication_job set status = ?, update_time = ?
+		where id = ? and worker = ?`, status, time.Now(), id, worker).Exec()
+	return err
+}
+
 // ResetRunningJobs update all running jobs status to pending
 func ResetRunningJobs() error {
 	o := GetOrmer()
@@ -414,6 +545,171 @@ func ResetRunningJobs() error {
 	return err
 }
 
+// repJobClaimableCond is the condition of the jobs which can be claimed by workers: the pending
+// and retrying ones whose next run time has come and the running ones whose worker has
+// stopped sending heartbeats before the time
+const repJobClaimableCond = `((status in (?, ?) and (next_run_time is null or next_run_time <= ?))
+	or (status = ? and (heartbeat_time is null or heartbeat_time < ?)))`
+
+func repJobClaimableParams(now, staleBefore time.Time) []interface{} {
+	return []interface{}{models.JobPending, models.JobRetrying, now, models.JobRunning, staleBefore}
+}
+
+// ClaimRepJob claims the earliest job which can be run by the worker, the row is locked in a
+// transaction so that a job is claimed by only one worker even if there are several job services.
+// The claimed job is marked running and its attempts is increased, nil is returned if there is
+// no job to claim.
+func ClaimRepJob(worker string, staleBefore time.Time) (job *models.RepJob, err error) {
+	o := orm.NewOrm()
+	if err = o.Begin(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			o.Rollback()
+			return
+		}
+		err = o.Commit()
+	}()
+
+	now := time.Now()
+	jobs := []*models.RepJob{}
+	sql := `select * from replication_job where ` + repJobClaimableCond + ` order by id limit 1 for update`
+	if _, err = o.Raw(sql, repJobClaimableParams(now, staleBefore)...).QueryRows(&jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	job = jobs[0]
+	job.Status = models.JobRunning
+	job.Attempts++
+	if _, err = o.Raw(`update replication_job set status = ?, attempts = ?, worker = ?, heartbeat_time = ?,
+		update_time = ? where id = ?`, job.Status, job.Attempts, worker, now, now, job.ID).Exec(); err != nil {
+		return nil, err
+	}
+
+	genTagListForJob(job)
+	return job, nil
+}
+
+// HeartbeatRepJob records that the running job is still being handled by the worker, false is
+// returned if the job has been claimed by others or is not running any more.
+func HeartbeatRepJob(id int64, worker string) (bool, error) {
+	r, err := GetOrmer().Raw(`update replication_job set heartbeat_time = ?
+		where id = ? and worker = ? and status = ?`, time.Now(), id, worker, models.JobRunning).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// RetryRepJob marks the job held by the worker retrying, it can be claimed again after the next run time.
+func RetryRepJob(id int64, worker string, nextRunTime time.Time) error {
+	_, err := GetOrmer().Raw(`update replication_job set status = ?, next_run_time = ?, update_time = ?
+		where id = ? and worker = ?`, models.JobRetrying, nextRunTime, time.Now(), id, worker).Exec()
+	return err
+}
+
+// DeferRepJob puts the job claimed by the worker back to the queue as pending until the next run
+// time, the attempt is not counted
+func DeferRepJob(id int64, worker string, nextRunTime time.Time) error {
+	_, err := GetOrmer().Raw(`update replication_job set status = ?, next_run_time = ?,
+		attempts = case when attempts > 0 then attempts - 1 else 0 end,
+		worker = null, heartbeat_time = null, update_time = ? where id = ? and worker = ?`,
+		models.JobPending, nextRunTime, time.Now(), id, worker).Exec()
+	return err
+}
+
+// GetRepJobQueueStats returns the counts of jobs in the queue, the running jobs whose heartbeats
+// are before staleBefore are counted as stale.
+func GetRepJobQueueStats(staleBefore time.Time) (*models.RepJobQueueStats, error) {
+	o := GetOrmer()
+	stats := &models.RepJobQueueStats{}
+
+	counts := []struct {
+		Status string
+		Count  int64
+	}{}
+	if _, err := o.Raw(`select status, count(*) as count from replication_job
+		where status in (?, ?, ?) group by status`,
+		models.JobPending, models.JobRunning, models.JobRetrying).QueryRows(&counts); err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		switch c.Status {
+		case models.JobPending:
+			stats.Pending = c.Count
+		case models.JobRunning:
+			stats.Running = c.Count
+		case models.JobRetrying:
+			stats.Retrying = c.Count
+		}
+	}
+
+	now := time.Now()
+	if err := o.Raw(`select count(*) from replication_job where `+repJobClaimableCond,
+		repJobClaimableParams(now, staleBefore)...).QueryRow(&stats.Ready); err != nil {
+		return nil, err
+	}
+	if err := o.Raw(`select count(*) from replication_job where status = ?
+		and (heartbeat_time is null or heartbeat_time < ?)`,
+		models.JobRunning, staleBefore).QueryRow(&stats.Stale); err != nil {
+		return nil, err
+	}
+
+	if stats.Pending > 0 {
+		jobs := []*models.RepJob{}
+		if _, err := repJobQs().Filter("status", models.JobPending).
+			OrderBy("CreationTime").Limit(1).All(&jobs); err != nil {
+			return nil, err
+		}
+		if len(jobs) > 0 {
+			stats.OldestPendingTime = &jobs[0].CreationTime
+		}
+	}
+
+	return stats, nil
+}
+
+// ResetRunningJobsOfWorkers updates the running jobs held by the workers whose names have the
+// prefix and are matched by match to pending. It is called when the job service restarts, so that
+// the jobs interrupted are claimed again without waiting for their leases to expire, the
+// interrupted attempts are not counted.
+func ResetRunningJobsOfWorkers(prefix string, match func(worker string) bool) (int64, error) {
+	o := GetOrmer()
+	jobs := []struct {
+		ID     int64
+		Worker string
+	}{}
+	if _, err := o.Raw(`select id, worker from replication_job where status = ? and worker like ? escape '\\'`,
+		models.JobRunning, escapeLike(prefix)+"%").QueryRows(&jobs); err != nil {
+		return 0, err
+	}
+
+	params := []interface{}{models.JobPending, time.Now(), models.JobRunning}
+	for _, j := range jobs {
+		if match(j.Worker) {
+			params = append(params, j.ID)
+		}
+	}
+	n := len(params) - 3
+	if n == 0 {
+		return 0, nil
+	}
+
+	r, err := o.Raw(`update replication_job set status = ?,
+		attempts = case when attempts > 0 then attempts - 1 else 0 end,
+		worker = null, heartbeat_time = null, update_time = ?
+		where status = ? and id in (`+strings.TrimSuffix(strings.Repeat("?,", n), ",")+`)`, params...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
 // GetRepJobByStatus get jobs of certain statuses
 func GetRepJobByStatus(status ...string) ([]*models.RepJob, error) {
 	var res []*models.RepJob
@@ -426,10 +722,135 @@ func GetRepJobByStatus(status ...string) ([]*models.RepJob, error) {
 	return res, err
 }
 
+// UpdateRepJobMetrics updates the start time, the end time and the statistics of the transfer of the job
+func UpdateRepJobMetrics(job *models.RepJob) error {
+	job.TagResults = ""
+	if len(job.TagResultMap) > 0 {
+		b, err := json.Marshal(job.TagResultMap)
+		if err != nil {
+			return err
+		}
+		job.TagResults = string(b)
+	}
+	job.Blobs = ""
+	if len(job.BlobList) > 0 {
+		b, err := json.Marshal(job.BlobList)
+		if err != nil {
+			return err
+		}
+		job.Blobs = string(b)
+	}
+	job.Uploads = ""
+	if len(job.UploadMap) > 0 {
+		b, err := json.Marshal(job.UploadMap)
+		if err != nil {
+			return err
+		}
+		job.Uploads = string(b)
+	}
+
+	params := []interface{}{job.StartTime, job.EndTime}
+	for i, t := range []time.Time{job.StartTime, job.EndTime} {
+		if t.IsZero() {
+			params[i] = nil
+		}
+	}
+	params = append(params, job.BlobsTransferred, job.BlobsSkipped, job.BytesTransferred,
+		job.Manifests, job.TagResults, job.Blobs, job.Uploads, job.ID)
+	_, err := GetOrmer().Raw(`update replication_job set start_time = ?, end_time = ?,
+		blobs_transferred = ?, blobs_skipped = ?, bytes_transferred = ?, manifests = ?,
+		tag_results = ?, blobs = ?, uploads = ? where id = ?`, params...).Exec()
+	return err
+}
+
+// GetRepPolicyStats returns the statistics of the replication jobs of the policy
+func GetRepPolicyStats(policyID int64) (*models.RepStats, error) {
+	return getRepStats(`policy_id = ?`, policyID)
+}
+
+// GetRepTargetStats returns the statistics of the replication jobs of the policies whose target is the one
+func GetRepTargetStats(targetID int64) (*models.RepStats, error) {
+	return getRepStats(`policy_id in (select id from replication_policy where target_id = ?)`, targetID)
+}
+
+func getRepStats(cond string, args ...interface{}) (*models.RepStats, error) {
+	o := GetOrmer()
+
+	sums := struct {
+		Jobs             int64
+		Finished         int64
+		Failed           int64
+		Running          int64
+		BlobsTransferred int64
+		BlobsSkipped     int64
+		BytesTransferred int64
+		Manifests        int64
+	}{}
+	params := append([]interface{}{models.JobFinished, models.JobError, models.JobRunning}, args...)
+	if err := o.Raw(`select count(*) as jobs,
+		coalesce(sum(case when status = ? then 1 else 0 end), 0) as finished,
+		coalesce(sum(case when status = ? then 1 else 0 end), 0) as failed,
+		coalesce(sum(case when status = ? then 1 else 0 end), 0) as running,
+		coalesce(sum(blobs_transferred), 0) as blobs_transferred,
+		coalesce(sum(blobs_skipped), 0) as blobs_skipped,
+		coalesce(sum(bytes_transferred), 0) as bytes_transferred,
+		coalesce(sum(manifests), 0) as manifests
+		from replication_job where `+cond, params...).QueryRow(&sums); err != nil {
+		return nil, err
+	}
+
+	stats := &models.RepStats{
+		Jobs:             sums.Jobs,
+		Finished:         sums.Finished,
+		Failed:           sums.Failed,
+		Running:          sums.Running,
+		BlobsTransferred: sums.BlobsTransferred,
+		BlobsSkipped:     sums.BlobsSkipped,
+		BytesTransferred: sums.BytesTransferred,
+		Manifests:        sums.Manifests,
+	}
+
+	// the durations are summed up here as the functions of time differ between databases
+	times := []struct {
+		StartTime time.Time
+		EndTime   time.Time
+	}{}
+	if _, err := o.Raw(`select start_time, end_time from replication_job
+		where start_time is not null and end_time is not null and `+cond, args...).QueryRows(&times); err != nil {
+		return nil, err
+	}
+	for _, t := range times {
+		if d := t.EndTime.Sub(t.StartTime); d > 0 {
+			stats.Duration += int64(d / time.Second)
+		}
+		if stats.LastEndTime == nil || t.EndTime.After(*stats.LastEndTime) {
+			end := t.EndTime
+			stats.LastEndTime = &end
+		}
+	}
+
+	return stats, nil
+}
+
 func genTagListForJob(jobs ...*models.RepJob) {
 	for _, j := range jobs {
 		if len(j.Tags) > 0 {
 			j.TagList = strings.Split(j.Tags, ",")
 		}
+		if len(j.TagResults) > 0 {
+			if err := json.Unmarshal([]byte(j.TagResults), &j.TagResultMap); err != nil {
+				log.Warningf("failed to parse the results of tags of job %d: %v", j.ID, err)
+			}
+		}
+		if len(j.Blobs) > 0 {
+			if err := json.Unmarshal([]byte(j.Blobs), &j.BlobList); err != nil {
+				log.Warningf("failed to parse the blobs of job %d: %v", j.ID, err)
+			}
+		}
+		if len(j.Uploads) > 0 {
+			if err := json.Unmarshal([]byte(j.Uploads), &j.UploadMap); err != nil {
+				log.Warningf("failed to parse the upload sessions of job %d: %v", j.ID, err)
+			}
+		}
 	}
 }
@@ -0,0 +1,138 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+)
+
+// the date format of column day in table repository_daily_stat
+const statDayFormat = "2006-01-02"
+
+// IncreaseRepoDailyStat increases the pull or push count of the tag on the day of t,
+// operation should be "pull" or "push".
+func IncreaseRepoDailyStat(repoName, tag, operation string, t time.Time) error {
+	column := ""
+	switch operation {
+	case "pull":
+		column = "pull_count"
+	case "push":
+		column = "push_count"
+	default:
+		return fmt.Errorf("unsupported operation: %s", operation)
+	}
+
+	projectName, _ := utils.ParseRepository(repoName)
+	sql := `insert into repository_daily_stat (project_id, repo_name, tag, day, ` + column + `)
+		select project_id, ?, ?, ?, 1 from project where name = ?
+		ON DUPLICATE KEY UPDATE ` + column + ` = ` + column + ` + 1`
+	_, err := GetOrmer().Raw(sql, repoName, tag, t.Format(statDayFormat), projectName).Exec()
+	return err
+}
+
+// genStatFilter generates the where clause for the projects and the start day, nil projectIDs
+// means no limitation on projects.
+func genStatFilter(projectIDs []int64, since time.Time) (string, []interface{}) {
+	sql := ` where s.day >= ? `
+	params := []interface{}{since.Format(statDayFormat)}
+	if projectIDs != nil {
+		if len(projectIDs) == 0 {
+			return sql + ` and 1 = 0 `, params
+		}
+		sql += ` and s.project_id in (` + strings.TrimSuffix(strings.Repeat("?,", len(projectIDs)), ",") + `) `
+		for _, id := range projectIDs {
+			params = append(params, id)
+		}
+	}
+	return sql, params
+}
+
+// GetTopReposSince returns the most pulled repositories since the day of since, nil projectIDs
+// means the repositories of all projects are counted.
+func GetTopReposSince(projectIDs []int64, since time.Time, count int) ([]models.TopRepo, error) {
+	where, params := genStatFilter(projectIDs, since)
+	sql := `select s.repo_name, sum(s.pull_count) as access_count
+		from repository_daily_stat s ` + where + `
+		group by s.repo_name
+		having access_count > 0
+		order by access_count desc, s.repo_name
+		limit ?`
+	params = append(params, count)
+
+	topRepos := []models.TopRepo{}
+	_, err := GetOrmer().Raw(sql, params...).QueryRows(&topRepos)
+	return topRepos, err
+}
+
+// GetUsage returns the daily counts of pulls and pushes since the day of since, the counts
+// can be limited to a repository, a tag of the repository or projects.
+func GetUsage(projectIDs []int64, repoName, tag string, since time.Time) ([]*models.UsagePoint, error) {
+	where, params := genStatFilter(projectIDs, since)
+	if len(repoName) != 0 {
+		where += ` and s.repo_name = ? `
+		params = append(params, repoName)
+	}
+	if len(tag) != 0 {
+		where += ` and s.tag = ? `
+		params = append(params, tag)
+	}
+
+	sql := `select date_format(s.day, '%Y-%m-%d') as day, sum(s.pull_count) as pull_count,
+		sum(s.push_count) as push_count
+		from repository_daily_stat s ` + where + `
+		group by s.day
+		order by s.day`
+
+	points := []*models.UsagePoint{}
+	_, err := GetOrmer().Raw(sql, params...).QueryRows(&points)
+	return points, err
+}
+
+// GetReposNotPulledSince returns the repositories which were created before since and
+// have not been pulled since then, nil projectIDs means no limitation on projects.
+func GetReposNotPulledSince(projectIDs []int64, since time.Time, page, pageSize int64) (int64, []*models.RepoRecord, error) {
+	sql := ` from repository r
+		where r.creation_time < ?
+		and r.name not in (
+			select s.repo_name from repository_daily_stat s
+			where s.day >= ? and s.pull_count > 0) `
+	params := []interface{}{since, since.Format(statDayFormat)}
+	if projectIDs != nil {
+		if len(projectIDs) == 0 {
+			return 0, []*models.RepoRecord{}, nil
+		}
+		sql += ` and r.project_id in (` + strings.TrimSuffix(strings.Repeat("?,", len(projectIDs)), ",") + `) `
+		for _, id := range projectIDs {
+			params = append(params, id)
+		}
+	}
+
+	o := GetOrmer()
+	var total int64
+	if err := o.Raw(`select count(*) `+sql, params...).QueryRow(&total); err != nil {
+		return 0, nil, err
+	}
+
+	repos := []*models.RepoRecord{}
+	_, err := o.Raw(paginateForRawSQL(`select r.* `+sql+` order by r.name`, pageSize, (page-1)*pageSize),
+		params...).QueryRows(&repos)
+	return total, repos, err
+}
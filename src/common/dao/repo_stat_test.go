@@ -0,0 +1,89 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepoDailyStat(t *testing.T) {
+	repoName := "library/stat-test"
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+
+	for _, op := range []struct {
+		operation string
+		t         time.Time
+	}{
+		{"push", yesterday},
+		{"pull", yesterday},
+		{"pull", now},
+		{"pull", now},
+	} {
+		if err := IncreaseRepoDailyStat(repoName, "latest", op.operation, op.t); err != nil {
+			t.Fatalf("failed to increase daily stat: %v", err)
+		}
+	}
+	defer func() {
+		if _, err := GetOrmer().Raw(`delete from repository_daily_stat where repo_name = ?`, repoName).Exec(); err != nil {
+			t.Fatalf("failed to delete daily stat of %s: %v", repoName, err)
+		}
+	}()
+
+	if err := IncreaseRepoDailyStat(repoName, "latest", "delete", now); err == nil {
+		t.Errorf("an error is expected for unsupported operation")
+	}
+
+	points, err := GetUsage(nil, repoName, "", yesterday)
+	if err != nil {
+		t.Fatalf("failed to get usage of %s: %v", repoName, err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("unexpected length of usage points: %d != 2", len(points))
+	}
+	if points[0].PushCount != 1 || points[0].PullCount != 1 {
+		t.Errorf("unexpected counts of %s: %+v", points[0].Day, points[0])
+	}
+	if points[1].PushCount != 0 || points[1].PullCount != 2 {
+		t.Errorf("unexpected counts of %s: %+v", points[1].Day, points[1])
+	}
+
+	repos, err := GetTopReposSince(nil, now, 100)
+	if err != nil {
+		t.Fatalf("failed to get top repos: %v", err)
+	}
+	found := false
+	for _, repo := range repos {
+		if repo.RepoName == repoName {
+			found = true
+			if repo.AccessCount != 2 {
+				t.Errorf("unexpected access count of %s: %d != 2", repoName, repo.AccessCount)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("%s not found in top repos", repoName)
+	}
+
+	repos, err = GetTopReposSince([]int64{}, now, 100)
+	if err != nil {
+		t.Fatalf("failed to get top repos: %v", err)
+	}
+	if len(repos) != 0 {
+		t.Errorf("no repository is expected if no project is provided")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// AddOrUpdateRepoTag records the digest the tag of the repository points to.
+func AddOrUpdateRepoTag(repoName, tag, digest string) error {
+	sql := `insert into repository_tag (repo_name, tag, digest, creation_time, update_time)
+		values (?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE digest = ?, update_time = NOW()`
+	_, err := GetOrmer().Raw(sql, repoName, tag, digest, digest).Exec()
+	return err
+}
+
+// DeleteRepoTag removes the record of the tag.
+func DeleteRepoTag(repoName, tag string) error {
+	_, err := GetOrmer().QueryTable(&models.RepoTag{}).
+		Filter("RepoName", repoName).
+		Filter("Tag", tag).
+		Delete()
+	return err
+}
+
+// GetRepoTags returns all the tag records of the repository.
+func GetRepoTags(repoName string) ([]*models.RepoTag, error) {
+	tags := []*models.RepoTag{}
+	_, err := GetOrmer().QueryTable(&models.RepoTag{}).
+		Filter("RepoName", repoName).
+		OrderBy("Tag").
+		All(&tags)
+	return tags, err
+}
+
+// SyncRepoTags removes the records of the tags which do not exist in the registry any more.
+func SyncRepoTags(repoName string, tags []string) error {
+	qs := GetOrmer().QueryTable(&models.RepoTag{}).Filter("RepoName", repoName)
+	if len(tags) > 0 {
+		qs = qs.Exclude("Tag__in", tags)
+	}
+	_, err := qs.Delete()
+	return err
+}
+
+// SearchRepoTags returns the tag records whose tag name or digest contains the keyword.
+func SearchRepoTags(keyword string) ([]*models.RepoTag, error) {
+	sql := `select * from repository_tag where tag like ? escape '\\' or digest like ? escape '\\'
+		order by repo_name, tag`
+	pattern := "%" + escapeLike(keyword) + "%"
+	tags := []*models.RepoTag{}
+	_, err := GetOrmer().Raw(sql, pattern, pattern).QueryRows(&tags)
+	return tags, err
+}
@@ -151,6 +151,107 @@ func IncreasePullCount(name string) (err error) {
 	return err
 }
 
+// MoveRepository moves the metadata keyed by the repository name(pull count, daily statistics, labels,
+// remark and vulnerabilities) from the repository src to dst which belongs to project dstProject, the record
+// of src is removed. All the changes are made in one transaction.
+func MoveRepository(src, dst, dstProject string) (err error) {
+	o := orm.NewOrm()
+	if err = o.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if e := o.Rollback(); e != nil {
+				log.Errorf("failed to rollback the moving of repository %s to %s: %v", src, dst, e)
+			}
+			return
+		}
+		err = o.Commit()
+	}()
+
+	repo := models.RepoRecord{Name: src}
+	if err = o.Read(&repo, "Name"); err != nil {
+		return err
+	}
+
+	if !o.QueryTable("repository").Filter("name", dst).Exist() {
+		sql := `insert into repository (owner_id, project_id, manager, name, description, pull_count,
+			star_count, tag_count, latest_tag, ltag_ctime, author, creation_time, update_time)
+			select ?, project_id, manager, ?, ?, 0, ?, ?, ?, ?, ?, ?, NOW() from project where name = ?`
+		if _, err = o.Raw(sql, repo.OwnerID, dst, repo.Description, repo.StarCount, repo.TagCount,
+			repo.LatestTag, repo.LTagCTime, repo.Author, repo.CreationTime, dstProject).Exec(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = o.Raw(`update repository set pull_count = pull_count + ?, update_time = NOW() where name = ?`,
+		repo.PullCount, dst).Exec(); err != nil {
+		return err
+	}
+
+	if _, err = o.Raw(`update labelhook set repo_name = ? where repo_name = ?`, dst, src).Exec(); err != nil {
+		return err
+	}
+
+	if o.QueryTable("repo_remark").Filter("repo_name", src).Exist() {
+		if _, err = o.Raw(`delete from repo_remark where repo_name = ?`, dst).Exec(); err != nil {
+			return err
+		}
+		if _, err = o.Raw(`update repo_remark set repo_name = ? where repo_name = ?`, dst, src).Exec(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = o.Raw(`delete d from image_vulnerability d join image_vulnerability s on d.tag = s.tag
+		where d.repo_name = ? and s.repo_name = ?`, dst, src).Exec(); err != nil {
+		return err
+	}
+	if _, err = o.Raw(`update image_vulnerability set repo_name = ? where repo_name = ?`, dst, src).Exec(); err != nil {
+		return err
+	}
+
+	// the daily statistics of the same tag and day, e.g. the pushes of the move, are merged
+	if _, err = o.Raw(`update repository_daily_stat d join repository_daily_stat s on d.tag = s.tag and d.day = s.day
+		set d.pull_count = d.pull_count + s.pull_count, d.push_count = d.push_count + s.push_count
+		where d.repo_name = ? and s.repo_name = ?`, dst, src).Exec(); err != nil {
+		return err
+	}
+	if _, err = o.Raw(`delete s from repository_daily_stat s join repository_daily_stat d on d.tag = s.tag and d.day = s.day
+		where s.repo_name = ? and d.repo_name = ?`, src, dst).Exec(); err != nil {
+		return err
+	}
+	if _, err = o.Raw(`update repository_daily_stat set repo_name = ?,
+		project_id = (select project_id from project where name = ?) where repo_name = ?`,
+		dst, dstProject, src).Exec(); err != nil {
+		return err
+	}
+
+	var labels []models.Label
+	if _, err = o.Raw(`select * from label where repos_str like ?`, "%"+src+"%").QueryRows(&labels); err != nil {
+		return err
+	}
+	for _, label := range labels {
+		repos := strings.Split(label.ReposStr, ",")
+		for i, r := range repos {
+			if r == src {
+				repos[i] = dst
+			}
+		}
+		if _, err = o.Raw(`update label set repos_str = ? where label_id = ?`,
+			strings.Join(repos, ","), label.LabelID).Exec(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = o.Raw(`update repository d, repository s set d.label_names = s.label_names
+		where d.name = ? and s.name = ?`, dst, src).Exec(); err != nil {
+		return err
+	}
+
+	_, err = o.QueryTable("repository").Filter("name", src).Delete()
+	return err
+}
+
 //RepositoryExists returns whether the repository exists according to its name.
 func RepositoryExists(name string) bool {
 	o := GetOrmer()
@@ -163,14 +264,14 @@ func RepositoryIdExists(id int64) bool {
 	return o.QueryTable("repository").Filter("repository_id", id).Exist()
 }
 
-// GetRepositoryByIdV1 ...
+// GetRepositoryByIdV1 returns the repository of the id, nil is returned if it doesn't exist
 func GetRepositoryByIdV1(id int64) (*models.RepoRecordV1, error) {
 	sql := `select * from repository where repository_id = ?`
 
 	var repos []models.RepoRecordV1
 	_, err := GetOrmer().Raw(sql, id).QueryRows(&repos)
 
-	if len(repos) < 0 {
+	if len(repos) == 0 {
 		return nil, err
 	}
 
@@ -0,0 +1,90 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// SearchRepositoriesByDescription returns the repositories whose description contains the keyword.
+func SearchRepositoriesByDescription(keyword string) ([]*models.RepoRecord, error) {
+	sql := `select * from repository where description like ? escape '\\' order by name`
+	repos := []*models.RepoRecord{}
+	_, err := GetOrmer().Raw(sql, "%"+escapeLike(keyword)+"%").QueryRows(&repos)
+	return repos, err
+}
+
+// SearchRepoRemarks returns the remarks which contain the keyword.
+func SearchRepoRemarks(keyword string) ([]*models.RepoRemark, error) {
+	sql := `select * from repo_remark where deleted = 0 and remark like ? escape '\\' order by repo_name`
+	remarks := []*models.RepoRemark{}
+	_, err := GetOrmer().Raw(sql, "%"+escapeLike(keyword)+"%").QueryRows(&remarks)
+	return remarks, err
+}
+
+// SearchLabelHooks returns the label hooks whose label name contains the keyword,
+// the labels attached via repos_str of label are included too. A label attached to
+// a repository both ways is returned only once.
+func SearchLabelHooks(keyword string) ([]*models.LabelHook, error) {
+	o := GetOrmer()
+
+	sql := `select lh.labelhook_id, lh.label_id, lh.repo_name, l.name as label_name,
+			lh.creation_time, lh.update_time
+			from labelhook lh join label l on lh.label_id = l.label_id
+			where lh.deleted = 0 and l.deleted = 0 and l.name like ? escape '\\'`
+	hooks := []*models.LabelHook{}
+	if _, err := o.Raw(sql, "%"+escapeLike(keyword)+"%").QueryRows(&hooks); err != nil {
+		return nil, err
+	}
+
+	labelhooks := []*models.LabelHook{}
+	seen := make(map[string]bool)
+	add := func(hook *models.LabelHook) {
+		key := fmt.Sprintf("%d:%s", hook.LabelID, hook.RepoName)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		labelhooks = append(labelhooks, hook)
+	}
+	for _, hook := range hooks {
+		add(hook)
+	}
+
+	labels := []*models.Label{}
+	sql = `select * from label where deleted = 0 and name like ? escape '\\' and repos_str is not null and repos_str != ''`
+	if _, err := o.Raw(sql, "%"+escapeLike(keyword)+"%").QueryRows(&labels); err != nil {
+		return nil, err
+	}
+
+	for _, label := range labels {
+		for _, repo := range strings.Split(label.ReposStr, ",") {
+			if len(repo) == 0 {
+				continue
+			}
+			add(&models.LabelHook{
+				LabelID:   label.LabelID,
+				LabelName: label.Name,
+				RepoName:  repo,
+			})
+		}
+	}
+
+	return labelhooks, nil
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// AddUploadSession inserts an upload session and returns its ID.
+func AddUploadSession(session *models.UploadSession) (int64, error) {
+	now := time.Now()
+	session.CreationTime = now
+	session.UpdateTime = now
+	if len(session.Status) == 0 {
+		session.Status = models.UploadSessionUploading
+	}
+	return GetOrmer().Insert(session)
+}
+
+// GetUploadSession returns the upload session by its UUID, nil is returned if it does not exist.
+func GetUploadSession(uuid string) (*models.UploadSession, error) {
+	sessions := []*models.UploadSession{}
+	n, err := GetOrmer().QueryTable(&models.UploadSession{}).
+		Filter("UUID", uuid).
+		All(&sessions)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return sessions[0], nil
+}
+
+// UpdateUploadSessionOffset updates the offset of the upload session if it is still uploading.
+func UpdateUploadSessionOffset(uuid string, offset int64) error {
+	_, err := GetOrmer().QueryTable(&models.UploadSession{}).
+		Filter("UUID", uuid).
+		Filter("Status", models.UploadSessionUploading).
+		Update(map[string]interface{}{
+			"Offset":     offset,
+			"UpdateTime": time.Now(),
+		})
+	return err
+}
+
+// FinalizeUploadSession marks the upload session as finalized by the job, false is returned
+// if the session has been finalized by others.
+func FinalizeUploadSession(uuid string, jobID int64) (bool, error) {
+	n, err := GetOrmer().QueryTable(&models.UploadSession{}).
+		Filter("UUID", uuid).
+		Filter("Status", models.UploadSessionUploading).
+		Update(map[string]interface{}{
+			"Status":     models.UploadSessionFinalized,
+			"JobID":      jobID,
+			"UpdateTime": time.Now(),
+		})
+	return n > 0, err
+}
+
+// DeleteUploadSession deletes the upload session.
+func DeleteUploadSession(uuid string) error {
+	_, err := GetOrmer().QueryTable(&models.UploadSession{}).
+		Filter("UUID", uuid).
+		Delete()
+	return err
+}
+
+// GetStaleUploadSessions returns the sessions which are not updated since the time.
+func GetStaleUploadSessions(since time.Time) ([]*models.UploadSession, error) {
+	sessions := []*models.UploadSession{}
+	_, err := GetOrmer().QueryTable(&models.UploadSession{}).
+		Filter("Status", models.UploadSessionUploading).
+		Filter("UpdateTime__lt", since).
+		All(&sessions)
+	return sessions, err
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+)
+
+func TestUploadSession(t *testing.T) {
+	uuid := utils.GenerateRandomString()
+	if _, err := AddUploadSession(&models.UploadSession{
+		UUID:        uuid,
+		UserID:      1,
+		ProjectName: "library",
+		Size:        100,
+	}); err != nil {
+		t.Fatalf("failed to add upload session: %v", err)
+	}
+	defer func() {
+		if err := DeleteUploadSession(uuid); err != nil {
+			t.Fatalf("failed to delete upload session %s: %v", uuid, err)
+		}
+	}()
+
+	if err := UpdateUploadSessionOffset(uuid, 50); err != nil {
+		t.Fatalf("failed to update offset of upload session %s: %v", uuid, err)
+	}
+
+	session, err := GetUploadSession(uuid)
+	if err != nil {
+		t.Fatalf("failed to get upload session %s: %v", uuid, err)
+	}
+	if session == nil || session.Offset != 50 || session.Status != models.UploadSessionUploading {
+		t.Fatalf("unexpected upload session: %+v", session)
+	}
+
+	sessions, err := GetStaleUploadSessions(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to get stale upload sessions: %v", err)
+	}
+	found := false
+	for _, s := range sessions {
+		if s.UUID == uuid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("upload session %s should be stale", uuid)
+	}
+
+	finalized, err := FinalizeUploadSession(uuid, 1)
+	if err != nil || !finalized {
+		t.Fatalf("failed to finalize upload session %s: %v", uuid, err)
+	}
+	if finalized, err = FinalizeUploadSession(uuid, 2); err != nil || finalized {
+		t.Errorf("upload session %s should not be finalized twice: %v", uuid, err)
+	}
+
+	// the offset can not be updated after finalized
+	if err = UpdateUploadSessionOffset(uuid, 100); err != nil {
+		t.Fatalf("failed to update offset of upload session %s: %v", uuid, err)
+	}
+	if session, err = GetUploadSession(uuid); err != nil || session.Offset != 50 || session.JobID != 1 {
+		t.Errorf("unexpected upload session: %+v, error: %v", session, err)
+	}
+}
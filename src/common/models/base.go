@@ -29,5 +29,8 @@ func init() {
 		new(Job),
 		new(Role),
 		new(AccessLog),
-		new(RepoRecord))
+		new(RepoRecord),
+		new(RepoTag),
+		new(RepoDailyStat),
+		new(UploadSession))
 }
@@ -5,6 +5,7 @@ Copyright 2017 caicloud authors. All rights reserved.
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -12,6 +13,28 @@ import (
 type Job struct {
 	JobID        int64     `orm:"pk;column(job_id)" json:"jobId"`
 	Type         string    `orm:"column(type)" json:"type"`
+	Status       string    `orm:"column(status)" json:"status"`
+	Progress     int       `orm:"column(progress)" json:"progress"`
 	Message      string    `orm:"column(message)" json:"message"`
+	UserID       int       `orm:"column(user_id)" json:"userId"`
+	ProjectID    int64     `orm:"column(project_id)" json:"projectId"`
+	Result       string    `orm:"column(result)" json:"-"`
+	ErrorDetail  string    `orm:"column(error_detail)" json:"errorDetail,omitempty"`
+	StartTime    time.Time `orm:"column(start_time)" json:"startTime"`
+	EndTime      time.Time `orm:"column(end_time)" json:"endTime"`
 	CreationTime time.Time `orm:"column(creation_time)" json:"creationTime"`
+	UpdateTime   time.Time `orm:"column(update_time)" json:"updateTime"`
+
+	// ResultData is the structured result recorded in Result
+	ResultData json.RawMessage `orm:"-" json:"result,omitempty"`
+}
+
+// JobQuery holds the conditions to list jobs, the zero values are ignored.
+type JobQuery struct {
+	Type      string
+	Status    string
+	UserID    int
+	ProjectID int64
+	Page      int64
+	PageSize  int64
 }
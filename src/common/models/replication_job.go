@@ -16,10 +16,14 @@
 package models
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"time"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/cron"
 )
 
 const (
@@ -43,10 +47,60 @@ const (
 	RepOpTransfer string = "transfer"
 	//RepOpDelete represents the operation of a job to remove repository from a remote registry/harbor instance.
 	RepOpDelete string = "delete"
+	//JobTypeReplication is the type of the jobs which replicate repositories according to policies.
+	JobTypeReplication string = "replication"
+	//JobTypeVerification is the type of the jobs which verify the tags replicated by policies.
+	JobTypeVerification string = "verification"
+	//RepModePush represents the policy replicating the repositories of the local project to the target.
+	RepModePush string = "push"
+	//RepModePull represents the policy replicating the repositories on the target into the local project.
+	RepModePull string = "pull"
 	//UISecretCookie is the cookie name to contain the UI secret
 	UISecretCookie string = "uisecret"
 )
 
+const (
+	//TagResultRunning represents the tag which is being replicated.
+	TagResultRunning string = "running"
+	//TagResultTransferred represents the tag whose manifest has been pushed to the destination.
+	TagResultTransferred string = "transferred"
+	//TagResultSkipped represents the tag whose manifest exists on the destination already.
+	TagResultSkipped string = "skipped"
+	//TagResultNotFound represents the tag which is deleted from the source during the replication.
+	TagResultNotFound string = "not_found"
+	//TagResultFailed represents the tag which is being replicated when the job fails.
+	TagResultFailed string = "failed"
+	//TagResultStopped represents the tag which is being replicated when the job is stopped.
+	TagResultStopped string = "stopped"
+)
+
+const (
+	//RepDiffCreate represents the tag which doesn't exist on the destination.
+	RepDiffCreate string = "create"
+	//RepDiffUpdate represents the tag whose digest on the destination differs from the source.
+	RepDiffUpdate string = "update"
+	//RepDiffDelete represents the tag which exists on the destination but not on the source.
+	RepDiffDelete string = "delete"
+	//RepDiffSkip represents the tag which has the same digest on the source and the destination.
+	RepDiffSkip string = "skip"
+)
+
+const (
+	//TargetTypeHarbor represents the target which is a Harbor instance.
+	TargetTypeHarbor int = 0
+	//TargetTypeRegistry represents the target which is a plain docker registry v2, the projects
+	//are not created on it and the repositories are deleted via the registry API.
+	TargetTypeRegistry int = 1
+)
+
+const (
+	//TargetCredentialBasic represents the target which is accessed with the username and password.
+	TargetCredentialBasic string = "basic"
+	//TargetCredentialBearer represents the target which is accessed with a bearer token, the token
+	//is presented to the target directly rather than exchanged at its token service.
+	TargetCredentialBearer string = "bearer"
+)
+
 // RepPolicy is the model for a replication policy, which associate to a project and a target (destination)
 type RepPolicy struct {
 	ID          int64  `orm:"column(id)" json:"id"`
@@ -59,11 +113,18 @@ type RepPolicy struct {
 	Enabled       int       `orm:"column(enabled)" json:"enabled"`
 	Description   string    `orm:"column(description)" json:"description"`
 	CronStr       string    `orm:"column(cron_str)" json:"cron_str"`
+	Mode          string    `orm:"column(mode)" json:"mode"`
+	RepoFilter    string    `orm:"column(repo_filter)" json:"repo_filter"`
+	TagFilter     string    `orm:"column(tag_filter)" json:"tag_filter"`
 	StartTime     time.Time `orm:"column(start_time)" json:"start_time"`
+	LastRunTime   time.Time `orm:"column(last_run_time)" json:"last_run_time"`
+	NextRunTime   time.Time `orm:"column(next_run_time)" json:"next_run_time"`
 	CreationTime  time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
 	UpdateTime    time.Time `orm:"column(update_time);auto_now" json:"update_time"`
 	ErrorJobCount int       `json:"error_job_count"`
 	Deleted       int       `orm:"column(deleted)" json:"deleted"`
+	// Verification is the result of the last verification of the policy in json
+	Verification string `orm:"column(verification)" json:"-"`
 }
 
 // Valid ...
@@ -90,7 +151,42 @@ func (r *RepPolicy) Valid(v *validation.Validation) {
 
 	if len(r.CronStr) > 256 {
 		v.SetError("cron_str", "max length is 256")
+	} else if len(r.CronStr) > 0 {
+		if _, err := cron.Parse(r.CronStr); err != nil {
+			v.SetError("cron_str", err.Error())
+		}
 	}
+
+	if len(r.Mode) == 0 {
+		r.Mode = RepModePush
+	}
+
+	if r.Mode != RepModePush && r.Mode != RepModePull {
+		v.SetError("mode", "must be push or pull")
+	}
+
+	if len(r.RepoFilter) > 256 {
+		v.SetError("repo_filter", "max length is 256")
+	} else if err := utils.ValidatePatterns(r.RepoFilter); err != nil {
+		v.SetError("repo_filter", err.Error())
+	}
+
+	if len(r.TagFilter) > 256 {
+		v.SetError("tag_filter", "max length is 256")
+	} else if err := utils.ValidatePatterns(r.TagFilter); err != nil {
+		v.SetError("tag_filter", err.Error())
+	}
+}
+
+// RepPolicySchedule is the status of the schedule of a replication policy
+type RepPolicySchedule struct {
+	PolicyID    int64     `json:"policy_id"`
+	CronStr     string    `json:"cron_str"`
+	Enabled     int       `json:"enabled"`
+	LastRunTime time.Time `json:"last_run_time"`
+	NextRunTime time.Time `json:"next_run_time"`
+	// Running is true if the policy has pending, running or retrying jobs
+	Running bool `json:"running"`
 }
 
 // RepJob is the model for a replication job, which is the execution unit on job service, currently it is used to transfer/remove
@@ -103,21 +199,162 @@ type RepJob struct {
 	Operation  string   `orm:"column(operation)" json:"operation"`
 	Tags       string   `orm:"column(tags)" json:"-"`
 	TagList    []string `orm:"-" json:"tags"`
+	// Type is the type of the job registered in job service, Parameters is in json and is
+	// interpreted by the type
+	Type       string `orm:"column(job_type)" json:"job_type"`
+	Parameters string `orm:"column(parameters)" json:"parameters,omitempty"`
+	// Attempts is the count of times the job has been claimed by workers
+	Attempts int `orm:"column(attempts)" json:"attempts"`
+	// StartTime is the time the job is run for the first time, EndTime is the time the job reaches
+	// a final state, and the following are the statistics of the transfer in all of its attempts
+	StartTime        time.Time `orm:"column(start_time)" json:"start_time"`
+	EndTime          time.Time `orm:"column(end_time)" json:"end_time"`
+	BlobsTransferred int       `orm:"column(blobs_transferred)" json:"blobs_transferred"`
+	BlobsSkipped     int       `orm:"column(blobs_skipped)" json:"blobs_skipped"`
+	BytesTransferred int64     `orm:"column(bytes_transferred)" json:"bytes_transferred"`
+	Manifests        int       `orm:"column(manifests)" json:"manifests"`
+	TagResults       string    `orm:"column(tag_results)" json:"-"`
+	// TagResultMap is the outcome of each tag, the key is the tag and the value is one of
+	// the TagResult* constants
+	TagResultMap map[string]string `orm:"-" json:"tag_results,omitempty"`
+	// Blobs is in json, BlobList is the digests of the blobs counted in the statistics, they are
+	// restored when the job is retried so that a blob is not counted twice
+	Blobs    string   `orm:"column(blobs)" json:"-"`
+	BlobList []string `orm:"-" json:"-"`
+	// Uploads is in json, UploadMap is the locations of the upload sessions of the blobs being
+	// pushed, the key is the digest, so that the uploads are resumed when the job is retried
+	Uploads   string            `orm:"column(uploads)" json:"-"`
+	UploadMap map[string]string `orm:"-" json:"-"`
 	//	Policy       RepPolicy `orm:"-" json:"policy"`
 	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
 	UpdateTime   time.Time `orm:"column(update_time);auto_now" json:"update_time"`
 }
 
+// RepStats holds the statistics of the replication jobs of a policy or a target.
+type RepStats struct {
+	Jobs     int64 `json:"jobs"`
+	Finished int64 `json:"finished"`
+	Failed   int64 `json:"failed"`
+	Running  int64 `json:"running"`
+	// Duration is the sum in seconds of the time the ended jobs took
+	Duration         int64 `json:"duration"`
+	BlobsTransferred int64 `json:"blobs_transferred"`
+	BlobsSkipped     int64 `json:"blobs_skipped"`
+	BytesTransferred int64 `json:"bytes_transferred"`
+	Manifests        int64 `json:"manifests"`
+	// LastEndTime is the time the latest ended job reached its final state
+	LastEndTime *time.Time `json:"last_end_time,omitempty"`
+}
+
+// RepTagDiff is the difference of a tag between the source and the destination of a policy.
+type RepTagDiff struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Action     string `json:"action"`
+	SrcDigest  string `json:"src_digest,omitempty"`
+	DstDigest  string `json:"dst_digest,omitempty"`
+	// Size is the estimated bytes of the blobs of the tag to transfer, the blobs which exist on
+	// the destination or are counted by other tags are excluded
+	Size int64 `json:"size"`
+	// SrcRepository is the name of the repository on the target when pulling, Repository is
+	// the one in the local project
+	SrcRepository string `json:"src_repository,omitempty"`
+}
+
+// RepDryRun is the result of comparing the repositories selected by a policy with the destination.
+type RepDryRun struct {
+	PolicyID       int64         `json:"policy_id"`
+	Created        int           `json:"created"`
+	Updated        int           `json:"updated"`
+	Deleted        int           `json:"deleted"`
+	Skipped        int           `json:"skipped"`
+	EstimatedBytes int64         `json:"estimated_bytes"`
+	Tags           []*RepTagDiff `json:"tags"`
+	// Errors holds the reasons of the repositories which fail to be compared
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Add counts the differences of tags into the result.
+func (r *RepDryRun) Add(diffs ...*RepTagDiff) {
+	for _, d := range diffs {
+		switch d.Action {
+		case RepDiffCreate:
+			r.Created++
+		case RepDiffUpdate:
+			r.Updated++
+		case RepDiffDelete:
+			r.Deleted++
+		case RepDiffSkip:
+			r.Skipped++
+		}
+		r.EstimatedBytes += d.Size
+		r.Tags = append(r.Tags, d)
+	}
+}
+
+// RepVerification is the result of verifying that the tags selected by a policy have the same
+// digests on the destination.
+type RepVerification struct {
+	PolicyID int64 `json:"policy_id"`
+	// Status is running, finished or error
+	Status     string     `json:"status"`
+	Repair     bool       `json:"repair"`
+	StartTime  time.Time  `json:"start_time"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+	Verified   int        `json:"verified"`
+	Missing    int        `json:"missing"`
+	Mismatched int        `json:"mismatched"`
+	Extra      int        `json:"extra"`
+	// Tags are the ones missing, mismatched or extra on the destination
+	Tags []*RepTagDiff `json:"tags"`
+	// Errors holds the reasons of the repositories which fail to be verified
+	Errors map[string]string `json:"errors,omitempty"`
+	// RepairJobs is the count of the jobs created to repair the destination
+	RepairJobs int    `json:"repair_jobs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RepJobQueueStats holds the counts of replication jobs waiting in or being handled by the queue.
+type RepJobQueueStats struct {
+	Pending int64 `json:"pending"`
+	Running int64 `json:"running"`
+	// Retrying is the count of jobs waiting for retry, the ones whose next run time has come are counted in Ready
+	Retrying int64 `json:"retrying"`
+	// Ready is the count of jobs which can be claimed by workers now
+	Ready int64 `json:"ready"`
+	// Stale is the count of running jobs whose worker has stopped sending heartbeats
+	Stale int64 `json:"stale"`
+	// OldestPendingTime is the creation time of the earliest pending job
+	OldestPendingTime *time.Time `json:"oldest_pending_time,omitempty"`
+}
+
 // RepTarget is the model for a replication targe, i.e. destination, which wraps the endpoint URL and username/password of a remote registry.
 type RepTarget struct {
-	ID           int64     `orm:"column(id)" json:"id"`
-	URL          string    `orm:"column(url)" json:"endpoint"`
-	Name         string    `orm:"column(name)" json:"name"`
-	Username     string    `orm:"column(username)" json:"username"`
-	Password     string    `orm:"column(password)" json:"password"`
-	Type         int       `orm:"column(target_type)" json:"type"`
-	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime   time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	ID       int64  `orm:"column(id)" json:"id"`
+	URL      string `orm:"column(url)" json:"endpoint"`
+	Name     string `orm:"column(name)" json:"name"`
+	Username string `orm:"column(username)" json:"username"`
+	Password string `orm:"column(password)" json:"password"`
+	Type     int    `orm:"column(target_type)" json:"type"`
+	// CredentialType is basic or bearer, Token is used instead of the username and password
+	// for bearer, it is encrypted as the password
+	CredentialType string `orm:"column(credential_type)" json:"credential_type"`
+	Token          string `orm:"column(token)" json:"token"`
+	// Insecure skips the verification of the certificate of the target, CACert is the PEM
+	// encoded CA bundle the certificate is verified against instead of the system one
+	Insecure int    `orm:"column(insecure)" json:"insecure"`
+	CACert   string `orm:"column(ca_cert)" json:"ca_cert"`
+	// ClientCert and ClientKey are the PEM encoded certificate and key presented to the target
+	// for mutual TLS, the key is encrypted as the password
+	ClientCert string `orm:"column(client_cert)" json:"client_cert"`
+	ClientKey  string `orm:"column(client_key)" json:"client_key"`
+	// BandwidthLimit is the max rate in KB/s of the blob transfers to the target, 0 means unlimited
+	BandwidthLimit int `orm:"column(bandwidth_limit)" json:"bandwidth_limit"`
+	// TransferWindows are the daily time windows in which the replication jobs to the target
+	// can run, e.g. "22:00-06:00,12:00-13:00", empty means any time
+	TransferWindows string    `orm:"column(transfer_windows)" json:"transfer_windows"`
+	CreationTime    time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime      time.Time `orm:"column(update_time);auto_now" json:"update_time"`
 }
 
 // Valid ...
@@ -145,6 +382,50 @@ func (r *RepTarget) Valid(v *validation.Validation) {
 	if len(r.Password) > 48 {
 		v.SetError("password", "max length is 48")
 	}
+
+	if r.Type != TargetTypeHarbor && r.Type != TargetTypeRegistry {
+		v.SetError("type", "unsupported type")
+	}
+
+	if len(r.CredentialType) == 0 {
+		r.CredentialType = TargetCredentialBasic
+	}
+
+	if r.CredentialType != TargetCredentialBasic && r.CredentialType != TargetCredentialBearer {
+		v.SetError("credential_type", "unsupported credential type")
+	}
+
+	if r.CredentialType == TargetCredentialBearer && len(r.Token) == 0 {
+		v.SetError("token", "can not be empty for bearer credential")
+	}
+
+	if len(r.Token) > 2048 {
+		v.SetError("token", "max length is 2048")
+	}
+
+	if r.Insecure != 0 && r.Insecure != 1 {
+		v.SetError("insecure", "must be 0 or 1")
+	}
+
+	if len(r.CACert) != 0 && !x509.NewCertPool().AppendCertsFromPEM([]byte(r.CACert)) {
+		v.SetError("ca_cert", "no valid PEM encoded certificate found")
+	}
+
+	if len(r.ClientCert) != 0 || len(r.ClientKey) != 0 {
+		if _, err := tls.X509KeyPair([]byte(r.ClientCert), []byte(r.ClientKey)); err != nil {
+			v.SetError("client_cert", fmt.Sprintf("invalid client certificate or key: %v", err))
+		}
+	}
+
+	if r.BandwidthLimit < 0 {
+		v.SetError("bandwidth_limit", "can not be negative")
+	}
+
+	if len(r.TransferWindows) > 256 {
+		v.SetError("transfer_windows", "max length is 256")
+	} else if _, err := utils.ParseTimeWindows(r.TransferWindows); err != nil {
+		v.SetError("transfer_windows", err.Error())
+	}
 }
 
 //TableName is required by by beego orm to map RepTarget to table replication_target
@@ -0,0 +1,43 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+)
+
+// RepoDailyStat holds the count of pulls and pushes of a tag on one day
+type RepoDailyStat struct {
+	ID        int64     `orm:"pk;column(id)" json:"id"`
+	ProjectID int64     `orm:"column(project_id)" json:"project_id"`
+	RepoName  string    `orm:"column(repo_name)" json:"repo_name"`
+	Tag       string    `orm:"column(tag)" json:"tag"`
+	Day       time.Time `orm:"column(day);type(date)" json:"day"`
+	PullCount int64     `orm:"column(pull_count)" json:"pull_count"`
+	PushCount int64     `orm:"column(push_count)" json:"push_count"`
+}
+
+//TableName is required by by beego orm to map RepoDailyStat to table repository_daily_stat
+func (r *RepoDailyStat) TableName() string {
+	return "repository_daily_stat"
+}
+
+// UsagePoint is the aggregated count of pulls and pushes on one day
+type UsagePoint struct {
+	Day       string `orm:"column(day)" json:"day"`
+	PullCount int64  `orm:"column(pull_count)" json:"pull_count"`
+	PushCount int64  `orm:"column(push_count)" json:"push_count"`
+}
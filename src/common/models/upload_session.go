@@ -0,0 +1,49 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"time"
+)
+
+const (
+	// UploadSessionUploading : the chunks of the archive are being uploaded
+	UploadSessionUploading = "uploading"
+	// UploadSessionFinalized : the archive is uploaded and is being imported by a job
+	UploadSessionFinalized = "finalized"
+)
+
+// UploadSession holds the state of a resumable upload of an image archive, the chunks
+// uploaded are appended to a file on disk and Offset is the size of the file.
+type UploadSession struct {
+	ID           int64     `orm:"pk;column(id)" json:"-"`
+	UUID         string    `orm:"column(uuid)" json:"id"`
+	UserID       int       `orm:"column(user_id)" json:"-"`
+	ProjectName  string    `orm:"column(project_name)" json:"project"`
+	Repo         string    `orm:"column(repo)" json:"repo"`
+	Tag          string    `orm:"column(tag)" json:"tag"`
+	Size         int64     `orm:"column(size)" json:"size"`
+	Offset       int64     `orm:"column(offset)" json:"offset"`
+	Status       string    `orm:"column(status)" json:"status"`
+	JobID        int64     `orm:"column(job_id)" json:"jobId,omitempty"`
+	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime   time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+}
+
+// TableName is required by by beego orm to map UploadSession to table upload_session
+func (u *UploadSession) TableName() string {
+	return "upload_session"
+}
@@ -0,0 +1,341 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/utils/registry"
+)
+
+const (
+	ociLayoutFile  = "oci-layout"
+	ociImageLayout = `{"imageLayoutVersion":"1.0.0"}`
+	ociManifest    = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// Exporter exports images in registry as an archive which can be loaded by "docker load". The blobs
+// are stored in the layout of OCI image, so the archive is also an OCI image layout if OCI is set.
+type Exporter struct {
+	// NewClient returns the client of the repository which images are pulled from, it is required
+	NewClient func(repository string) (*registry.Repository, error)
+	// Registry is the host prefixed to the repositories recorded in the archive, it is optional
+	Registry string
+	// OCI determines whether the index.json of OCI image layout is written
+	OCI bool
+}
+
+// Export is an archive prepared by Exporter, the manifests and configs of the images are pulled
+// and the layers are pulled when the archive is written
+type Export struct {
+	exporter *Exporter
+	images   []*exportedImage
+	clients  map[string]*registry.Repository
+}
+
+type exportedImage struct {
+	images   []*Image
+	client   *registry.Repository
+	manifest []byte
+	config   []byte
+	parsed   *schema2.Manifest
+}
+
+// Prepare pulls the manifests and configs of the images, the errors are returned before anything
+// is written, so that they can still be reported to the client
+func (e *Exporter) Prepare(images []*Image) (*Export, error) {
+	if e.NewClient == nil {
+		return nil, fmt.Errorf("NewClient of exporter is required")
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no image to export")
+	}
+
+	export := &Export{
+		exporter: e,
+		clients:  map[string]*registry.Repository{},
+	}
+	// the images with the same manifest are exported once
+	exported := map[string]*exportedImage{}
+	for _, image := range images {
+		client, err := export.client(image.Repository)
+		if err != nil {
+			return nil, err
+		}
+
+		dgst, mediaType, payload, err := client.PullManifest(image.Tag,
+			[]string{schema2.MediaTypeManifest, ociManifest})
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull manifest of %s:%s: %v", image.Repository, image.Tag, err)
+		}
+		if mediaType != schema2.MediaTypeManifest && mediaType != ociManifest {
+			return nil, fmt.Errorf("manifest of %s:%s of media type %s is not supported", image.Repository, image.Tag, mediaType)
+		}
+
+		result := &Image{
+			Repository: image.Repository,
+			Tag:        image.Tag,
+			Digest:     dgst,
+		}
+		if e, ok := exported[dgst]; ok {
+			e.images = append(e.images, result)
+			continue
+		}
+
+		manifest := &schema2.Manifest{}
+		if err = json.Unmarshal(payload, manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest of %s:%s: %v", image.Repository, image.Tag, err)
+		}
+
+		config, err := pullConfig(client, manifest.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull config of %s:%s: %v", image.Repository, image.Tag, err)
+		}
+
+		e := &exportedImage{
+			images:   []*Image{result},
+			client:   client,
+			manifest: payload,
+			config:   config,
+			parsed:   manifest,
+		}
+		exported[dgst] = e
+		export.images = append(export.images, e)
+	}
+
+	return export, nil
+}
+
+// Images returns the images in the archive with the digests of their manifests
+func (x *Export) Images() []*Image {
+	images := []*Image{}
+	for _, image := range x.images {
+		images = append(images, image.images...)
+	}
+	return images
+}
+
+// WriteTo writes the archive to w, the layers are streamed from registry rather than
+// buffered in memory
+func (x *Export) WriteTo(w io.Writer) (int64, error) {
+	counter := &countWriter{w: w}
+	tw := tar.NewWriter(counter)
+
+	written := map[digest.Digest]bool{}
+	dockerManifests := []map[string]interface{}{}
+	ociManifests := []map[string]interface{}{}
+	for _, image := range x.images {
+		config, err := blobPath(image.parsed.Config.Digest)
+		if err != nil {
+			return counter.n, err
+		}
+		if !written[image.parsed.Config.Digest] {
+			if err = writeEntry(tw, config, image.config); err != nil {
+				return counter.n, err
+			}
+			written[image.parsed.Config.Digest] = true
+		}
+
+		layers := []string{}
+		for _, layer := range image.parsed.Layers {
+			path, err := blobPath(layer.Digest)
+			if err != nil {
+				return counter.n, err
+			}
+			layers = append(layers, path)
+
+			if written[layer.Digest] {
+				continue
+			}
+			if err = writeLayer(tw, image.client, path, layer); err != nil {
+				return counter.n, fmt.Errorf("failed to write layer %s: %v", layer.Digest, err)
+			}
+			written[layer.Digest] = true
+		}
+
+		repoTags := []string{}
+		for _, i := range image.images {
+			repoTags = append(repoTags, x.reference(i))
+		}
+		dockerManifests = append(dockerManifests, map[string]interface{}{
+			"Config":   config,
+			"RepoTags": repoTags,
+			"Layers":   layers,
+		})
+
+		if !x.exporter.OCI {
+			continue
+		}
+
+		dgst := digest.FromBytes(image.manifest)
+		path, err := blobPath(dgst)
+		if err != nil {
+			return counter.n, err
+		}
+		if err = writeEntry(tw, path, image.manifest); err != nil {
+			return counter.n, err
+		}
+
+		mediaType := image.parsed.MediaType
+		if len(mediaType) == 0 {
+			mediaType = ociManifest
+		}
+		for _, i := range image.images {
+			ociManifests = append(ociManifests, map[string]interface{}{
+				"mediaType": mediaType,
+				"digest":    dgst,
+				"size":      len(image.manifest),
+				"annotations": map[string]string{
+					containerdNameAnno:   x.reference(i),
+					ociRefNameAnnotation: i.Tag,
+				},
+			})
+		}
+	}
+
+	data, err := json.Marshal(dockerManifests)
+	if err != nil {
+		return counter.n, err
+	}
+	if err = writeEntry(tw, dockerManifestFile, data); err != nil {
+		return counter.n, err
+	}
+
+	if x.exporter.OCI {
+		data, err = json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests":     ociManifests,
+		})
+		if err != nil {
+			return counter.n, err
+		}
+		if err = writeEntry(tw, ociIndexFile, data); err != nil {
+			return counter.n, err
+		}
+		if err = writeEntry(tw, ociLayoutFile, []byte(ociImageLayout)); err != nil {
+			return counter.n, err
+		}
+	}
+
+	err = tw.Close()
+	return counter.n, err
+}
+
+func (x *Export) client(repository string) (*registry.Repository, error) {
+	if client, ok := x.clients[repository]; ok {
+		return client, nil
+	}
+	client, err := x.exporter.NewClient(repository)
+	if err != nil {
+		return nil, err
+	}
+	x.clients[repository] = client
+	return client, nil
+}
+
+func (x *Export) reference(image *Image) string {
+	reference := image.Repository + ":" + image.Tag
+	if len(x.exporter.Registry) > 0 {
+		reference = x.exporter.Registry + "/" + reference
+	}
+	return reference
+}
+
+func pullConfig(client *registry.Repository, descriptor distribution.Descriptor) ([]byte, error) {
+	_, data, err := client.PullBlob(descriptor.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	config, err := readVerified(data, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func readVerified(r io.Reader, descriptor distribution.Descriptor) ([]byte, error) {
+	verifier, err := digest.NewDigestVerifier(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(io.TeeReader(io.LimitReader(r, descriptor.Size+1), verifier))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != descriptor.Size || !verifier.Verified() {
+		return nil, fmt.Errorf("the content of blob %s does not match its descriptor", descriptor.Digest)
+	}
+	return data, nil
+}
+
+// writeLayer streams the layer from registry into the archive, the layer is kept compressed
+// as "docker load" decompresses the layers itself
+func writeLayer(tw *tar.Writer, client *registry.Repository, path string, layer distribution.Descriptor) error {
+	size, data, err := client.PullBlob(layer.Digest.String())
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	if size != layer.Size {
+		return fmt.Errorf("the size of blob %d does not match its descriptor %d", size, layer.Size)
+	}
+
+	verifier, err := digest.NewDigestVerifier(layer.Digest)
+	if err != nil {
+		return err
+	}
+
+	if err = tw.WriteHeader(newHeader(path, layer.Size)); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(tw, io.TeeReader(data, verifier), layer.Size); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("the content of blob does not match its digest")
+	}
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, path string, data []byte) error {
+	if err := tw.WriteHeader(newHeader(path, int64(len(data)))); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func newHeader(path string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:     path,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Unix(0, 0),
+		Typeflag: tar.TypeReg,
+	}
+}
@@ -0,0 +1,147 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	importer, fake, closeServer := newImporter(t)
+	defer closeServer()
+
+	manifest, _ := json.Marshal([]map[string]interface{}{
+		{
+			"Config":   "config1.json",
+			"RepoTags": []string{"library/app:1.0", "library/app:latest"},
+			"Layers":   []string{"base.tar", "app.tar"},
+		},
+		{
+			"Config":   "config2.json",
+			"RepoTags": []string{"library/base:1.0"},
+			"Layers":   []string{"base.tar"},
+		},
+	})
+	archive := buildArchive(t, []entry{
+		{name: "config1.json", data: []byte(`{"architecture":"amd64"}`)},
+		{name: "config2.json", data: []byte(`{"architecture":"arm64"}`)},
+		{name: "base.tar", data: []byte("base layer")},
+		{name: "app.tar", data: []byte("app layer")},
+		{name: "manifest.json", data: manifest},
+	})
+	imported, err := importer.Import(archive)
+	if err != nil {
+		t.Fatalf("failed to import archive: %v", err)
+	}
+
+	exporter := &Exporter{
+		NewClient: importer.NewClient,
+		Registry:  "registry.example.com",
+		OCI:       true,
+	}
+
+	if _, err = exporter.Prepare([]*Image{{Repository: "library/app", Tag: "unknown"}}); err == nil {
+		t.Errorf("an error is expected for unknown tag")
+	}
+
+	export, err := exporter.Prepare([]*Image{
+		{Repository: "library/app", Tag: "1.0"},
+		{Repository: "library/app", Tag: "latest"},
+		{Repository: "library/base", Tag: "1.0"},
+	})
+	if err != nil {
+		t.Fatalf("failed to prepare export: %v", err)
+	}
+
+	images := export.Images()
+	if len(images) != 3 {
+		t.Fatalf("unexpected count of exported images: %d != 3", len(images))
+	}
+	for i, image := range images {
+		if image.Digest != imported[i].Digest {
+			t.Errorf("unexpected digest of %s:%s: %s != %s", image.Repository, image.Tag, image.Digest, imported[i].Digest)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := export.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("unexpected count of bytes written: %d != %d", n, buf.Len())
+	}
+
+	entries := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		if _, ok := entries[hdr.Name]; ok {
+			t.Errorf("duplicated entry %s in archive", hdr.Name)
+		}
+		entries[hdr.Name], _ = ioutil.ReadAll(tr)
+	}
+
+	// 2 configs, 2 layers, 2 manifests, manifest.json, index.json and oci-layout
+	if len(entries) != 9 {
+		t.Errorf("unexpected count of entries: %d != 9", len(entries))
+	}
+
+	dockerManifests := []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}{}
+	if err = json.Unmarshal(entries[dockerManifestFile], &dockerManifests); err != nil {
+		t.Fatalf("failed to parse %s: %v", dockerManifestFile, err)
+	}
+	if len(dockerManifests) != 2 || len(dockerManifests[0].RepoTags) != 2 ||
+		dockerManifests[0].RepoTags[0] != "registry.example.com/library/app:1.0" {
+		t.Fatalf("unexpected %s: %s", dockerManifestFile, string(entries[dockerManifestFile]))
+	}
+	for _, m := range dockerManifests {
+		for _, path := range append(m.Layers, m.Config) {
+			if _, ok := entries[path]; !ok {
+				t.Errorf("%s referenced by %s is not found", path, dockerManifestFile)
+			}
+		}
+	}
+
+	// the exported archive can be imported again
+	for key := range fake.manifests {
+		delete(fake.manifests, key)
+	}
+	reimported, err := importer.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import the exported archive: %v", err)
+	}
+	for i, image := range reimported {
+		if image.Digest != imported[i].Digest {
+			t.Errorf("unexpected digest of reimported %s:%s: %s != %s", image.Repository, image.Tag, image.Digest, imported[i].Digest)
+		}
+	}
+}
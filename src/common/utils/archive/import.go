@@ -0,0 +1,672 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/utils/registry"
+)
+
+const (
+	dockerManifestFile = "manifest.json"
+	ociIndexFile       = "index.json"
+
+	ociImageIndex        = "application/vnd.oci.image.index.v1+json"
+	dockerManifestList   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	containerdNameAnno   = "io.containerd.image.name"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// ErrCanceled is returned by Import if it is canceled
+var ErrCanceled = errors.New("import canceled")
+
+// Image is an image imported into or exported from registry
+type Image struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// Importer imports the images in "docker save" or OCI layout archives into registry without
+// Docker daemon. The archive is extracted into a temporary directory as both formats need
+// random access to the content.
+type Importer struct {
+	// NewClient returns the client of the repository which images are pushed to, it is required
+	NewClient func(repository string) (*registry.Repository, error)
+	// Rename maps the repository and tag recorded in the archive to the ones the image is
+	// pushed to, the repository is empty if only the tag is recorded. It is optional.
+	Rename func(repository, tag string) (string, string, error)
+	// Progress is notified before each image is pushed, it is optional
+	Progress func(image *Image, current, total int)
+	// Canceled is checked before each image is pushed, the import stops with ErrCanceled
+	// if it returns true. It is optional.
+	Canceled func() bool
+	// TempDir is the directory where the archive is extracted, os.TempDir() is used if it is empty
+	TempDir string
+
+	dir     string
+	clients map[string]*registry.Repository
+	blobs   map[string]*blob
+}
+
+// blob is a file extracted from the archive which can be pushed to registry as is
+type blob struct {
+	descriptor distribution.Descriptor
+	path       string
+}
+
+type imageRef struct {
+	repository string
+	tag        string
+}
+
+type archivedImage struct {
+	refs   []imageRef
+	config *blob
+	layers []*blob
+}
+
+// Import extracts the archive read from r and pushes all the tagged images in it, the untagged ones
+// are ignored. The archive can be compressed by gzip.
+func (i *Importer) Import(r io.Reader) ([]*Image, error) {
+	if i.NewClient == nil {
+		return nil, fmt.Errorf("NewClient of importer is required")
+	}
+
+	dir, err := ioutil.TempDir(i.TempDir, "import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// resolve the symbolic links in the path of temporary directory, e.g. /tmp on macOS,
+	// as the paths extracted are checked against it
+	if i.dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+	i.clients = map[string]*registry.Repository{}
+	i.blobs = map[string]*blob{}
+
+	if err = extract(r, i.dir); err != nil {
+		return nil, fmt.Errorf("failed to extract archive: %v", err)
+	}
+
+	var images []*archivedImage
+	if _, err = os.Stat(filepath.Join(i.dir, dockerManifestFile)); err == nil {
+		images, err = i.loadDockerArchive()
+	} else if _, err = os.Stat(filepath.Join(i.dir, ociIndexFile)); err == nil {
+		images, err = i.loadOCILayout()
+	} else {
+		err = fmt.Errorf("neither %s nor %s is found, unsupported archive", dockerManifestFile, ociIndexFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// rename all the references before pushing anything so that conflicts are
+	// reported without leaving a partially imported archive
+	type target struct {
+		image *archivedImage
+		ref   imageRef
+	}
+	targets := []*target{}
+	renamed := map[imageRef]bool{}
+	for _, image := range images {
+		for _, ref := range image.refs {
+			if ref, err = i.rename(ref); err != nil {
+				return nil, err
+			}
+			if renamed[ref] {
+				return nil, fmt.Errorf("%s:%s is referenced by more than one image in archive", ref.repository, ref.tag)
+			}
+			renamed[ref] = true
+			targets = append(targets, &target{image: image, ref: ref})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no tagged image found in archive")
+	}
+
+	imported := []*Image{}
+	for _, t := range targets {
+		if i.Canceled != nil && i.Canceled() {
+			return imported, ErrCanceled
+		}
+		result, err := i.push(t.image, t.ref, len(imported)+1, len(targets))
+		if err != nil {
+			return imported, err
+		}
+		imported = append(imported, result)
+	}
+
+	return imported, nil
+}
+
+func (i *Importer) rename(ref imageRef) (imageRef, error) {
+	if i.Rename != nil {
+		repository, tag, err := i.Rename(ref.repository, ref.tag)
+		if err != nil {
+			return ref, err
+		}
+		ref = imageRef{repository: repository, tag: tag}
+	}
+	if len(ref.repository) == 0 {
+		return ref, fmt.Errorf("the repository of image with tag %s is unknown", ref.tag)
+	}
+	return ref, nil
+}
+
+// loadDockerArchive loads the images from the manifest.json generated by "docker save"
+func (i *Importer) loadDockerArchive() ([]*archivedImage, error) {
+	data, err := ioutil.ReadFile(filepath.Join(i.dir, dockerManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}{}
+	if err = json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", dockerManifestFile, err)
+	}
+
+	images := []*archivedImage{}
+	for _, m := range manifests {
+		image := &archivedImage{}
+		for _, repoTag := range m.RepoTags {
+			repository, tag, err := ParseReference(repoTag)
+			if err != nil {
+				return nil, err
+			}
+			image.refs = append(image.refs, imageRef{repository: repository, tag: tag})
+		}
+
+		if image.config, err = i.loadConfig(m.Config); err != nil {
+			return nil, err
+		}
+
+		for _, layer := range m.Layers {
+			b, err := i.loadLayer(layer, nil)
+			if err != nil {
+				return nil, err
+			}
+			image.layers = append(image.layers, b)
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// loadOCILayout loads the images referenced by the index.json of OCI image layout
+func (i *Importer) loadOCILayout() ([]*archivedImage, error) {
+	data, err := ioutil.ReadFile(filepath.Join(i.dir, ociIndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	index := struct {
+		Manifests []struct {
+			distribution.Descriptor
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}{}
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", ociIndexFile, err)
+	}
+
+	images := []*archivedImage{}
+	for _, m := range index.Manifests {
+		if m.MediaType == ociImageIndex || m.MediaType == dockerManifestList {
+			return nil, fmt.Errorf("image index %s is not supported", m.Digest)
+		}
+
+		image := &archivedImage{}
+		name := m.Annotations[containerdNameAnno]
+		if len(name) == 0 {
+			name = m.Annotations[ociRefNameAnnotation]
+		}
+		if strings.ContainsAny(name, "/:") {
+			repository, tag, err := ParseReference(name)
+			if err != nil {
+				return nil, err
+			}
+			image.refs = append(image.refs, imageRef{repository: repository, tag: tag})
+		} else if len(name) > 0 {
+			image.refs = append(image.refs, imageRef{tag: name})
+		}
+
+		path, err := blobPath(m.Digest)
+		if err != nil {
+			return nil, err
+		}
+		data, err := i.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest := struct {
+			Config distribution.Descriptor   `json:"config"`
+			Layers []distribution.Descriptor `json:"layers"`
+		}{}
+		if err = json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s: %v", m.Digest, err)
+		}
+
+		if path, err = blobPath(manifest.Config.Digest); err != nil {
+			return nil, err
+		}
+		if image.config, err = i.loadConfig(path); err != nil {
+			return nil, err
+		}
+
+		for _, layer := range manifest.Layers {
+			if strings.Contains(layer.MediaType, "zstd") ||
+				strings.Contains(layer.MediaType, "nondistributable") ||
+				strings.Contains(layer.MediaType, "foreign") {
+				return nil, fmt.Errorf("layer %s of media type %s is not supported", layer.Digest, layer.MediaType)
+			}
+
+			if path, err = blobPath(layer.Digest); err != nil {
+				return nil, err
+			}
+			layer := layer
+			b, err := i.loadLayer(path, &layer)
+			if err != nil {
+				return nil, err
+			}
+			image.layers = append(image.layers, b)
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (i *Importer) loadConfig(path string) (*blob, error) {
+	data, err := i.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := i.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blob{
+		descriptor: distribution.Descriptor{
+			MediaType: schema2.MediaTypeConfig,
+			Size:      int64(len(data)),
+			Digest:    digest.FromBytes(data),
+		},
+		path: p,
+	}, nil
+}
+
+// loadLayer returns the layer as a gzip compressed blob, the uncompressed layer is compressed
+// into a new file. The declared descriptor is trusted if the layer is compressed already.
+func (i *Importer) loadLayer(path string, declared *distribution.Descriptor) (*blob, error) {
+	p, err := i.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, ok := i.blobs[p]; ok {
+		return b, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	compressed := isGzip(reader)
+
+	b := &blob{
+		descriptor: distribution.Descriptor{
+			MediaType: schema2.MediaTypeLayer,
+		},
+		path: p,
+	}
+
+	switch {
+	case compressed && declared != nil:
+		b.descriptor.Digest = declared.Digest
+		b.descriptor.Size = declared.Size
+	case compressed:
+		digester := digest.Canonical.New()
+		size, err := io.Copy(digester.Hash(), reader)
+		if err != nil {
+			return nil, err
+		}
+		b.descriptor.Digest = digester.Digest()
+		b.descriptor.Size = size
+	default:
+		if err = compress(reader, b); err != nil {
+			return nil, fmt.Errorf("failed to compress layer %s: %v", path, err)
+		}
+	}
+
+	i.blobs[p] = b
+	return b, nil
+}
+
+// compress compresses the content read from r into the file which has the same path as
+// the blob with suffix ".gz", the descriptor and path of the blob are updated
+func compress(r io.Reader, b *blob) error {
+	path := b.path + ".gz"
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	digester := digest.Canonical.New()
+	counter := &countWriter{}
+	gw := gzip.NewWriter(io.MultiWriter(f, digester.Hash(), counter))
+	if _, err = io.Copy(gw, r); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+
+	b.path = path
+	b.descriptor.Digest = digester.Digest()
+	b.descriptor.Size = counter.n
+	return nil
+}
+
+// push pushes the blobs of the image and then the schema2 manifest built from them
+func (i *Importer) push(image *archivedImage, ref imageRef, current, total int) (*Image, error) {
+	repository, tag := ref.repository, ref.tag
+	result := &Image{
+		Repository: repository,
+		Tag:        tag,
+	}
+	if i.Progress != nil {
+		i.Progress(result, current, total)
+	}
+
+	client, ok := i.clients[repository]
+	if !ok {
+		var err error
+		if client, err = i.NewClient(repository); err != nil {
+			return nil, err
+		}
+		i.clients[repository] = client
+	}
+
+	layers := []distribution.Descriptor{}
+	for _, b := range append(image.layers, image.config) {
+		if err := pushBlob(client, b); err != nil {
+			return nil, fmt.Errorf("failed to push blob %s to %s: %v", b.descriptor.Digest, repository, err)
+		}
+		if b != image.config {
+			layers = append(layers, b.descriptor)
+		}
+	}
+
+	manifest, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    image.config.descriptor,
+		Layers:    layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Digest, err = client.PushManifest(tag, schema2.MediaTypeManifest, payload); err != nil {
+		return nil, fmt.Errorf("failed to push manifest %s:%s: %v", repository, tag, err)
+	}
+
+	return result, nil
+}
+
+func pushBlob(client *registry.Repository, b *blob) error {
+	exist, err := client.BlobExist(b.descriptor.Digest.String())
+	if err != nil {
+		return err
+	}
+	if exist {
+		return nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return client.PushBlob(b.descriptor.Digest.String(), b.descriptor.Size, f)
+}
+
+// resolve returns the absolute path of the file in archive, the symbolic links are
+// followed and the result must be inside the directory the archive is extracted to
+func (i *Importer) resolve(path string) (string, error) {
+	p, err := filepath.EvalSymlinks(filepath.Join(i.dir, filepath.Clean("/"+path)))
+	if err != nil {
+		return "", err
+	}
+	if !within(i.dir, p) {
+		return "", fmt.Errorf("%s is outside of archive", path)
+	}
+	return p, nil
+}
+
+func (i *Importer) readFile(path string) ([]byte, error) {
+	p, err := i.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// extract extracts the tar archive, which may be compressed by gzip, into dir. Entries
+// which are not directories, regular files or links are ignored.
+func extract(r io.Reader, dir string) error {
+	reader := bufio.NewReader(r)
+	var rd io.Reader = reader
+	if isGzip(reader) {
+		gr, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		rd = gr
+	}
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the entry is resolved against the links extracted before it, so that a chain of
+		// links can't lead the entry out of dir
+		parent, err := resolvePath(dir, dir, filepath.Dir(hdr.Name), 0)
+		if err != nil {
+			return fmt.Errorf("invalid entry %s: %v", hdr.Name, err)
+		}
+		target := filepath.Join(parent, filepath.Base(hdr.Name))
+		if !within(dir, target) {
+			return fmt.Errorf("invalid entry %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if target, err = resolvePath(dir, parent, filepath.Base(hdr.Name), 0); err != nil {
+				return fmt.Errorf("invalid entry %s: %v", hdr.Name, err)
+			}
+			if err = os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if target, err = resolvePath(dir, parent, filepath.Base(hdr.Name), 0); err != nil {
+				return fmt.Errorf("invalid entry %s: %v", hdr.Name, err)
+			}
+			if err = writeFile(target, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("invalid link %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			if _, err = resolvePath(dir, parent, hdr.Linkname, 0); err != nil {
+				return fmt.Errorf("invalid link %s -> %s: %v", hdr.Name, hdr.Linkname, err)
+			}
+			if err = os.MkdirAll(parent, 0700); err != nil {
+				return err
+			}
+			if err = os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := resolvePath(dir, dir, hdr.Linkname, 0)
+			if err != nil {
+				return fmt.Errorf("invalid link %s -> %s: %v", hdr.Name, hdr.Linkname, err)
+			}
+			if err = os.MkdirAll(parent, 0700); err != nil {
+				return err
+			}
+			if err = os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resolvePath resolves the relative path from base the way the file system does: the links
+// met are followed and the components which don't exist yet are kept as they are. An error is
+// returned if the path leads out of dir at any point.
+func resolvePath(dir, base, path string, depth int) (string, error) {
+	if depth > 32 {
+		return "", errors.New("too many levels of links")
+	}
+
+	current := base
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			if !within(dir, current) {
+				return "", fmt.Errorf("%s is outside of archive", path)
+			}
+			continue
+		}
+
+		next := filepath.Join(current, part)
+		info, err := os.Lstat(next)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(next)
+			if err != nil {
+				return "", err
+			}
+			if filepath.IsAbs(link) {
+				return "", fmt.Errorf("%s links to absolute path %s", part, link)
+			}
+			if next, err = resolvePath(dir, current, link, depth+1); err != nil {
+				return "", err
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isGzip(r *bufio.Reader) bool {
+	magic, err := r.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+func blobPath(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	return filepath.Join("blobs", d.Algorithm().String(), d.Hex()), nil
+}
+
+// countWriter counts the bytes written, they are also written to w if it is not nil
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.w == nil {
+		c.n += int64(len(p))
+		return len(p), nil
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,416 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/test"
+)
+
+// fakeRegistry records the blobs and manifests pushed
+type fakeRegistry struct {
+	sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (f *fakeRegistry) handle(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == "HEAD" && strings.Contains(path, "/blobs/"):
+		if _, ok := f.blobs[path[strings.LastIndex(path, "/")+1:]]; ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == "GET" && strings.Contains(path, "/blobs/"):
+		data, ok := f.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case r.Method == "GET" && strings.Contains(path, "/manifests/"):
+		repository := strings.TrimPrefix(path[:strings.Index(path, "/manifests/")], "/v2/")
+		tag := path[strings.LastIndex(path, "/")+1:]
+		data, ok := f.manifests[repository+":"+tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", schema2.MediaTypeManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.Write(data)
+	case r.Method == "POST" && strings.HasSuffix(path, "/blobs/uploads/"):
+		w.Header().Set("Location", "http://"+r.Host+path+"uuid")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PUT" && strings.Contains(path, "/blobs/uploads/"):
+		data, _ := ioutil.ReadAll(r.Body)
+		dgst := r.URL.Query().Get("digest")
+		if digest.FromBytes(data).String() != dgst {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[dgst] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && strings.Contains(path, "/manifests/"):
+		data, _ := ioutil.ReadAll(r.Body)
+		repository := strings.TrimPrefix(path[:strings.Index(path, "/manifests/")], "/v2/")
+		tag := path[strings.LastIndex(path, "/")+1:]
+		f.manifests[repository+":"+tag] = data
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+type entry struct {
+	name     string
+	data     []byte
+	linkname string
+}
+
+func buildArchive(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name: e.name,
+			Mode: 0600,
+			Size: int64(len(e.data)),
+		}
+		if len(e.linkname) != 0 {
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.linkname
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			t.Fatalf("failed to write data: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	return buf
+}
+
+func newImporter(t *testing.T) (*Importer, *fakeRegistry, func()) {
+	fake := &fakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+	}
+	server := test.NewServer(&test.RequestHandlerMapping{
+		Pattern: "/v2/",
+		Handler: fake.handle,
+	})
+
+	importer := &Importer{
+		NewClient: func(repository string) (*registry.Repository, error) {
+			return registry.NewRepositoryWithModifiers(repository, server.URL, true)
+		},
+	}
+	return importer, fake, server.Close
+}
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		reference  string
+		repository string
+		tag        string
+		err        bool
+	}{
+		{"ubuntu", "ubuntu", "latest", false},
+		{"library/ubuntu:16.04", "library/ubuntu", "16.04", false},
+		{"registry.example.com:5000/library/ubuntu:16.04", "library/ubuntu", "16.04", false},
+		{"localhost:5000/ubuntu", "ubuntu", "latest", false},
+		{"localhost/library/ubuntu:1", "library/ubuntu", "1", false},
+		{"ubuntu@sha256:abc", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, c := range cases {
+		repository, tag, err := ParseReference(c.reference)
+		if c.err {
+			if err == nil {
+				t.Errorf("an error is expected for %s", c.reference)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to parse %s: %v", c.reference, err)
+			continue
+		}
+		if repository != c.repository || tag != c.tag {
+			t.Errorf("unexpected result of %s: %s:%s != %s:%s", c.reference, repository, tag, c.repository, c.tag)
+		}
+	}
+}
+
+func TestImportDockerArchive(t *testing.T) {
+	importer, fake, closeServer := newImporter(t)
+	defer closeServer()
+
+	layer := []byte("uncompressed layer content")
+	config := []byte(`{"architecture":"amd64"}`)
+	manifest, _ := json.Marshal([]map[string]interface{}{
+		{
+			"Config":   "config.json",
+			"RepoTags": []string{"registry.example.com:5000/library/app:1.0", "app:latest"},
+			"Layers":   []string{"layer1/layer.tar", "layer2/layer.tar"},
+		},
+	})
+
+	archive := buildArchive(t, []entry{
+		{name: "config.json", data: config},
+		{name: "layer1/layer.tar", data: layer},
+		{name: "layer2/layer.tar", linkname: "../layer1/layer.tar"},
+		{name: "manifest.json", data: manifest},
+	})
+
+	importer.Rename = func(repository, tag string) (string, string, error) {
+		_, rest := splitRepository(repository)
+		return "project/" + rest, tag, nil
+	}
+
+	images, err := importer.Import(archive)
+	if err != nil {
+		t.Fatalf("failed to import archive: %v", err)
+	}
+
+	if len(images) != 2 {
+		t.Fatalf("unexpected count of imported images: %d != 2", len(images))
+	}
+
+	for _, ref := range []string{"project/app:1.0", "project/app:latest"} {
+		data, ok := fake.manifests[ref]
+		if !ok {
+			t.Fatalf("manifest of %s is not pushed", ref)
+		}
+
+		m := &schema2.DeserializedManifest{}
+		if err = m.UnmarshalJSON(data); err != nil {
+			t.Fatalf("failed to parse manifest of %s: %v", ref, err)
+		}
+		if m.Config.Digest != digest.FromBytes(config) {
+			t.Errorf("unexpected config digest of %s: %s", ref, m.Config.Digest)
+		}
+		if len(m.Layers) != 2 || m.Layers[0].Digest != m.Layers[1].Digest {
+			t.Fatalf("unexpected layers of %s: %v", ref, m.Layers)
+		}
+
+		// the layer is pushed compressed
+		gr, err := gzip.NewReader(bytes.NewReader(fake.blobs[m.Layers[0].Digest.String()]))
+		if err != nil {
+			t.Fatalf("failed to read the pushed layer: %v", err)
+		}
+		content, _ := ioutil.ReadAll(gr)
+		if !bytes.Equal(content, layer) {
+			t.Errorf("unexpected content of layer: %s", string(content))
+		}
+	}
+}
+
+func TestImportConflictedReferences(t *testing.T) {
+	importer, fake, closeServer := newImporter(t)
+	defer closeServer()
+
+	manifest, _ := json.Marshal([]map[string]interface{}{
+		{
+			"Config":   "config.json",
+			"RepoTags": []string{"app:1.0", "app:2.0"},
+			"Layers":   []string{"layer.tar"},
+		},
+	})
+	archive := buildArchive(t, []entry{
+		{name: "config.json", data: []byte(`{}`)},
+		{name: "layer.tar", data: []byte("layer")},
+		{name: "manifest.json", data: manifest},
+	})
+
+	importer.Rename = func(repository, tag string) (string, string, error) {
+		return "project/app", "latest", nil
+	}
+	if _, err := importer.Import(archive); err == nil {
+		t.Fatalf("an error is expected as both tags are renamed to project/app:latest")
+	}
+	if len(fake.blobs) != 0 || len(fake.manifests) != 0 {
+		t.Errorf("nothing should be pushed if the references conflict")
+	}
+}
+
+func TestImportOCILayout(t *testing.T) {
+	importer, fake, closeServer := newImporter(t)
+	defer closeServer()
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte("compressed layer content"))
+	gw.Close()
+	layer := buf.Bytes()
+	config := []byte(`{"architecture":"arm64"}`)
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    digest.FromBytes(config),
+			"size":      len(config),
+		},
+		"layers": []map[string]interface{}{
+			{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+				"digest":    digest.FromBytes(layer),
+				"size":      len(layer),
+			},
+		},
+	})
+	index, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []map[string]interface{}{
+			{
+				"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+				"digest":      digest.FromBytes(manifest),
+				"size":        len(manifest),
+				"annotations": map[string]string{ociRefNameAnnotation: "2.0"},
+			},
+		},
+	})
+
+	archive := buildArchive(t, []entry{
+		{name: "oci-layout", data: []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{name: "index.json", data: index},
+		{name: "blobs/sha256/" + digest.FromBytes(manifest).Hex(), data: manifest},
+		{name: "blobs/sha256/" + digest.FromBytes(config).Hex(), data: config},
+		{name: "blobs/sha256/" + digest.FromBytes(layer).Hex(), data: layer},
+	})
+
+	// only the tag is recorded in the archive
+	if _, err := importer.Import(bytes.NewReader(archive.Bytes())); err == nil {
+		t.Fatalf("an error is expected as the repository is unknown")
+	}
+
+	importer.Rename = func(repository, tag string) (string, string, error) {
+		return "project/oci", tag, nil
+	}
+	images, err := importer.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import archive: %v", err)
+	}
+
+	if len(images) != 1 || images[0].Repository != "project/oci" || images[0].Tag != "2.0" {
+		t.Fatalf("unexpected imported images: %v", images)
+	}
+
+	if _, ok := fake.blobs[digest.FromBytes(layer).String()]; !ok {
+		t.Errorf("the compressed layer should be pushed as is")
+	}
+	if _, ok := fake.manifests["project/oci:2.0"]; !ok {
+		t.Errorf("manifest of project/oci:2.0 is not pushed")
+	}
+}
+
+func TestExtractInvalidEntry(t *testing.T) {
+	importer, _, closeServer := newImporter(t)
+	defer closeServer()
+
+	archive := buildArchive(t, []entry{
+		{name: "../escape", data: []byte("data")},
+	})
+	if _, err := importer.Import(archive); err == nil {
+		t.Errorf("an error is expected for entry outside of archive")
+	}
+
+	archive = buildArchive(t, []entry{
+		{name: "link", linkname: "../../etc/passwd"},
+	})
+	if _, err := importer.Import(archive); err == nil {
+		t.Errorf("an error is expected for link outside of archive")
+	}
+}
+
+func TestExtractChainedLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "extract-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "archive")
+	if err = os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	// "a/b" is "b" in fact as "a" links to the root, so it links out of the directory
+	archive := buildArchive(t, []entry{
+		{name: "a", linkname: "."},
+		{name: "a/b", linkname: ".."},
+		{name: "b/../../escape", data: []byte("data")},
+	})
+	if err = extract(archive, dir); err == nil {
+		t.Errorf("an error is expected for chained links outside of archive")
+	}
+	if _, err = os.Stat(filepath.Join(root, "escape")); !os.IsNotExist(err) {
+		t.Errorf("the file should not be written out of archive: %v", err)
+	}
+
+	// links pointing to the parent inside the archive are allowed, e.g. the layers shared
+	// by the images in the archive saved by docker
+	dir = filepath.Join(root, "valid")
+	if err = os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	archive = buildArchive(t, []entry{
+		{name: "l1/layer.tar", data: []byte("layer")},
+		{name: "l2/layer.tar", linkname: "../l1/layer.tar"},
+	})
+	if err = extract(archive, dir); err != nil {
+		t.Fatalf("failed to extract archive: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "l2", "layer.tar"))
+	if err != nil || string(data) != "layer" {
+		t.Errorf("unexpected content of the link: %s, error: %v", string(data), err)
+	}
+}
+
+func splitRepository(repository string) (string, string) {
+	i := strings.LastIndex(repository, "/")
+	if i < 0 {
+		return "", repository
+	}
+	return repository[:i], repository[i+1:]
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package archive
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultTag = "latest"
+
+// ParseReference parses an image reference like "registry.example.com:5000/library/ubuntu:16.04"
+// into repository "library/ubuntu" and tag "16.04", the registry part is dropped and the tag
+// defaults to "latest". References by digest are not supported.
+func ParseReference(reference string) (repository, tag string, err error) {
+	reference = strings.TrimSpace(reference)
+	if len(reference) == 0 {
+		return "", "", fmt.Errorf("empty reference")
+	}
+
+	if strings.ContainsRune(reference, '@') {
+		return "", "", fmt.Errorf("reference by digest is not supported: %s", reference)
+	}
+
+	repository = reference
+	tag = defaultTag
+	// the colon after the last slash separates the tag, the ones before
+	// it belong to the port of registry
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		repository = reference[:i]
+		tag = reference[i+1:]
+	}
+
+	if i := strings.Index(repository, "/"); i > 0 {
+		domain := repository[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			repository = repository[i+1:]
+		}
+	}
+
+	if len(repository) == 0 || len(tag) == 0 {
+		return "", "", fmt.Errorf("invalid reference: %s", reference)
+	}
+
+	return repository, tag, nil
+}
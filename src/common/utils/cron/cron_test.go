@@ -0,0 +1,89 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/5 * * * *",
+		"0 2 * * 1-5",
+		"30 4 1,15 * *",
+		"0 0 * jan,jul sun",
+		"0 0 * * 7",
+		"5/10 * * * *",
+		"@daily",
+	}
+	for _, spec := range valid {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("unexpected error while parsing %q: %v", spec, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every",
+	}
+	for _, spec := range invalid {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error while parsing %q", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2017, time.March, 15, 10, 20, 30, 0, time.UTC)
+	cases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2017, time.March, 16, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2017, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		// 2017-03-18 is a Saturday
+		{"0 0 * * sat", time.Date(2017, time.March, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		// either day of month or day of week matches
+		{"0 0 20 * mon", time.Date(2017, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", c.spec, err)
+		}
+		if next := s.Next(base); !next.Equal(c.expected) {
+			t.Errorf("unexpected next time of %q: %v != %v", c.spec, next, c.expected)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// the prefix of the patterns excluding the names they match
+	excludePrefix = "!"
+	// the prefix of the patterns which are regular expressions rather than globs
+	regexPrefix = "regex:"
+)
+
+// namePattern is a glob or regular expression pattern which includes or excludes the names it matches
+type namePattern struct {
+	exclude bool
+	glob    string
+	re      *regexp.Regexp
+}
+
+func (p *namePattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// parsePatterns parses the comma separated patterns, the empty ones are dropped. A pattern is a
+// glob, e.g. "dev/app-*", or a regular expression matching the whole name if it is prefixed with
+// "regex:", e.g. "regex:v[0-9]+". A pattern prefixed with "!" excludes the names it matches, e.g.
+// "!*-rc*" or "!regex:.*-rc[0-9]*". As commas separate the patterns, they can't be used in a pattern.
+func parsePatterns(patterns string) ([]*namePattern, error) {
+	var list []*namePattern
+	for _, s := range strings.Split(patterns, ",") {
+		s = strings.TrimSpace(s)
+		p := &namePattern{}
+		if strings.HasPrefix(s, excludePrefix) {
+			p.exclude = true
+			s = strings.TrimSpace(strings.TrimPrefix(s, excludePrefix))
+		}
+		if len(s) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(s, regexPrefix) {
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(s, regexPrefix) + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", s, err)
+			}
+			p.re = re
+		} else {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", s, err)
+			}
+			p.glob = s
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// matchPatterns returns whether the name matches any of the including patterns, or there is no
+// including pattern, and none of the excluding patterns
+func matchPatterns(list []*namePattern, name string) bool {
+	included, hasInclude := false, false
+	for _, p := range list {
+		if p.exclude {
+			if p.match(name) {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if !included {
+			included = p.match(name)
+		}
+	}
+	return included || !hasInclude
+}
+
+// ValidatePatterns checks the syntax of the comma separated patterns
+func ValidatePatterns(patterns string) error {
+	_, err := parsePatterns(patterns)
+	return err
+}
+
+// MatchPatterns returns whether the name is selected by the comma separated patterns, e.g.
+// "backend/*,!backend/tmp-*", it is always true if there is no pattern and always false if
+// the patterns are invalid
+func MatchPatterns(patterns, name string) bool {
+	list, err := parsePatterns(patterns)
+	if err != nil {
+		return false
+	}
+	return matchPatterns(list, name)
+}
+
+// FilterByPatterns returns the names which are selected by the comma separated patterns
+func FilterByPatterns(patterns string, names []string) []string {
+	list, err := parsePatterns(patterns)
+	if err != nil {
+		return nil
+	}
+	if len(list) == 0 {
+		return names
+	}
+	var matched []string
+	for _, name := range names {
+		if matchPatterns(list, name) {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
@@ -42,10 +42,15 @@ type AuthorizerStore struct {
 
 // NewAuthorizerStore ...
 func NewAuthorizerStore(endpoint string, insecure bool, authorizers ...Authorizer) (*AuthorizerStore, error) {
+	return NewAuthorizerStoreWithTransport(endpoint, registry.GetHTTPTransport(insecure), authorizers...)
+}
+
+// NewAuthorizerStoreWithTransport pings the endpoint through the transport to get the challenges
+func NewAuthorizerStoreWithTransport(endpoint string, transport *http.Transport, authorizers ...Authorizer) (*AuthorizerStore, error) {
 	endpoint = utils.FormatEndpoint(endpoint)
 
 	client := &http.Client{
-		Transport: registry.GetHTTPTransport(insecure),
+		Transport: transport,
 		Timeout:   30 * time.Second,
 	}
 
@@ -16,6 +16,7 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
 )
 
@@ -58,3 +59,32 @@ func NewCookieCredential(c *http.Cookie) Credential {
 func (c *cookieCredential) AddAuthorization(req *http.Request) {
 	req.AddCookie(c.cookie)
 }
+
+// Implements interface Credential and Authorizer
+type bearerTokenCredential struct {
+	token string
+}
+
+// NewBearerTokenCredential returns a credential which adds the token to the Authorization header
+// of the request. It is an Authorizer as well, the token is presented to the registry directly
+// rather than exchanged for a token at the token service.
+func NewBearerTokenCredential(token string) Credential {
+	return &bearerTokenCredential{
+		token: token,
+	}
+}
+
+func (b *bearerTokenCredential) AddAuthorization(req *http.Request) {
+	req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", b.token))
+}
+
+// Scheme returns the scheme that the credential can handle
+func (b *bearerTokenCredential) Scheme() string {
+	return "bearer"
+}
+
+// Authorize adds the token to the request
+func (b *bearerTokenCredential) Authorize(req *http.Request, params map[string]string) error {
+	b.AddAuthorization(req)
+	return nil
+}
@@ -65,3 +65,22 @@ func TestAddAuthorizationOfCookieCredential(t *testing.T) {
 		t.Errorf("unexpected value: %s != value", ck.Value)
 	}
 }
+
+func TestAddAuthorizationOfBearerTokenCredential(t *testing.T) {
+	cred := NewBearerTokenCredential("token")
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	cred.AddAuthorization(req)
+
+	if h := req.Header.Get("Authorization"); h != "Bearer token" {
+		t.Errorf("unexpected authorization header: %s != Bearer token", h)
+	}
+
+	authorizer := NewCredentialAuthorizer(cred, nil, "repository", "library/ubuntu", "pull")
+	if _, ok := authorizer.(*bearerTokenCredential); !ok {
+		t.Errorf("the bearer token credential should authorize the requests itself")
+	}
+}
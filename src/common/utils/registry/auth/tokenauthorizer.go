@@ -140,9 +140,17 @@ type standardTokenAuthorizer struct {
 // NewStandardTokenAuthorizer returns a standard token authorizer. The authorizer will request a token
 // from token server and add it to the origin request
 func NewStandardTokenAuthorizer(credential Credential, insecure bool, scopeType, scopeName string, scopeActions ...string) Authorizer {
+	return NewStandardTokenAuthorizerWithTransport(credential, registry.GetHTTPTransport(insecure),
+		scopeType, scopeName, scopeActions...)
+}
+
+// NewStandardTokenAuthorizerWithTransport returns a standard token authorizer which requests the
+// tokens from token server through the transport
+func NewStandardTokenAuthorizerWithTransport(credential Credential, transport *http.Transport,
+	scopeType, scopeName string, scopeActions ...string) Authorizer {
 	authorizer := &standardTokenAuthorizer{
 		client: &http.Client{
-			Transport: registry.GetHTTPTransport(insecure),
+			Transport: transport,
 			Timeout:   30 * time.Second,
 		},
 		credential: credential,
@@ -161,6 +169,17 @@ func NewStandardTokenAuthorizer(credential Credential, insecure bool, scopeType,
 	return authorizer
 }
 
+// NewCredentialAuthorizer returns the authorizer for the credential, a credential which is an
+// Authorizer itself, e.g. a bearer token, authorizes the requests directly, and the others are
+// exchanged for tokens by a standard token authorizer
+func NewCredentialAuthorizer(credential Credential, transport *http.Transport,
+	scopeType, scopeName string, scopeActions ...string) Authorizer {
+	if authorizer, ok := credential.(Authorizer); ok {
+		return authorizer
+	}
+	return NewStandardTokenAuthorizerWithTransport(credential, transport, scopeType, scopeName, scopeActions...)
+}
+
 func (s *standardTokenAuthorizer) generateToken(realm, service string, scopes []string) (token string, expiresIn int, issuedAt *time.Time, err error) {
 	realm = tokenURL(realm)
 
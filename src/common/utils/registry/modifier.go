@@ -23,3 +23,14 @@ import (
 type Modifier interface {
 	Modify(*http.Request) error
 }
+
+// UserAgentModifier sets the User-Agent header of the request
+type UserAgentModifier struct {
+	UserAgent string
+}
+
+// Modify adds user-agent header to the request
+func (u *UserAgentModifier) Modify(req *http.Request) error {
+	req.Header.Set(http.CanonicalHeaderKey("User-Agent"), u.UserAgent)
+	return nil
+}
@@ -14,12 +14,18 @@
 package registry
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	// "time"
 
 	"github.com/vmware/harbor/src/common/utils"
@@ -55,6 +61,83 @@ func GetHTTPTransport(insecure bool) *http.Transport {
 	return secureHTTPTransport
 }
 
+// NewHTTPTransport returns the transport to connect to a registry whose certificate is verified
+// against the PEM encoded CA bundle caCert rather than the system one, and which is presented
+// the client certificate clientCert with the key clientKey for mutual TLS. The shared transport
+// returned by GetHTTPTransport is used if neither the CA bundle nor the client certificate is set.
+func NewHTTPTransport(insecure bool, caCert, clientCert, clientKey string) (*http.Transport, error) {
+	if len(caCert) == 0 && len(clientCert) == 0 && len(clientKey) == 0 {
+		return GetHTTPTransport(insecure), nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if len(caCert) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, errors.New("no valid PEM encoded certificate found in the CA bundle")
+		}
+		config.RootCAs = pool
+	}
+	if len(clientCert) != 0 || len(clientKey) != 0 {
+		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate or key: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Transport{
+		TLSClientConfig: config,
+	}, nil
+}
+
+// targetTransports caches the transports of the targets which have their own TLS options, so that
+// the connections kept alive are reused rather than piling up in new transports. The key is the ID
+// of the target.
+var targetTransports = struct {
+	sync.Mutex
+	transports map[int64]*targetTransport
+}{transports: make(map[int64]*targetTransport)}
+
+type targetTransport struct {
+	options   string // hash of the TLS options the transport is created with
+	transport *http.Transport
+}
+
+// GetTargetHTTPTransport returns the transport created by NewHTTPTransport for the target, the
+// transport is cached until the TLS options of the target change, then the idle connections of
+// the old transport are closed.
+func GetTargetHTTPTransport(targetID int64, insecure bool, caCert, clientCert, clientKey string) (*http.Transport, error) {
+	if len(caCert) == 0 && len(clientCert) == 0 && len(clientKey) == 0 {
+		return GetHTTPTransport(insecure), nil
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%t\n%s\n%s\n%s", insecure, caCert, clientCert, clientKey)))
+	options := hex.EncodeToString(hash[:])
+
+	targetTransports.Lock()
+	defer targetTransports.Unlock()
+	cached, ok := targetTransports.transports[targetID]
+	if ok && cached.options == options {
+		return cached.transport, nil
+	}
+
+	transport, err := NewHTTPTransport(insecure, caCert, clientCert, clientKey)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cached.transport.CloseIdleConnections()
+	}
+	targetTransports.transports[targetID] = &targetTransport{
+		options:   options,
+		transport: transport,
+	}
+	return transport, nil
+}
+
 // NewRegistry returns an instance of registry
 func NewRegistry(endpoint string, client *http.Client) (*Registry, error) {
 	u, err := utils.ParseEndpoint(endpoint)
@@ -72,11 +155,14 @@ func NewRegistry(endpoint string, client *http.Client) (*Registry, error) {
 
 // NewRegistryWithModifiers returns an instance of Registry according to the modifiers
 func NewRegistryWithModifiers(endpoint string, insecure bool, modifiers ...Modifier) (*Registry, error) {
+	return NewRegistryWithTransport(endpoint, GetHTTPTransport(insecure), modifiers...)
+}
 
-	transport := NewTransport(GetHTTPTransport(insecure), modifiers...)
-
+// NewRegistryWithTransport returns an instance of Registry which sends the requests through
+// the transport after they are modified by the modifiers
+func NewRegistryWithTransport(endpoint string, transport *http.Transport, modifiers ...Modifier) (*Registry, error) {
 	return NewRegistry(endpoint, &http.Client{
-		Transport: transport,
+		Transport: NewTransport(transport, modifiers...),
 		// Timeout:   30 * time.Second,
 	})
 }
@@ -17,8 +17,10 @@ package registry
 
 import (
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"testing"
@@ -33,6 +35,86 @@ func TestNewRegistryWithModifiers(t *testing.T) {
 	}
 }
 
+func TestNewHTTPTransport(t *testing.T) {
+	transport, err := NewHTTPTransport(true, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	if transport != GetHTTPTransport(true) {
+		t.Errorf("the shared transport should be used if neither CA nor client certificate is set")
+	}
+
+	if _, err = NewHTTPTransport(false, "invalid", "", ""); err == nil {
+		t.Errorf("an error expected for invalid CA bundle")
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err = (&http.Client{Transport: GetHTTPTransport(false)}).Get(server.URL); err == nil {
+		t.Errorf("the certificate of the server should not be trusted by the system CA")
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.TLS.Certificates[0].Certificate[0],
+	})
+	transport, err = NewHTTPTransport(false, string(ca), "", "")
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to request the server with the CA bundle: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestGetTargetHTTPTransport(t *testing.T) {
+	transport, err := GetTargetHTTPTransport(1, false, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if transport != GetHTTPTransport(false) {
+		t.Errorf("the shared transport should be used if neither CA nor client certificate is set")
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.TLS.Certificates[0].Certificate[0],
+	}))
+
+	transport, err = GetTargetHTTPTransport(1, false, ca, "", "")
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	cached, err := GetTargetHTTPTransport(1, false, ca, "", "")
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if cached != transport {
+		t.Errorf("the transport of the target should be cached")
+	}
+
+	other, err := GetTargetHTTPTransport(2, false, ca, "", "")
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if other == transport {
+		t.Errorf("the transports of different targets should not be shared")
+	}
+
+	changed, err := GetTargetHTTPTransport(1, true, ca, "", "")
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if changed == transport {
+		t.Errorf("the transport should be replaced when the TLS options change")
+	}
+}
+
 func TestPing(t *testing.T) {
 	server := test.NewServer(
 		&test.RequestHandlerMapping{
@@ -61,10 +61,14 @@ func NewRepository(name, endpoint string, client *http.Client) (*Repository, err
 
 // NewRepositoryWithModifiers returns an instance of Repository according to the modifiers
 func NewRepositoryWithModifiers(name, endpoint string, insecure bool, modifiers ...Modifier) (*Repository, error) {
+	return NewRepositoryWithTransport(name, endpoint, GetHTTPTransport(insecure), modifiers...)
+}
 
-	transport := NewTransport(GetHTTPTransport(insecure), modifiers...)
+// NewRepositoryWithTransport returns an instance of Repository which sends the requests through
+// the transport after they are modified by the modifiers
+func NewRepositoryWithTransport(name, endpoint string, transport *http.Transport, modifiers ...Modifier) (*Repository, error) {
 	return NewRepository(name, endpoint, &http.Client{
-		Transport: transport,
+		Transport: NewTransport(transport, modifiers...),
 		Timeout:   30 * time.Second,
 	})
 }
@@ -347,6 +351,113 @@ func (r *Repository) PullBlob(digest string) (size int64, data io.ReadCloser, er
 	return
 }
 
+// PullBlobFrom pulls the content of the blob from the offset, size is the length of the data
+// returned. Client must close data if it is not nil.
+func (r *Repository) PullBlobFrom(digest string, offset int64) (size int64, data io.ReadCloser, err error) {
+	if offset == 0 {
+		return r.PullBlob(digest)
+	}
+
+	req, err := http.NewRequest("GET", buildBlobURL(r.Endpoint.String(), r.Name, digest), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Range"), fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		err = parseError(err)
+		return
+	}
+
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusOK {
+		size = resp.ContentLength
+		// the registry which doesn't support range requests returns the whole blob
+		if resp.StatusCode == http.StatusOK {
+			if _, err = io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return
+			}
+			size -= offset
+		}
+		data = resp.Body
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	err = &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+
+	return
+}
+
+// PullBlobChunk pulls at most length bytes of the blob from the offset, total is the size of the
+// whole blob. Pulling a large blob chunk by chunk keeps each request within the timeout of the
+// client even if the data is read slowly. Client must close data if it is not nil.
+func (r *Repository) PullBlobChunk(digest string, offset, length int64) (total int64, data io.ReadCloser, err error) {
+	req, err := http.NewRequest("GET", buildBlobURL(r.Endpoint.String(), r.Name, digest), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Range"), fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		err = parseError(err)
+		return
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes <first>-<last>/<total>
+		contentRange := resp.Header.Get(http.CanonicalHeaderKey("Content-Range"))
+		i := strings.LastIndex(contentRange, "/")
+		if i == -1 {
+			resp.Body.Close()
+			err = fmt.Errorf("invalid Content-Range: %s", contentRange)
+			return
+		}
+		if total, err = strconv.ParseInt(contentRange[i+1:], 10, 64); err != nil {
+			resp.Body.Close()
+			return
+		}
+	case http.StatusOK:
+		// the registry which doesn't support range requests returns the whole blob
+		total = resp.ContentLength
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return
+		}
+	default:
+		defer resp.Body.Close()
+		var b []byte
+		if b, err = ioutil.ReadAll(resp.Body); err != nil {
+			return
+		}
+		err = &registry_error.Error{
+			StatusCode: resp.StatusCode,
+			Detail:     string(b),
+		}
+		return
+	}
+
+	data = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.LimitReader(resp.Body, length),
+		Closer: resp.Body,
+	}
+	return
+}
+
 func (r *Repository) initiateBlobUpload(name string) (location, uploadUUID string, err error) {
 	req, err := http.NewRequest("POST", buildInitiateBlobUploadURL(r.Endpoint.String(), r.Name), nil)
 	req.Header.Set(http.CanonicalHeaderKey("Content-Length"), "0")
@@ -415,6 +526,139 @@ func (r *Repository) PushBlob(digest string, size int64, data io.Reader) error {
 	return r.monolithicBlobUpload(location, digest, size, data)
 }
 
+// InitiateBlobUpload starts an upload session for chunked upload and returns its location
+func (r *Repository) InitiateBlobUpload() (string, error) {
+	location, _, err := r.initiateBlobUpload(r.Name)
+	if err != nil {
+		return "", err
+	}
+	return r.absoluteURL(location), nil
+}
+
+// GetBlobUploadOffset returns the count of bytes the registry has received in the upload
+// session, the upload should be resumed from the offset
+func (r *Repository) GetBlobUploadOffset(location string) (int64, error) {
+	req, err := http.NewRequest("GET", r.absoluteURL(location), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return parseUploadRange(resp.Header.Get(http.CanonicalHeaderKey("Range")))
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+// PushBlobChunk uploads the chunk with the length to the upload session from the offset,
+// it returns the location for the next request of the upload session
+func (r *Repository) PushBlobChunk(location string, offset, length int64, chunk io.Reader) (string, error) {
+	req, err := http.NewRequest("PATCH", r.absoluteURL(location), chunk)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = length
+	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/octet-stream")
+	req.Header.Set(http.CanonicalHeaderKey("Content-Range"), fmt.Sprintf("%d-%d", offset, offset+length-1))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		if next := resp.Header.Get(http.CanonicalHeaderKey("Location")); len(next) != 0 {
+			return r.absoluteURL(next), nil
+		}
+		return location, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return "", &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+// CompleteBlobUpload completes the upload session whose chunks have all been uploaded
+func (r *Repository) CompleteBlobUpload(location, digest string) error {
+	return r.monolithicBlobUpload(r.absoluteURL(location), digest, 0, nil)
+}
+
+// MountBlob mounts the blob from the repository "from" in the same registry into this repository,
+// it returns false if the registry can not mount the blob, the blob needs to be pushed in that case
+func (r *Repository) MountBlob(digest, from string) (bool, error) {
+	req, err := http.NewRequest("POST", buildMountBlobURL(r.Endpoint.String(), r.Name, digest, from), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Length"), "0")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return true, nil
+	}
+
+	// the registry falls back to initiate an upload session if the blob can not be mounted,
+	// cancel it as the caller will push the blob by itself
+	if resp.StatusCode == http.StatusAccepted {
+		if location := resp.Header.Get(http.CanonicalHeaderKey("Location")); len(location) != 0 {
+			r.cancelBlobUpload(location)
+		}
+		return false, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	return false, &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+func (r *Repository) cancelBlobUpload(location string) {
+	req, err := http.NewRequest("DELETE", r.absoluteURL(location), nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
 // DeleteBlob ...
 func (r *Repository) DeleteBlob(digest string) error {
 	req, err := http.NewRequest("DELETE", buildBlobURL(r.Endpoint.String(), r.Name, digest), nil)
@@ -444,6 +688,32 @@ func (r *Repository) DeleteBlob(digest string) error {
 	}
 }
 
+// absoluteURL resolves the location returned by the registry, which may be relative
+func (r *Repository) absoluteURL(location string) string {
+	if !strings.HasPrefix(location, "http") {
+		location = r.Endpoint.String() + location
+	}
+	return location
+}
+
+// parseUploadRange parses the range header of an upload session, e.g. "0-1023", and returns
+// the count of bytes received
+func parseUploadRange(rng string) (int64, error) {
+	parts := strings.SplitN(rng, "-", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid range: %s", rng)
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range: %s", rng)
+	}
+	// the registry returns "0-0" for an empty upload session
+	if end == 0 {
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
 func buildPingURL(endpoint string) string {
 	return fmt.Sprintf("%s/v2/", endpoint)
 }
@@ -464,6 +734,10 @@ func buildInitiateBlobUploadURL(endpoint, repoName string) string {
 	return fmt.Sprintf("%s/v2/%s/blobs/uploads/", endpoint, repoName)
 }
 
+func buildMountBlobURL(endpoint, repoName, digest, from string) string {
+	return fmt.Sprintf("%s/v2/%s/blobs/uploads/?mount=%s&from=%s", endpoint, repoName, digest, from)
+}
+
 func buildMonolithicBlobUploadURL(location, digest string) string {
 	query := ""
 	if strings.ContainsRune(location, '?') {
@@ -184,6 +184,251 @@ func TestPushBlob(t *testing.T) {
 	}
 }
 
+func TestPullBlobFrom(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		if rng != "bytes=2-" {
+			t.Errorf("unexpected range: %s", rng)
+		}
+		w.Header().Add(http.CanonicalHeaderKey("Content-Length"), strconv.Itoa(len(blob)-2))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(blob[2:])
+	}
+
+	server := test.NewServer(&test.RequestHandlerMapping{
+		Method:  "GET",
+		Pattern: fmt.Sprintf("/v2/%s/blobs/%s", repository, digest),
+		Handler: handler,
+	})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	size, reader, err := client.PullBlobFrom(digest, 2)
+	if err != nil {
+		t.Fatalf("failed to pull blob: %v", err)
+	}
+	defer reader.Close()
+
+	if size != int64(len(blob)-2) {
+		t.Errorf("unexpected size of blob: %d != %d", size, len(blob)-2)
+	}
+
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read from reader: %v", err)
+	}
+
+	if !bytes.Equal(b, blob[2:]) {
+		t.Errorf("unexpected blob: %s != %s", string(b), string(blob[2:]))
+	}
+}
+
+func TestPullBlobChunk(t *testing.T) {
+	ranged := true
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !ranged {
+			w.Header().Add(http.CanonicalHeaderKey("Content-Length"), strconv.Itoa(len(blob)))
+			w.Write(blob)
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "bytes=1-2" {
+			t.Errorf("unexpected range: %s", rng)
+		}
+		w.Header().Add(http.CanonicalHeaderKey("Content-Range"), fmt.Sprintf("bytes 1-2/%d", len(blob)))
+		w.Header().Add(http.CanonicalHeaderKey("Content-Length"), "2")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(blob[1:3])
+	}
+
+	server := test.NewServer(&test.RequestHandlerMapping{
+		Method:  "GET",
+		Pattern: fmt.Sprintf("/v2/%s/blobs/%s", repository, digest),
+		Handler: handler,
+	})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	// the registry which doesn't support range requests returns the whole blob
+	for _, ranged = range []bool{true, false} {
+		total, reader, err := client.PullBlobChunk(digest, 1, 2)
+		if err != nil {
+			t.Fatalf("failed to pull blob: %v", err)
+		}
+
+		if total != int64(len(blob)) {
+			t.Errorf("unexpected size of blob: %d != %d", total, len(blob))
+		}
+
+		b, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("failed to read from reader: %v", err)
+		}
+
+		if !bytes.Equal(b, blob[1:3]) {
+			t.Errorf("unexpected chunk: %s != %s", string(b), string(blob[1:3]))
+		}
+	}
+}
+
+func TestChunkedBlobUpload(t *testing.T) {
+	received := []byte{}
+	completed := false
+	uploadPath := fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid)
+
+	initUploadHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(http.CanonicalHeaderKey("Location"), uploadPath)
+		w.Header().Add(http.CanonicalHeaderKey("Range"), "0-0")
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	uploadHandler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Add(http.CanonicalHeaderKey("Range"), fmt.Sprintf("0-%d", len(received)-1))
+			w.WriteHeader(http.StatusNoContent)
+		case "PATCH":
+			if r.Header.Get("Content-Range") != fmt.Sprintf("%d-%d", len(received), len(received)+int(r.ContentLength)-1) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			received = append(received, b...)
+			w.Header().Add(http.CanonicalHeaderKey("Location"), uploadPath)
+			w.WriteHeader(http.StatusAccepted)
+		case "PUT":
+			if r.URL.Query().Get("digest") != digest {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			completed = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	}
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Method:  "POST",
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/", repository),
+			Handler: initUploadHandler,
+		},
+		&test.RequestHandlerMapping{
+			Pattern: uploadPath,
+			Handler: uploadHandler,
+		})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	location, err := client.InitiateBlobUpload()
+	if err != nil {
+		t.Fatalf("failed to initiate blob upload: %v", err)
+	}
+	if location != server.URL+uploadPath {
+		t.Errorf("unexpected location: %s", location)
+	}
+
+	if location, err = client.PushBlobChunk(location, 0, 2, bytes.NewReader(blob[:2])); err != nil {
+		t.Fatalf("failed to push chunk: %v", err)
+	}
+
+	// the chunk does not start from the offset received by the registry
+	if _, err = client.PushBlobChunk(location, 0, 2, bytes.NewReader(blob[2:])); err == nil {
+		t.Errorf("pushing chunk from an unexpected offset should fail")
+	}
+
+	offset, err := client.GetBlobUploadOffset(location)
+	if err != nil {
+		t.Fatalf("failed to get offset of upload: %v", err)
+	}
+	if offset != 2 {
+		t.Fatalf("unexpected offset: %d != 2", offset)
+	}
+
+	if location, err = client.PushBlobChunk(location, offset, int64(len(blob))-offset, bytes.NewReader(blob[offset:])); err != nil {
+		t.Fatalf("failed to push chunk: %v", err)
+	}
+
+	if err = client.CompleteBlobUpload(location, digest); err != nil {
+		t.Fatalf("failed to complete blob upload: %v", err)
+	}
+
+	if !completed || !bytes.Equal(received, blob) {
+		t.Errorf("unexpected blob received: %s, completed: %v", string(received), completed)
+	}
+}
+
+func TestMountBlob(t *testing.T) {
+	from := "library/busybox"
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("mount") == digest && r.URL.Query().Get("from") == from {
+			w.Header().Add(http.CanonicalHeaderKey("Location"), fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		w.Header().Add(http.CanonicalHeaderKey("Location"), fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid))
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	canceled := false
+	cancelHandler := func(w http.ResponseWriter, r *http.Request) {
+		canceled = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Method:  "POST",
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/", repository),
+			Handler: handler,
+		},
+		&test.RequestHandlerMapping{
+			Method:  "DELETE",
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid),
+			Handler: cancelHandler,
+		})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	mounted, err := client.MountBlob(digest, from)
+	if err != nil {
+		t.Fatalf("failed to mount blob: %v", err)
+	}
+
+	if !mounted {
+		t.Errorf("blob should be mounted, but it is not")
+	}
+
+	mounted, err = client.MountBlob(digest, "library/unknown")
+	if err != nil {
+		t.Fatalf("failed to mount blob: %v", err)
+	}
+
+	if mounted {
+		t.Errorf("blob should not be mounted, but it is")
+	}
+
+	if !canceled {
+		t.Errorf("the upload session initiated by the registry should be canceled")
+	}
+}
+
 func TestDeleteBlob(t *testing.T) {
 	handler := test.Handler(&test.Response{
 		StatusCode: http.StatusAccepted,
@@ -0,0 +1,112 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily time window, Start and End are the minutes since midnight. The window
+// spans midnight if End is not after Start, e.g. 22:00-06:00.
+type TimeWindow struct {
+	Start int
+	End   int
+}
+
+// ParseTimeWindows parses the comma separated time windows, e.g. "22:00-06:00,12:00-13:00",
+// nil is returned if the string is empty
+func ParseTimeWindows(s string) ([]TimeWindow, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var windows []TimeWindow
+	for _, w := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(w), "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid time window: %s", w)
+		}
+		start, err := parseClock(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("empty time window: %s", w)
+		}
+		windows = append(windows, TimeWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// parseClock parses "HH:MM" to the minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains returns whether the minute of the day is in the window
+func (w TimeWindow) contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// InTimeWindows returns whether the time is in any of the windows, it is always true if there
+// is no window
+func InTimeWindows(windows []TimeWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextTimeWindowStart returns the earliest start of the windows after the time, the time
+// itself is returned if it is in any window or there is no window
+func NextTimeWindowStart(windows []TimeWindow, t time.Time) time.Time {
+	if InTimeWindows(windows, t) {
+		return t
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	var next time.Time
+	for _, w := range windows {
+		start := midnight.Add(time.Duration(w.Start) * time.Minute)
+		if !start.After(t) {
+			start = start.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/base64"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseEndpoint(t *testing.T) {
@@ -178,3 +179,83 @@ func TestParseLink(t *testing.T) {
 		t.Errorf("unexpected prev: %s != %s", links.Next(), next)
 	}
 }
+
+func TestTimeWindows(t *testing.T) {
+	invalid := []string{"22:00", "22:00-", "25:00-06:00", "10:00-10:00", "a-b"}
+	for _, s := range invalid {
+		if _, err := ParseTimeWindows(s); err == nil {
+			t.Errorf("expected error while parsing %q", s)
+		}
+	}
+
+	windows, err := ParseTimeWindows("")
+	if err != nil || windows != nil {
+		t.Fatalf("unexpected windows of empty string: %v, %v", windows, err)
+	}
+	now := time.Date(2017, time.March, 15, 10, 20, 0, 0, time.UTC)
+	if !InTimeWindows(windows, now) || !NextTimeWindowStart(windows, now).Equal(now) {
+		t.Errorf("any time should be allowed if there is no window")
+	}
+
+	windows, err = ParseTimeWindows("22:00-06:00, 12:00-13:00")
+	if err != nil {
+		t.Fatalf("failed to parse time windows: %v", err)
+	}
+
+	cases := []struct {
+		hour, minute int
+		in           bool
+		next         time.Time
+	}{
+		{23, 0, true, time.Date(2017, time.March, 15, 23, 0, 0, 0, time.UTC)},
+		{5, 59, true, time.Date(2017, time.March, 15, 5, 59, 0, 0, time.UTC)},
+		{6, 0, false, time.Date(2017, time.March, 15, 12, 0, 0, 0, time.UTC)},
+		{12, 30, true, time.Date(2017, time.March, 15, 12, 30, 0, 0, time.UTC)},
+		{13, 0, false, time.Date(2017, time.March, 15, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		tm := time.Date(2017, time.March, 15, c.hour, c.minute, 0, 0, time.UTC)
+		if in := InTimeWindows(windows, tm); in != c.in {
+			t.Errorf("unexpected result of %v: %v != %v", tm, in, c.in)
+		}
+		if next := NextTimeWindowStart(windows, tm); !next.Equal(c.next) {
+			t.Errorf("unexpected next window start of %v: %v != %v", tm, next, c.next)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	if err := ValidatePatterns("library/*, dev/[a-"); err == nil {
+		t.Errorf("expected error while validating invalid patterns")
+	}
+	if err := ValidatePatterns("regex:dev/(app"); err == nil {
+		t.Errorf("expected error while validating invalid regular expression")
+	}
+	if err := ValidatePatterns("library/*, dev/app-?, !regex:.*/a/.*"); err != nil {
+		t.Errorf("unexpected error while validating patterns: %v", err)
+	}
+
+	names := []string{"library/ubuntu", "library/nginx", "dev/app-1", "dev/tools", "library/a/b"}
+	cases := []struct {
+		patterns string
+		expected []string
+	}{
+		{"", names},
+		{" , ", names},
+		{"library/*", []string{"library/ubuntu", "library/nginx"}},
+		{"library/ubuntu, dev/app-*", []string{"library/ubuntu", "dev/app-1"}},
+		{"unknown/*", nil},
+		{"regex:library/[a-z]+", []string{"library/ubuntu", "library/nginx"}},
+		{"regex:app", nil},
+		{"!library/*", []string{"dev/app-1", "dev/tools", "library/a/b"}},
+		{"library/*, !library/nginx", []string{"library/ubuntu"}},
+		{"dev/*, !regex:.*-[0-9]+", []string{"dev/tools"}},
+		{"library/[a-", nil},
+	}
+	for _, c := range cases {
+		matched := FilterByPatterns(c.patterns, names)
+		if strings.Join(matched, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("unexpected names matched by %q: %v != %v", c.patterns, matched, c.expected)
+		}
+	}
+}
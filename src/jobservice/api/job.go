@@ -0,0 +1,120 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/job"
+)
+
+// JobAPI handles /api/jobs /api/jobs/:id /api/jobs/:id/stop
+type JobAPI struct {
+	api.BaseAPI
+}
+
+// JobReq holds informations of request for submitting a job
+type JobReq struct {
+	Type       string          `json:"type"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// Prepare ...
+func (ja *JobAPI) Prepare() {
+	authenticate(&ja.BaseAPI)
+}
+
+// Post puts a job of the registered type into the queue
+func (ja *JobAPI) Post() {
+	var data JobReq
+	ja.DecodeJSONReq(&data)
+	jobType := job.GetType(data.Type)
+	if jobType == nil {
+		ja.RenderError(http.StatusBadRequest, fmt.Sprintf("Unknown job type: %s", data.Type))
+		return
+	}
+	parameters := string(data.Parameters)
+	if err := jobType.Validate(parameters); err != nil {
+		ja.RenderError(http.StatusBadRequest, fmt.Sprintf("Invalid parameters: %v", err))
+		return
+	}
+
+	id, err := dao.AddRepJob(models.RepJob{
+		Type:       data.Type,
+		Parameters: parameters,
+	})
+	if err != nil {
+		log.Errorf("Failed to insert job record, error: %v", err)
+		ja.RenderError(http.StatusInternalServerError, "Failed to insert job record")
+		return
+	}
+	log.Debugf("Send job to scheduler, job id: %d, type: %s", id, data.Type)
+	job.Schedule(id)
+	ja.Redirect(http.StatusCreated, strconv.FormatInt(id, 10))
+}
+
+// Get returns the job
+func (ja *JobAPI) Get() {
+	j := ja.getJob()
+	ja.Data["json"] = j
+	ja.ServeJSON()
+}
+
+// Stop stops the job, the pending one is marked as stopped and the running one is stopped
+// by the worker handling it. The running job is marked as stopped as well, so that the worker
+// of another job service handling it stops the job when it finds the mark in the heartbeat.
+func (ja *JobAPI) Stop() {
+	j := ja.getJob()
+	switch j.Status {
+	case models.JobPending, models.JobRetrying, models.JobRunning:
+		if err := dao.UpdateRepJobStatus(j.ID, models.JobStopped); err != nil {
+			log.Errorf("Failed to update status of job %d, error: %v", j.ID, err)
+			ja.RenderError(http.StatusInternalServerError, "Failed to update status of job")
+			return
+		}
+		if j.Status == models.JobRunning {
+			job.WorkerPool.StopJobs([]int64{j.ID})
+		}
+	default:
+		ja.RenderError(http.StatusConflict, fmt.Sprintf("Job %d is %s", j.ID, j.Status))
+		return
+	}
+}
+
+func (ja *JobAPI) getJob() *models.RepJob {
+	idStr := ja.Ctx.Input.Param(":id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Errorf("Error parsing job id: %s, error: %v", idStr, err)
+		ja.CustomAbort(http.StatusBadRequest, "Invalid job id")
+	}
+	j, err := dao.GetRepJob(id)
+	if err != nil {
+		log.Errorf("Failed to get job %d, error: %v", id, err)
+		ja.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("Failed to get job, id: %d", id))
+	}
+	if j == nil {
+		ja.CustomAbort(http.StatusNotFound, fmt.Sprintf("Job not found, id: %d", id))
+	}
+	return j
+}
@@ -16,12 +16,11 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/vmware/harbor/src/common/api"
 	"github.com/vmware/harbor/src/common/dao"
@@ -33,6 +32,13 @@ import (
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
+const (
+	// the interval to read the log appended when following the log of a job
+	followLogInterval = 500 * time.Millisecond
+	// the status of the job is checked every followStatusTicks intervals
+	followStatusTicks = 10
+)
+
 // ReplicationJob handles /api/replicationJobs /api/replicationJobs/:id/log
 // /api/replicationJobs/actions
 type ReplicationJob struct {
@@ -49,22 +55,23 @@ type ReplicationReq struct {
 
 // Prepare ...
 func (rj *ReplicationJob) Prepare() {
-	rj.authenticate()
+	authenticate(&rj.BaseAPI)
 }
 
-func (rj *ReplicationJob) authenticate() {
-	cookie, err := rj.Ctx.Request.Cookie(models.UISecretCookie)
+// authenticate aborts the request if it doesn't carry the secret of UI
+func authenticate(a *api.BaseAPI) {
+	cookie, err := a.Ctx.Request.Cookie(models.UISecretCookie)
 	if err != nil && err != http.ErrNoCookie {
 		log.Errorf("failed to get cookie %s: %v", models.UISecretCookie, err)
-		rj.CustomAbort(http.StatusInternalServerError, "")
+		a.CustomAbort(http.StatusInternalServerError, "")
 	}
 
 	if err == http.ErrNoCookie {
-		rj.CustomAbort(http.StatusUnauthorized, "")
+		a.CustomAbort(http.StatusUnauthorized, "")
 	}
 
 	if cookie.Value != config.UISecret() {
-		rj.CustomAbort(http.StatusForbidden, "")
+		a.CustomAbort(http.StatusForbidden, "")
 	}
 }
 
@@ -85,9 +92,9 @@ func (rj *ReplicationJob) Post() {
 		return
 	}
 	if len(data.Repo) == 0 { // sync all repositories
-		repoList, err := getRepoList(p.ProjectID)
+		repoList, err := utils.ListPolicyRepositories(p)
 		if err != nil {
-			log.Errorf("Failed to get repository list, project id: %d, error: %v", p.ProjectID, err)
+			log.Errorf("Failed to get repository list of policy %d, error: %v", p.ID, err)
 			rj.RenderError(http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -101,13 +108,24 @@ func (rj *ReplicationJob) Post() {
 			}
 		}
 	} else { // sync a single repository
+		if !u.MatchPatterns(p.RepoFilter, data.Repo) {
+			log.Debugf("Repository %s doesn't match the filter of policy %d: %s, skip", data.Repo, p.ID, p.RepoFilter)
+			return
+		}
+		tags := data.TagList
+		if len(tags) != 0 {
+			if tags = u.FilterByPatterns(p.TagFilter, tags); len(tags) == 0 {
+				log.Debugf("None of the tags %v matches the filter of policy %d: %s, skip", data.TagList, p.ID, p.TagFilter)
+				return
+			}
+		}
 		var op string
 		if len(data.Operation) > 0 {
 			op = data.Operation
 		} else {
 			op = models.RepOpTransfer
 		}
-		err := rj.addJob(data.Repo, data.PolicyID, op, data.TagList...)
+		err := rj.addJob(data.Repo, data.PolicyID, op, tags...)
 		if err != nil {
 			log.Errorf("Failed to insert job record, error: %v", err)
 			rj.RenderError(http.StatusInternalServerError, err.Error())
@@ -162,6 +180,80 @@ func (rj *ReplicationJob) HandleAction() {
 	job.WorkerPool.StopJobs(jobIDList)
 }
 
+// GetQueue returns the counts of the jobs in the queue
+func (rj *ReplicationJob) GetQueue() {
+	stats, err := dao.GetRepJobQueueStats(time.Now().Add(-config.JobLeaseTimeout()))
+	if err != nil {
+		log.Errorf("Failed to get stats of job queue, error: %v", err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to get stats of job queue")
+		return
+	}
+	rj.Data["json"] = stats
+	rj.ServeJSON()
+}
+
+// DryRun compares the repositories and tags selected by the policy with the ones on the
+// destination and returns what the replication would do, no job is created.
+func (rj *ReplicationJob) DryRun() {
+	policyID, err := rj.GetInt64("policy_id")
+	if err != nil || policyID <= 0 {
+		rj.RenderError(http.StatusBadRequest, "Invalid policy id")
+		return
+	}
+	p, err := dao.GetRepPolicy(policyID)
+	if err != nil {
+		log.Errorf("Failed to get policy, error: %v", err)
+		rj.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to get policy, id: %d", policyID))
+		return
+	}
+	if p == nil {
+		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Policy not found, id: %d", policyID))
+		return
+	}
+	result, err := job.DiffPolicy(p)
+	if err != nil {
+		log.Errorf("Failed to compare policy %d, error: %v", p.ID, err)
+		rj.RenderError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rj.Data["json"] = result
+	rj.ServeJSON()
+}
+
+// RepVerifyReq holds informations of request for /api/jobs/replication/verify
+type RepVerifyReq struct {
+	PolicyID int64 `json:"policy_id"`
+	Repair   bool  `json:"repair"`
+}
+
+// Verify starts checking the tags selected by the policy against the destination in background,
+// the result is stored on the policy.
+func (rj *ReplicationJob) Verify() {
+	var data RepVerifyReq
+	rj.DecodeJSONReq(&data)
+	p, err := dao.GetRepPolicy(data.PolicyID)
+	if err != nil {
+		log.Errorf("Failed to get policy, error: %v", err)
+		rj.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to get policy, id: %d", data.PolicyID))
+		return
+	}
+	if p == nil {
+		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Policy not found, id: %d", data.PolicyID))
+		return
+	}
+	if err = job.VerifyPolicy(p, data.Repair); err != nil {
+		if err == job.ErrVerificationRunning {
+			rj.RenderError(http.StatusConflict, fmt.Sprintf("Policy %d is being verified", p.ID))
+			return
+		}
+		log.Errorf("Failed to verify policy %d, error: %v", p.ID, err)
+		rj.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to verify policy, id: %d", p.ID))
+		return
+	}
+	rj.Ctx.Output.SetStatus(http.StatusAccepted)
+}
+
 // GetLog gets logs of the job
 func (rj *ReplicationJob) GetLog() {
 	idStr := rj.Ctx.Input.Param(":id")
@@ -172,51 +264,165 @@ func (rj *ReplicationJob) GetLog() {
 		return
 	}
 	logFile := utils.GetJobLogPath(jid)
-	rj.Ctx.Output.Download(logFile)
-}
+	if follow, _ := rj.GetBool("follow", false); follow {
+		rj.followLog(jid, logFile)
+		return
+	}
 
-// calls the api from UI to get repo list
-func getRepoList(projectID int64) ([]string, error) {
-	repositories := []string{}
+	l, err := utils.OpenJobLog(jid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			rj.RenderError(http.StatusNotFound, fmt.Sprintf("Log of job %d not found", jid))
+			return
+		}
+		log.Errorf("Failed to open log of job %d, error: %v", jid, err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to open log of job")
+		return
+	}
+	defer l.Close()
 
-	client := &http.Client{}
-	uiURL := config.LocalUIURL()
-	next := "/api/repositories?project_id=" + strconv.Itoa(int(projectID))
-	for len(next) != 0 {
-		req, err := http.NewRequest("GET", uiURL+next, nil)
+	w := rj.Ctx.ResponseWriter
+	w.Header().Set("Content-Disposition", "attachment; filename="+l.Name)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// the last lines of the log are returned if the parameter "lines" is set, otherwise the
+	// log is served with the support of the header "Range"
+	if lines, err := rj.GetInt("lines", 0); err != nil || lines < 0 {
+		rj.RenderError(http.StatusBadRequest, "Invalid lines")
+		return
+	} else if lines > 0 {
+		b, err := utils.TailLines(l, lines)
 		if err != nil {
-			return repositories, err
+			log.Errorf("Failed to read log of job %d, error: %v", jid, err)
+			rj.RenderError(http.StatusInternalServerError, "Failed to read log of job")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if _, err = w.Write(b); err != nil {
+			log.Debugf("Failed to write log of job %d, error: %v", jid, err)
 		}
+		return
+	}
+	http.ServeContent(w, rj.Ctx.Request, l.Name, l.ModTime, l)
+}
 
-		req.AddCookie(&http.Cookie{Name: models.UISecretCookie, Value: config.UISecret()})
+// DeleteLog removes the log of the job, it is called when the job is deleted
+func (rj *ReplicationJob) DeleteLog() {
+	idStr := rj.Ctx.Input.Param(":id")
+	jid, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Errorf("Error parsing job id: %s, error: %v", idStr, err)
+		rj.RenderError(http.StatusBadRequest, "Invalid job id")
+		return
+	}
+	if err = utils.DeleteJobLog(jid); err != nil {
+		log.Errorf("Failed to delete log of job %d, error: %v", jid, err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to delete log of job")
+		return
+	}
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return repositories, err
-		}
-		defer resp.Body.Close()
+// followLog streams the log of the job and its state transitions as server-sent events until the
+// job reaches a final state or the client disconnects. The lines of the log are sent as "log"
+// events, the states as "state" events, and an "end" event with the final state closes the stream.
+func (rj *ReplicationJob) followLog(jid int64, logFile string) {
+	repJob, err := dao.GetRepJob(jid)
+	if err != nil {
+		log.Errorf("Failed to get job %d, error: %v", jid, err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+	if repJob == nil {
+		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Job %d not found", jid))
+		return
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			dump, _ := httputil.DumpResponse(resp, true)
-			log.Debugf("response: %q", dump)
-			return repositories, fmt.Errorf("Unexpected status code when getting repository list: %d", resp.StatusCode)
-		}
+	// subscribe before checking the status so that no transition is missed
+	states, unsubscribe := job.SubscribeStates(jid)
+	defer unsubscribe()
+
+	follower := utils.NewLogFollower(logFile)
+	defer follower.Close()
 
-		body, err := ioutil.ReadAll(resp.Body)
+	w := rj.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event, data string) bool {
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			log.Debugf("Failed to send event of job %d: %v", jid, err)
+			return false
+		}
+		return true
+	}
+	sendLog := func(final bool) bool {
+		lines, err := follower.ReadLines()
 		if err != nil {
-			return repositories, err
+			log.Errorf("Failed to read log of job %d: %v", jid, err)
+		}
+		if final {
+			if line := follower.Flush(); len(line) > 0 {
+				lines = append(lines, line)
+			}
 		}
+		for _, line := range lines {
+			if !send("log", line) {
+				return false
+			}
+		}
+		w.Flush()
+		return true
+	}
+
+	state := repJob.Status
+	if !send("state", state) {
+		return
+	}
 
-		var list []string
-		if err = json.Unmarshal(body, &list); err != nil {
-			return repositories, err
+	closed := w.CloseNotify()
+	ticker := time.NewTicker(followLogInterval)
+	defer ticker.Stop()
+	for ticks := 0; !job.IsFinalState(state); ticks++ {
+		select {
+		case <-closed:
+			return
+		case s := <-states:
+			if !sendLog(false) || !send("state", s) {
+				return
+			}
+			state = s
+			continue
+		case <-ticker.C:
 		}
 
-		repositories = append(repositories, list...)
+		if !sendLog(false) {
+			return
+		}
 
-		links := u.ParseLink(resp.Header.Get(http.CanonicalHeaderKey("link")))
-		next = links.Next()
+		// the transitions happened out of the state machine of this process, e.g. the job
+		// is canceled before being run, are found by checking the status periodically
+		if ticks%followStatusTicks != 0 {
+			continue
+		}
+		if repJob, err = dao.GetRepJob(jid); err != nil {
+			log.Errorf("Failed to get job %d, error: %v", jid, err)
+			continue
+		}
+		if repJob == nil {
+			// the job is deleted, its state will never become final
+			break
+		}
+		if repJob.Status != state {
+			state = repJob.Status
+			if !send("state", state) {
+				return
+			}
+		}
 	}
 
-	return repositories, nil
+	if sendLog(true) {
+		send("end", state)
+		w.Flush()
+	}
 }
@@ -0,0 +1,87 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/job"
+)
+
+// WorkerAPI handles /api/jobs/workers /api/jobs/workers/:id/stop
+type WorkerAPI struct {
+	api.BaseAPI
+}
+
+// WorkerPoolReq holds informations of request for resizing the worker pool
+type WorkerPoolReq struct {
+	Size int `json:"size"`
+}
+
+// Prepare ...
+func (wa *WorkerAPI) Prepare() {
+	authenticate(&wa.BaseAPI)
+}
+
+// List returns the status of the workers in the pool
+func (wa *WorkerAPI) List() {
+	wa.Data["json"] = job.WorkerPool.Status()
+	wa.ServeJSON()
+}
+
+// Resize changes the count of the workers in the pool
+func (wa *WorkerAPI) Resize() {
+	var data WorkerPoolReq
+	wa.DecodeJSONReq(&data)
+	if err := job.WorkerPool.Resize(data.Size); err != nil {
+		wa.RenderError(http.StatusBadRequest, err.Error())
+		return
+	}
+}
+
+// StopWorker stops the job being handled by the worker and replaces the worker with a new one
+func (wa *WorkerAPI) StopWorker() {
+	idStr := wa.Ctx.Input.Param(":id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Errorf("Error parsing worker id: %s, error: %v", idStr, err)
+		wa.RenderError(http.StatusBadRequest, "Invalid worker id")
+		return
+	}
+
+	jobID, err := job.WorkerPool.StopWorker(id)
+	switch err {
+	case nil:
+	case job.ErrWorkerNotFound:
+		wa.RenderError(http.StatusNotFound, fmt.Sprintf("Worker not found, id: %d", id))
+		return
+	case job.ErrWorkerIdle:
+		wa.RenderError(http.StatusConflict, fmt.Sprintf("Worker %d is idle", id))
+		return
+	default:
+		log.Errorf("Failed to stop worker %d, error: %v", id, err)
+		wa.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to stop worker, id: %d", id))
+		return
+	}
+
+	log.Infof("Job %d of worker %d is stopped", jobID, id)
+	wa.Data["json"] = map[string]int64{"job_id": jobID}
+	wa.ServeJSON()
+}
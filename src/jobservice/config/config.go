@@ -19,14 +19,36 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/astaxie/beego"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
-const defaultMaxWorkers int = 10
+const (
+	defaultMaxWorkers int = 10
+
+	defaultMaxJobAttempts    = 3
+	defaultRetryInterval     = 5 * time.Minute
+	defaultMaxRetryInterval  = time.Hour
+	defaultJobLeaseTimeout   = 5 * time.Minute
+	defaultQueuePollInterval = 10 * time.Second
+	defaultBlobChunkSize     = 10 * 1024 * 1024
+	defaultMaxParallelBlobs  = 3
+	defaultShutdownTimeout   = time.Minute
+)
 
 var maxJobWorkers int
+var maxJobAttempts int
+var retryInterval time.Duration
+var maxRetryInterval time.Duration
+var jobLeaseTimeout time.Duration
+var queuePollInterval time.Duration
+var blobChunkSize int64
+var maxParallelBlobs int
+var shutdownTimeout time.Duration
+var jobLogMaxAge time.Duration
+var jobLogMaxSize int64
 var localUIURL string
 var localRegURL string
 var logDir string
@@ -92,7 +114,24 @@ func init() {
 		panic("The length of secretkey has to be 16 characters!")
 	}
 
+	maxJobAttempts = parseIntEnv("MAX_JOB_ATTEMPTS", defaultMaxJobAttempts)
+	retryInterval = parseSecondsEnv("JOB_RETRY_INTERVAL", defaultRetryInterval)
+	maxRetryInterval = parseSecondsEnv("JOB_MAX_RETRY_INTERVAL", defaultMaxRetryInterval)
+	jobLeaseTimeout = parseSecondsEnv("JOB_LEASE_TIMEOUT", defaultJobLeaseTimeout)
+	queuePollInterval = parseSecondsEnv("JOB_QUEUE_POLL_INTERVAL", defaultQueuePollInterval)
+	blobChunkSize = int64(parseIntEnv("BLOB_CHUNK_SIZE", defaultBlobChunkSize))
+	maxParallelBlobs = parseIntEnv("MAX_PARALLEL_BLOBS", defaultMaxParallelBlobs)
+	shutdownTimeout = parseSecondsEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	// the logs of jobs are kept forever unless the retention is set
+	jobLogMaxAge = time.Duration(parseIntEnv("JOB_LOG_MAX_AGE_DAYS", 0)) * 24 * time.Hour
+	jobLogMaxSize = int64(parseIntEnv("JOB_LOG_MAX_SIZE_MB", 0)) * 1024 * 1024
+
 	log.Debugf("config: maxJobWorkers: %d", maxJobWorkers)
+	log.Debugf("config: maxJobAttempts: %d, retryInterval: %v, maxRetryInterval: %v, jobLeaseTimeout: %v",
+		maxJobAttempts, retryInterval, maxRetryInterval, jobLeaseTimeout)
+	log.Debugf("config: blobChunkSize: %d, maxParallelBlobs: %d", blobChunkSize, maxParallelBlobs)
+	log.Debugf("config: shutdownTimeout: %v", shutdownTimeout)
+	log.Debugf("config: jobLogMaxAge: %v, jobLogMaxSize: %d", jobLogMaxAge, jobLogMaxSize)
 	log.Debugf("config: localUIURL: %s", localUIURL)
 	log.Debugf("config: localRegURL: %s", localRegURL)
 	log.Debugf("config: verifyRemoteCert: %s", verifyRemoteCert)
@@ -134,3 +173,78 @@ func SecretKey() string {
 func VerifyRemoteCert() bool {
 	return verifyRemoteCert != "off"
 }
+
+// MaxJobAttempts returns the max times a job is run before it is marked as error
+func MaxJobAttempts() int {
+	return maxJobAttempts
+}
+
+// RetryInterval returns the interval before a job is retried for the first time, the interval
+// is doubled for each following retry and is capped by MaxRetryInterval
+func RetryInterval() time.Duration {
+	return retryInterval
+}
+
+// MaxRetryInterval returns the max interval before a job is retried
+func MaxRetryInterval() time.Duration {
+	return maxRetryInterval
+}
+
+// JobLeaseTimeout returns the duration after which a running job whose worker stops sending
+// heartbeats can be claimed by other workers
+func JobLeaseTimeout() time.Duration {
+	return jobLeaseTimeout
+}
+
+// QueuePollInterval returns the interval to check the queue in database for jobs when the
+// workers are idle
+func QueuePollInterval() time.Duration {
+	return queuePollInterval
+}
+
+// BlobChunkSize returns the size in bytes of the chunks when pushing blobs to the target
+func BlobChunkSize() int64 {
+	return blobChunkSize
+}
+
+// MaxParallelBlobs returns the max count of blobs transferred at the same time by one job
+func MaxParallelBlobs() int {
+	return maxParallelBlobs
+}
+
+// ShutdownTimeout returns the max duration to wait for the workers to put their jobs back to the
+// queue when the job service is shutting down
+func ShutdownTimeout() time.Duration {
+	return shutdownTimeout
+}
+
+// JobLogMaxAge returns the duration after which the logs of jobs are removed, 0 means no limit
+func JobLogMaxAge() time.Duration {
+	return jobLogMaxAge
+}
+
+// JobLogMaxSize returns the max total size in bytes of the logs of jobs, the oldest logs are
+// removed when the size is exceeded, 0 means no limit
+func JobLogMaxSize() int64 {
+	return jobLogMaxSize
+}
+
+// parseIntEnv returns the positive integer in the environment variable or the default value
+func parseIntEnv(key string, defaultValue int) int {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		log.Warningf("Invalid %s: %s, the default value: %d will be used", key, v, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+// parseSecondsEnv returns the duration in seconds in the environment variable or the default value
+func parseSecondsEnv(key string, defaultValue time.Duration) time.Duration {
+	seconds := parseIntEnv(key, int(defaultValue/time.Second))
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"sync"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// the buffered state transitions of each subscriber, the transitions are dropped rather than
+// blocking the state machine if the subscriber can not keep up
+const stateBufferSize = 64
+
+// stateBroker delivers the state transitions of the jobs to the subscribers
+type stateBroker struct {
+	sync.Mutex
+	subscribers map[int64]map[chan string]struct{}
+}
+
+var broker = &stateBroker{
+	subscribers: map[int64]map[chan string]struct{}{},
+}
+
+// SubscribeStates returns a channel receiving the states the job transits to and the function
+// to cancel the subscription, which must be called once the subscriber is done.
+func SubscribeStates(jobID int64) (<-chan string, func()) {
+	ch := make(chan string, stateBufferSize)
+
+	broker.Lock()
+	if _, ok := broker.subscribers[jobID]; !ok {
+		broker.subscribers[jobID] = map[chan string]struct{}{}
+	}
+	broker.subscribers[jobID][ch] = struct{}{}
+	broker.Unlock()
+
+	return ch, func() {
+		broker.Lock()
+		defer broker.Unlock()
+		delete(broker.subscribers[jobID], ch)
+		if len(broker.subscribers[jobID]) == 0 {
+			delete(broker.subscribers, jobID)
+		}
+	}
+}
+
+// publishState notifies the subscribers of the job that it transits to the state
+func publishState(jobID int64, state string) {
+	broker.Lock()
+	defer broker.Unlock()
+	for ch := range broker.subscribers[jobID] {
+		select {
+		case ch <- state:
+		default:
+		}
+	}
+}
+
+// IsFinalState returns whether the job in the state will not transit to other states any more,
+// the job in "retrying" state will be run again
+func IsFinalState(state string) bool {
+	switch state {
+	case models.JobFinished, models.JobError, models.JobStopped, models.JobCanceled:
+		return true
+	}
+	return false
+}
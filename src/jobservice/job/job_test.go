@@ -2,8 +2,160 @@ package job
 
 import (
 	"testing"
+
+	"github.com/vmware/harbor/src/common/models"
 )
 
 func TestMain(t *testing.T) {
 }
 
+func TestSubscribeStates(t *testing.T) {
+	states, cancel := SubscribeStates(1)
+
+	publishState(1, models.JobRunning)
+	publishState(2, models.JobRunning)
+	publishState(1, models.JobFinished)
+
+	for _, expected := range []string{models.JobRunning, models.JobFinished} {
+		if state := <-states; state != expected {
+			t.Errorf("unexpected state: %s != %s", state, expected)
+		}
+	}
+	select {
+	case state := <-states:
+		t.Errorf("unexpected state of other job: %s", state)
+	default:
+	}
+
+	cancel()
+	publishState(1, models.JobError)
+	select {
+	case state := <-states:
+		t.Errorf("unexpected state after the subscription is canceled: %s", state)
+	default:
+	}
+	if _, ok := broker.subscribers[1]; ok {
+		t.Errorf("the subscribers of job 1 should be removed")
+	}
+
+	if !IsFinalState(models.JobStopped) || IsFinalState(models.JobRetrying) {
+		t.Errorf("unexpected result of IsFinalState")
+	}
+}
+
+func TestResizeWorkerPool(t *testing.T) {
+	WorkerPool = &workerPool{
+		workerChan: make(chan *Worker, 10),
+	}
+	if err := WorkerPool.Resize(0); err == nil {
+		t.Errorf("expected error when resizing the pool to 0")
+	}
+	if err := WorkerPool.Resize(3); err != nil {
+		t.Fatalf("failed to resize the pool: %v", err)
+	}
+	if size := WorkerPool.Size(); size != 3 {
+		t.Fatalf("unexpected size of pool: %d != 3", size)
+	}
+
+	// the busy worker is retired after the idle ones
+	WorkerPool.workerList[2].setCurrentJob(1)
+	if err := WorkerPool.Resize(1); err != nil {
+		t.Fatalf("failed to resize the pool: %v", err)
+	}
+	if size := WorkerPool.Size(); size != 1 {
+		t.Errorf("unexpected size of pool: %d != 1", size)
+	}
+	for _, status := range WorkerPool.Status() {
+		if retiring := status.ID != 2; status.Retiring != retiring {
+			t.Errorf("unexpected retiring of worker %d: %t != %t", status.ID, status.Retiring, retiring)
+		}
+		if status.ID == 2 && status.JobID != 1 {
+			t.Errorf("unexpected job of worker 2: %d != 1", status.JobID)
+		}
+	}
+
+	if _, err := WorkerPool.StopWorker(10); err != ErrWorkerNotFound {
+		t.Errorf("unexpected error of stopping nonexistent worker: %v", err)
+	}
+	if _, err := WorkerPool.StopWorker(0); err != ErrWorkerIdle {
+		t.Errorf("unexpected error of stopping idle worker: %v", err)
+	}
+}
+
+type fakeType struct{}
+
+func (f fakeType) Validate(parameters string) error {
+	return nil
+}
+
+func (f fakeType) Init(sm *SM, job *models.RepJob) error {
+	return nil
+}
+
+func TestRegisterType(t *testing.T) {
+	if GetType(models.JobTypeReplication) == nil {
+		t.Errorf("the replication type should be registered")
+	}
+	if GetType("fake") != nil {
+		t.Errorf("unexpected type registered: fake")
+	}
+
+	RegisterType("fake", fakeType{})
+	if _, ok := GetType("fake").(fakeType); !ok {
+		t.Errorf("the fake type should be registered")
+	}
+	RegisterType(models.JobTypeReplication, fakeType{})
+	if _, ok := GetType(models.JobTypeReplication).(replicationType); !ok {
+		t.Errorf("the registered type should not be replaced")
+	}
+	if err := GetType(models.JobTypeReplication).Validate(""); err == nil {
+		t.Errorf("expected error when submitting a replication job")
+	}
+
+	verification := GetType(models.JobTypeVerification)
+	if verification == nil {
+		t.Fatalf("the verification type should be registered")
+	}
+	for _, parameters := range []string{"", "{}", `{"policy_id":0}`} {
+		if err := verification.Validate(parameters); err == nil {
+			t.Errorf("expected error when submitting a verification job with parameters: %s", parameters)
+		}
+	}
+	if err := verification.Validate(`{"policy_id":1,"repair":true}`); err != nil {
+		t.Errorf("failed to validate the parameters of verification job: %v", err)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	sm := &SM{}
+	sm.Init()
+	sm.JobID = 1
+
+	sm.Interrupt(2)
+	if d := sm.getDesiredState(); len(d) != 0 {
+		t.Errorf("unexpected desired state when interrupting other job: %s", d)
+	}
+	sm.Interrupt(1)
+	if d := sm.getDesiredState(); d != models.JobPending {
+		t.Errorf("unexpected desired state: %s != %s", d, models.JobPending)
+	}
+
+	sm.setDesiredState("")
+	sm.Stop(1)
+	sm.Interrupt(1)
+	if d := sm.getDesiredState(); d != models.JobStopped {
+		t.Errorf("the job being stopped should not be interrupted: %s", d)
+	}
+}
+
+func TestIsLocalWorker(t *testing.T) {
+	w := NewWorker(3)
+	if !isLocalWorker(w.name()) {
+		t.Errorf("%s should be a worker of this host", w.name())
+	}
+	for _, name := range []string{hostname, hostname + "-2", hostname + "-2-1-3", hostname + "-js-1-3", "a" + w.name()} {
+		if isLocalWorker(name) {
+			t.Errorf("%s should not be a worker of this host", name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// the interval to remove the logs of jobs out of the retention
+const logCleanInterval = time.Hour
+
+// CleanLogs removes the logs of jobs older than the max age or exceeding the max total size
+// periodically, it returns at once if no retention is set.
+func CleanLogs() {
+	maxAge, maxSize := config.JobLogMaxAge(), config.JobLogMaxSize()
+	if maxAge == 0 && maxSize == 0 {
+		log.Debug("No retention of job logs is set, the logs are kept")
+		return
+	}
+
+	ticker := time.NewTicker(logCleanInterval)
+	defer ticker.Stop()
+	for {
+		cleanLogs(maxAge, maxSize)
+		<-ticker.C
+	}
+}
+
+func cleanLogs(maxAge time.Duration, maxSize int64) {
+	jobs, err := dao.GetRepJobByStatus(models.JobPending, models.JobRetrying, models.JobRunning)
+	if err != nil {
+		log.Errorf("Failed to get unfinished jobs, the logs of jobs are not cleaned, error: %v", err)
+		return
+	}
+	unfinished := make(map[int64]bool, len(jobs))
+	for _, j := range jobs {
+		unfinished[j.ID] = true
+	}
+	// the logs modified within the lease timeout may belong to the running jobs
+	n, err := utils.CleanJobLogs(config.LogDir(), maxAge, maxSize, config.JobLeaseTimeout(), unfinished)
+	if err != nil {
+		log.Errorf("Failed to clean logs of jobs, error: %v", err)
+	} else if n > 0 {
+		log.Infof("%d logs of jobs are removed according to the retention", n)
+	}
+}
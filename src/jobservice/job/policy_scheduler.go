@@ -0,0 +1,113 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/cron"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// the interval to check whether the scheduled replication policies are due
+const policyScheduleInterval = 30 * time.Second
+
+// SchedulePolicies triggers the replication of all the repositories of the enabled policies
+// according to their cron expressions, it never returns.
+func SchedulePolicies() {
+	ticker := time.NewTicker(policyScheduleInterval)
+	defer ticker.Stop()
+	for {
+		policies, err := dao.GetScheduledRepPolicies()
+		if err != nil {
+			log.Errorf("Failed to get scheduled policies, error: %v", err)
+		}
+		now := time.Now()
+		for _, p := range policies {
+			if err := schedulePolicy(p, now); err != nil {
+				log.Errorf("Failed to schedule policy %d, error: %v", p.ID, err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// schedulePolicy computes the next run time of the policy and triggers the replication if it
+// is due. The run is skipped if the jobs of the previous run are still in progress.
+func schedulePolicy(p *models.RepPolicy, now time.Time) error {
+	schedule, err := cron.Parse(p.CronStr)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", p.CronStr, err)
+	}
+	next := schedule.Next(now)
+
+	if p.NextRunTime.IsZero() {
+		if next.IsZero() {
+			return nil
+		}
+		_, err := dao.UpdateRepPolicySchedule(p.ID, p.NextRunTime, time.Time{}, next)
+		return err
+	}
+
+	if now.Before(p.NextRunTime) {
+		return nil
+	}
+
+	running, err := dao.IsRepPolicyRunning(p.ID)
+	if err != nil {
+		return err
+	}
+
+	lastRunTime := now
+	if running {
+		log.Infof("The previous replication of policy %d is still in progress, the run at %v is skipped", p.ID, p.NextRunTime)
+		lastRunTime = time.Time{}
+	}
+
+	// the run is triggered by the job service which updates the schedule
+	updated, err := dao.UpdateRepPolicySchedule(p.ID, p.NextRunTime, lastRunTime, next)
+	if err != nil || !updated || running {
+		return err
+	}
+
+	return triggerPolicy(p)
+}
+
+// triggerPolicy creates the jobs to replicate all the repositories of the policy
+func triggerPolicy(p *models.RepPolicy) error {
+	repositories, err := utils.ListPolicyRepositories(p)
+	if err != nil {
+		return fmt.Errorf("failed to get repository list of policy %d: %v", p.ID, err)
+	}
+
+	log.Infof("Trigger scheduled replication of policy %d, repositories: %v", p.ID, repositories)
+	for _, repository := range repositories {
+		id, err := dao.AddRepJob(models.RepJob{
+			Repository: repository,
+			PolicyID:   p.ID,
+			Operation:  models.RepOpTransfer,
+		})
+		if err != nil {
+			return err
+		}
+		Schedule(id)
+	}
+	return nil
+}
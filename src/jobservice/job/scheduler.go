@@ -16,21 +16,89 @@
 package job
 
 import (
-	"github.com/vmware/harbor/src/common/utils/log"
+	"fmt"
+	"os"
+	"regexp"
 	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
 )
 
-var jobQueue = make(chan int64)
+// wakeup notifies the dispatcher that there may be new jobs in the queue, so that it does not
+// wait until the next poll
+var wakeup = make(chan struct{}, 1)
 
-// Schedule put a job id into job queue.
+// Schedule notifies the dispatcher that the job has been put into the queue in database.
 func Schedule(jobID int64) {
-	jobQueue <- jobID
+	log.Debugf("Job %d is put into queue", jobID)
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Reschedule is called by statemachine to retry a job held by the worker, the job is marked as retrying
+// and will be claimed again after a backoff interval, or marked as error if it reaches the max attempts.
+func Reschedule(jobID int64, worker string) error {
+	job, err := dao.GetRepJob(jobID)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return fmt.Errorf("The job doesn't exist in DB, job id: %d", jobID)
+	}
+
+	if job.Attempts >= config.MaxJobAttempts() {
+		log.Warningf("Job %d has been tried %d times, it will not be retried", jobID, job.Attempts)
+		if err = dao.UpdateRepJobStatusOfWorker(jobID, worker, models.JobError); err != nil {
+			return err
+		}
+		publishState(jobID, models.JobError)
+		return nil
+	}
+
+	interval := retryBackoff(job.Attempts)
+	log.Debugf("Job %d will be rescheduled in %v", jobID, interval)
+	return dao.RetryRepJob(jobID, worker, time.Now().Add(interval))
 }
 
-// Reschedule is called by statemachine to retry a job
-func Reschedule(jobID int64) {
-	log.Debugf("Job %d will be rescheduled in 5 minutes", jobID)
-	time.Sleep(5 * time.Minute)
-	log.Debugf("Rescheduling job %d", jobID)
-	Schedule(jobID)
+// retryBackoff returns the interval before the job which has been tried for the attempts is
+// retried, the interval is doubled for each attempt
+func retryBackoff(attempts int) time.Duration {
+	interval := config.RetryInterval()
+	for i := 1; i < attempts && interval < config.MaxRetryInterval(); i++ {
+		interval *= 2
+	}
+	if interval > config.MaxRetryInterval() {
+		interval = config.MaxRetryInterval()
+	}
+	return interval
 }
+
+// ResetRunningJobs resets the jobs held by the workers of this host to pending, it should be called
+// before the workers start
+func ResetRunningJobs() (int64, error) {
+	return dao.ResetRunningJobsOfWorkers(hostname+"-", isLocalWorker)
+}
+
+// isLocalWorker returns true if the worker is named by this host, see Worker.name, the workers of
+// the hosts whose names only begin with the hostname are excluded
+func isLocalWorker(worker string) bool {
+	return localWorkerPattern.MatchString(worker)
+}
+
+// hostname identifies the job service in the names of the workers
+var hostname = func() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Warningf("Failed to get hostname, error: %v", err)
+		return "jobservice"
+	}
+	return name
+}()
+
+// localWorkerPattern matches the names of the workers of this host: hostname-pid-id
+var localWorkerPattern = regexp.MustCompile(`^` + regexp.QuoteMeta(hostname) + `-\d+-\d+$`)
@@ -38,12 +38,14 @@ type StateHandler interface {
 type StatusUpdater struct {
 	JobID int64
 	State string
+	// Worker holding the job, the status is not updated if the job has been claimed by others
+	Worker string
 }
 
 // Enter updates the status of a job and returns "_continue" status to tell state machine to move on.
 // If the status is a final status it returns empty string and the state machine will be stopped.
 func (su StatusUpdater) Enter() (string, error) {
-	err := dao.UpdateRepJobStatus(su.JobID, su.State)
+	err := dao.UpdateRepJobStatusOfWorker(su.JobID, su.Worker, su.State)
 	if err != nil {
 		log.Warningf("Failed to update state of job: %d, state: %s, error: %v", su.JobID, su.State, err)
 	}
@@ -59,19 +61,48 @@ func (su StatusUpdater) Exit() error {
 	return nil
 }
 
+// Interrupter handles the "pending" state entered when the job service is shutting down or the
+// job is out of the transfer windows of the target, it puts the job back to the queue without
+// counting the attempt, so that the job is resumed from its checkpoint when it is claimed again.
+type Interrupter struct {
+	JobID  int64
+	Worker string
+	// TransferWindows of the target, the job is deferred to the start of the next window if it
+	// is out of the windows
+	TransferWindows string
+}
+
+// Enter ...
+func (ji Interrupter) Enter() (string, error) {
+	next := time.Now()
+	if start, ok := outOfTransferWindows(ji.TransferWindows); ok {
+		next = start
+	}
+	// the job left running is reset when the job service starts again
+	if err := dao.DeferRepJob(ji.JobID, ji.Worker, next); err != nil {
+		log.Errorf("Failed to put job %d back to the queue, error: %v", ji.JobID, err)
+	}
+	return "", nil
+}
+
+// Exit ...
+func (ji Interrupter) Exit() error {
+	return nil
+}
+
 // Retry handles a special "retrying" in which case it will update the status in DB and reschedule the job
 // via scheduler
 type Retry struct {
-	JobID int64
+	JobID  int64
+	Worker string
 }
 
 // Enter ...
 func (jr Retry) Enter() (string, error) {
-	err := dao.UpdateRepJobStatus(jr.JobID, models.JobRetrying)
+	err := Reschedule(jr.JobID, jr.Worker)
 	if err != nil {
-		log.Errorf("Failed to update state of job :%d to Retrying, error: %v", jr.JobID, err)
+		log.Errorf("Failed to reschedule job :%d, error: %v", jr.JobID, err)
 	}
-	go Reschedule(jr.JobID)
 	return "", err
 }
 
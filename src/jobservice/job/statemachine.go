@@ -17,15 +17,18 @@ package job
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/jobservice/config"
 	"github.com/vmware/harbor/src/jobservice/replication"
 	"github.com/vmware/harbor/src/jobservice/utils"
 	"github.com/vmware/harbor/src/common/models"
-	uti "github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
 )
 
 // RepJobParm wraps the parm of a job
@@ -33,12 +36,25 @@ type RepJobParm struct {
 	LocalRegURL    string
 	TargetURL      string
 	TargetUsername string
-	TargetPassword string
+	TargetType     int
 	Repository     string
 	Tags           []string
 	Enabled        int
 	Operation      string
 	Insecure       bool
+	// BandwidthLimit is the max rate in KB/s of the blob transfers to the target
+	BandwidthLimit  int
+	TransferWindows string
+	// Mode is push or pull, when pulling, Repository is the name on the target and
+	// LocalRepository is the one in the local project which it is pulled into
+	Mode            string
+	LocalRepository string
+	TagFilter       string
+	// TargetCredential and TargetTransport are used to connect to the target, they are built
+	// from the credential type, the decrypted secrets and the TLS options of the target, and
+	// replace the credential the handlers are initialized with
+	TargetCredential auth.Credential
+	TargetTransport  *http.Transport
 }
 
 // SM is the state machine to handle job, it handles one job at a time.
@@ -54,6 +70,20 @@ type SM struct {
 	Logger       *log.Logger
 	Parms        *RepJobParm
 	lock         *sync.Mutex
+	// startTime is the time the job is run for the first time, and metrics collects
+	// the statistics of the transfer of the job
+	startTime time.Time
+	metrics   *replication.Metrics
+	// stateTime is the time the current state is entered and attempts is the count of times
+	// the job has been claimed, they are reported by the worker pool
+	stateTime time.Time
+	attempts  int
+	// conns tracks the connections of the job, they are closed to abort the requests in flight
+	// when the worker is stopped
+	conns *utils.ConnTracker
+	// worker is the name of the worker the statemachine belongs to, the status of the job is
+	// updated only when the job is held by the worker
+	worker string
 }
 
 // EnterState transit the statemachine from the current state to the state in parameter.
@@ -84,9 +114,16 @@ func (sm *SM) EnterState(s string) (string, error) {
 	} else {
 		log.Debugf("Job id: %d, no handler found for state:%s, skip", sm.JobID, s)
 	}
+	sm.lock.Lock()
 	sm.PreviousState = sm.CurrentState
 	sm.CurrentState = s
+	sm.stateTime = time.Now()
+	sm.lock.Unlock()
 	log.Debugf("Job id: %d, transition succeeded, current state: %s", sm.JobID, s)
+	publishState(sm.JobID, s)
+	if sm.metrics != nil && sm.metrics.Checkpoint() {
+		sm.SaveMetrics()
+	}
 	return next, nil
 }
 
@@ -119,11 +156,37 @@ func (sm *SM) Start(s string) {
 		log.Debugf("Job id: %d, next state from handler: %s", sm.JobID, n)
 	}
 	if err != nil {
+		// the requests of the job are aborted when the worker is stopped
+		if sm.getDesiredState() == models.JobStopped {
+			log.Debugf("Job id: %d, the statemachine will enter stopped state, error: %v", sm.JobID, err)
+			sm.setDesiredState("")
+			sm.EnterState(models.JobStopped)
+			return
+		}
 		log.Warningf("Job id: %d, the statemachin will enter error state due to error: %v", sm.JobID, err)
 		sm.EnterState(models.JobError)
 	}
 }
 
+// SaveMetrics records the start time, the statistics of the transfer, and the end time if the
+// job has reached a final state.
+func (sm *SM) SaveMetrics() {
+	if sm.metrics == nil {
+		return
+	}
+	job := &models.RepJob{
+		ID:        sm.JobID,
+		StartTime: sm.startTime,
+	}
+	if IsFinalState(sm.CurrentState) {
+		job.EndTime = time.Now()
+	}
+	sm.metrics.Fill(job, sm.CurrentState)
+	if err := dao.UpdateRepJobMetrics(job); err != nil {
+		log.Errorf("Job id: %d, failed to update metrics, error: %v", sm.JobID, err)
+	}
+}
+
 // AddTransition add a transition to the transition table of state machine, the handler is the handler of target state "to"
 func (sm *SM) AddTransition(from string, to string, h StateHandler) {
 	_, ok := sm.Transitions[from]
@@ -158,6 +221,27 @@ func (sm *SM) Stop(id int64) {
 	}
 }
 
+// Interrupt sets the desired state as "pending" so that the job is put back to the queue when the next
+// transition happens, it is ignored if the job is being stopped.
+func (sm *SM) Interrupt(id int64) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if id == sm.JobID && len(sm.desiredState) == 0 {
+		sm.desiredState = models.JobPending
+		log.Debugf("Desired state of job %d is set to pending", id)
+	}
+}
+
+// closeConnections closes the connections of the job, the requests in flight are aborted. It is
+// ignored if the state machine has switched to other job.
+func (sm *SM) closeConnections(id int64) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if id == sm.JobID && sm.conns != nil {
+		sm.conns.Close()
+	}
+}
+
 func (sm *SM) getDesiredState() string {
 	sm.lock.Lock()
 	defer sm.lock.Unlock()
@@ -170,6 +254,14 @@ func (sm *SM) setDesiredState(s string) {
 	sm.desiredState = s
 }
 
+// status returns the job being handled, the current state, the time the state is entered and
+// the count of times the job has been claimed
+func (sm *SM) status() (int64, string, time.Time, int) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.JobID, sm.CurrentState, sm.stateTime, sm.attempts
+}
+
 // Init initialzie the state machine, it will be called once in the lifecycle of state machine.
 func (sm *SM) Init() {
 	sm.lock = &sync.Mutex{}
@@ -180,6 +272,7 @@ func (sm *SM) Init() {
 		models.JobStopped:  struct{}{},
 		models.JobCanceled: struct{}{},
 		models.JobRetrying: struct{}{},
+		models.JobPending:  struct{}{},
 	}
 }
 
@@ -189,6 +282,10 @@ func (sm *SM) Reset(jid int64) error {
 	sm.lock.Lock()
 	sm.JobID = jid
 	sm.desiredState = ""
+	sm.CurrentState = models.JobPending
+	sm.stateTime = time.Now()
+	sm.attempts = 0
+	sm.conns = utils.NewConnTracker()
 	sm.lock.Unlock()
 
 	sm.Logger = utils.NewLogger(sm.JobID)
@@ -200,6 +297,49 @@ func (sm *SM) Reset(jid int64) error {
 	if job == nil {
 		return fmt.Errorf("The job doesn't exist in DB, job id: %d", sm.JobID)
 	}
+	sm.lock.Lock()
+	sm.attempts = job.Attempts
+	sm.lock.Unlock()
+	sm.startTime = job.StartTime
+	if sm.startTime.IsZero() {
+		sm.startTime = time.Now()
+	}
+	sm.metrics = replication.NewMetrics(job)
+
+	jobType := GetType(job.Type)
+	if jobType == nil {
+		return fmt.Errorf("unsupported job type: %s", job.Type)
+	}
+	// the jobs of the types other than replication are always enabled
+	sm.Parms = &RepJobParm{
+		Enabled:   1,
+		Operation: job.Operation,
+	}
+
+	//init states handlers
+	sm.Handlers = make(map[string]StateHandler)
+	sm.Transitions = make(map[string]map[string]struct{})
+
+	sm.AddTransition(models.JobPending, models.JobRunning, StatusUpdater{sm.JobID, models.JobRunning, sm.worker})
+	sm.AddTransition(models.JobRetrying, models.JobRunning, StatusUpdater{sm.JobID, models.JobRunning, sm.worker})
+	sm.Handlers[models.JobError] = StatusUpdater{sm.JobID, models.JobError, sm.worker}
+	sm.Handlers[models.JobStopped] = StatusUpdater{sm.JobID, models.JobStopped, sm.worker}
+	sm.Handlers[models.JobRetrying] = Retry{sm.JobID, sm.worker}
+	sm.Handlers[models.JobPending] = Interrupter{JobID: sm.JobID, Worker: sm.worker}
+
+	return jobType.Init(sm, job)
+}
+
+// replicationType is the type of the jobs replicating repositories according to policies
+type replicationType struct{}
+
+// Validate rejects the jobs submitted directly, the replication jobs are created by policies
+func (r replicationType) Validate(parameters string) error {
+	return fmt.Errorf("the jobs of type %s are created by replication policies", models.JobTypeReplication)
+}
+
+// Init loads the policy and the target of the job and adds the states of the operation
+func (r replicationType) Init(sm *SM, job *models.RepJob) error {
 	policy, err := dao.GetRepPolicy(job.PolicyID)
 	if err != nil {
 		return fmt.Errorf("Failed to get policy, error: %v", err)
@@ -214,6 +354,8 @@ func (sm *SM) Reset(jid int64) error {
 		Enabled:     policy.Enabled,
 		Operation:   job.Operation,
 		Insecure:    !config.VerifyRemoteCert(),
+		Mode:        policy.Mode,
+		TagFilter:   policy.TagFilter,
 	}
 	if policy.Enabled == 0 {
 		//worker will cancel this job
@@ -228,35 +370,37 @@ func (sm *SM) Reset(jid int64) error {
 	}
 	sm.Parms.TargetURL = target.URL
 	sm.Parms.TargetUsername = target.Username
-	pwd := target.Password
+	sm.Parms.TargetType = target.Type
+	sm.Parms.BandwidthLimit = target.BandwidthLimit
+	sm.Parms.TransferWindows = target.TransferWindows
+	sm.Handlers[models.JobPending] = Interrupter{JobID: sm.JobID, Worker: sm.worker, TransferWindows: target.TransferWindows}
+
+	sm.Parms.TargetCredential, sm.Parms.TargetTransport, err = utils.TargetConnection(target)
+	if err != nil {
+		return err
+	}
+	sm.Parms.TargetTransport = sm.conns.Transport(sm.Parms.TargetTransport)
 
-	if len(pwd) != 0 {
-		pwd, err = uti.ReversibleDecrypt(pwd, config.SecretKey())
+	if sm.Parms.Mode == models.RepModePull {
+		project, err := dao.GetProjectByID(policy.ProjectID)
 		if err != nil {
-			return fmt.Errorf("failed to decrypt password: %v", err)
+			return fmt.Errorf("Failed to get project, error: %v", err)
 		}
+		if project == nil {
+			return fmt.Errorf("The project doesn't exist in DB, project id: %d", policy.ProjectID)
+		}
+		sm.Parms.LocalRepository = replication.LocalRepository(project.Name, job.Repository)
 	}
 
-	sm.Parms.TargetPassword = pwd
-
-	//init states handlers
-	sm.Handlers = make(map[string]StateHandler)
-	sm.Transitions = make(map[string]map[string]struct{})
-	sm.CurrentState = models.JobPending
-
-	sm.AddTransition(models.JobPending, models.JobRunning, StatusUpdater{sm.JobID, models.JobRunning})
-	sm.AddTransition(models.JobRetrying, models.JobRunning, StatusUpdater{sm.JobID, models.JobRunning})
-	sm.Handlers[models.JobError] = StatusUpdater{sm.JobID, models.JobError}
-	sm.Handlers[models.JobStopped] = StatusUpdater{sm.JobID, models.JobStopped}
-	sm.Handlers[models.JobRetrying] = Retry{sm.JobID}
-
-	switch sm.Parms.Operation {
-	case models.RepOpTransfer:
+	switch {
+	case sm.Parms.Operation == models.RepOpTransfer && sm.Parms.Mode == models.RepModePull:
+		addImgPullTransition(sm)
+	case sm.Parms.Operation == models.RepOpTransfer:
 		addImgTransferTransition(sm)
-	case models.RepOpDelete:
+	case sm.Parms.Operation == models.RepOpDelete && sm.Parms.Mode != models.RepModePull:
 		addImgDeleteTransition(sm)
 	default:
-		err = fmt.Errorf("unsupported operation: %s", sm.Parms.Operation)
+		err = fmt.Errorf("unsupported operation: %s, mode: %s", sm.Parms.Operation, sm.Parms.Mode)
 	}
 
 	return err
@@ -270,22 +414,48 @@ func addTestTransition(sm *SM) error {
 
 func addImgTransferTransition(sm *SM) {
 	base := replication.InitBaseHandler(sm.Parms.Repository, sm.Parms.LocalRegURL, config.UISecret(),
-		sm.Parms.TargetURL, sm.Parms.TargetUsername, sm.Parms.TargetPassword,
-		sm.Parms.Insecure, sm.Parms.Tags, sm.Logger)
+		sm.Parms.TargetURL, sm.Parms.TargetUsername, "", sm.Parms.TargetType,
+		sm.Parms.Insecure, sm.Parms.Tags, sm.Parms.TagFilter, config.BlobChunkSize(), config.MaxParallelBlobs(),
+		int64(sm.Parms.BandwidthLimit)*1024, sm.Logger)
+	base.SetTarget(sm.Parms.TargetCredential, sm.Parms.TargetTransport)
+	base.SetLocalTransport(sm.conns.Transport(registry.GetHTTPTransport(sm.Parms.Insecure)))
+	base.SetMetrics(sm.metrics)
+	base.SetTransferWindows(transferWindows(sm.Parms.TransferWindows))
 
 	sm.AddTransition(models.JobRunning, replication.StateInitialize, &replication.Initializer{BaseHandler: base})
 	sm.AddTransition(replication.StateInitialize, replication.StateCheck, &replication.Checker{BaseHandler: base})
 	sm.AddTransition(replication.StateCheck, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
 	sm.AddTransition(replication.StatePullManifest, replication.StateTransferBlob, &replication.BlobTransfer{BaseHandler: base})
-	sm.AddTransition(replication.StatePullManifest, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
+	sm.AddTransition(replication.StatePullManifest, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished, sm.worker})
+	sm.AddTransition(replication.StateTransferBlob, replication.StatePushManifest, &replication.ManifestPusher{BaseHandler: base})
+	sm.AddTransition(replication.StatePushManifest, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
+}
+
+// addImgPullTransition pulls the repository from the target into the local project, the project
+// needn't to be checked as it exists locally
+func addImgPullTransition(sm *SM) {
+	base := replication.InitPullBaseHandler(sm.Parms.Repository, sm.Parms.LocalRepository,
+		sm.Parms.TargetURL, sm.Parms.TargetUsername, "",
+		sm.Parms.LocalRegURL, config.UISecret(), sm.Parms.Insecure, sm.Parms.Tags, sm.Parms.TagFilter,
+		config.BlobChunkSize(), config.MaxParallelBlobs(), int64(sm.Parms.BandwidthLimit)*1024, sm.Logger)
+	base.SetTarget(sm.Parms.TargetCredential, sm.Parms.TargetTransport)
+	base.SetLocalTransport(sm.conns.Transport(registry.GetHTTPTransport(sm.Parms.Insecure)))
+	base.SetMetrics(sm.metrics)
+	base.SetTransferWindows(transferWindows(sm.Parms.TransferWindows))
+
+	sm.AddTransition(models.JobRunning, replication.StateInitialize, &replication.Initializer{BaseHandler: base})
+	sm.AddTransition(replication.StateInitialize, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
+	sm.AddTransition(replication.StatePullManifest, replication.StateTransferBlob, &replication.BlobTransfer{BaseHandler: base})
+	sm.AddTransition(replication.StatePullManifest, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished, sm.worker})
 	sm.AddTransition(replication.StateTransferBlob, replication.StatePushManifest, &replication.ManifestPusher{BaseHandler: base})
 	sm.AddTransition(replication.StatePushManifest, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
 }
 
 func addImgDeleteTransition(sm *SM) {
-	deleter := replication.NewDeleter(sm.Parms.Repository, sm.Parms.Tags, sm.Parms.TargetURL,
-		sm.Parms.TargetUsername, sm.Parms.TargetPassword, sm.Parms.Insecure, sm.Logger)
+	deleter := replication.NewDeleter(sm.Parms.Repository, sm.Parms.Tags, sm.Parms.TagFilter, sm.Parms.TargetURL,
+		sm.Parms.TargetUsername, "", sm.Parms.TargetType, sm.Parms.Insecure, sm.Logger)
+	deleter.SetTarget(sm.Parms.TargetCredential, sm.Parms.TargetTransport)
 
 	sm.AddTransition(models.JobRunning, replication.StateDelete, deleter)
-	sm.AddTransition(replication.StateDelete, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
+	sm.AddTransition(replication.StateDelete, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished, sm.worker})
 }
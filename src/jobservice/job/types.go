@@ -0,0 +1,54 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// Type is a kind of job handled by the workers. The jobs of all types share the queue and the
+// retrying, stopping and logging of the state machine, the type declares the states a job goes
+// through once it's running.
+type Type interface {
+	// Validate checks the parameters in json when a job of the type is submitted.
+	Validate(parameters string) error
+	// Init adds the transitions from the running state and the handlers of the states to the
+	// state machine, it is called every time the job is claimed by a worker. The handlers can
+	// enter the retrying state to put the job back into the queue.
+	Init(sm *SM, job *models.RepJob) error
+}
+
+var types = make(map[string]Type)
+
+func init() {
+	RegisterType(models.JobTypeReplication, replicationType{})
+	RegisterType(models.JobTypeVerification, verificationType{})
+}
+
+// RegisterType adds a type of job to the registry, it should be called before the workers start.
+func RegisterType(name string, t Type) {
+	if _, dup := types[name]; dup {
+		log.Infof("job type: %s has been registered", name)
+		return
+	}
+	types[name] = t
+}
+
+// GetType returns the registered type of the name, or nil if the type is unknown
+func GetType(name string) Type {
+	return types[name]
+}
@@ -0,0 +1,331 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/replication"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// ErrVerificationRunning is returned when the policy is already being verified
+var ErrVerificationRunning = errors.New("the policy is being verified")
+
+// compareLogger is used when comparing repositories out of jobs, e.g. dry run and verification
+var compareLogger = log.New(os.Stdout, log.NewTextFormatter(), log.InfoLevel)
+
+// verifying holds the IDs of the policies being verified in this process
+var verifying = struct {
+	sync.Mutex
+	policies map[int64]struct{}
+}{policies: make(map[int64]struct{})}
+
+// DiffPolicy compares the repositories and tags selected by the policy with the ones on the
+// destination, the repositories which fail to be compared are recorded in the errors of the result.
+func DiffPolicy(p *models.RepPolicy) (*models.RepDryRun, error) {
+	target, err := dao.GetRepTarget(p.TargetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target %d: %v", p.TargetID, err)
+	}
+	if target == nil {
+		return nil, fmt.Errorf("target not found, id: %d", p.TargetID)
+	}
+	credential, transport, err := utils.TargetConnection(target)
+	if err != nil {
+		return nil, err
+	}
+	var project *models.Project
+	if p.Mode == models.RepModePull {
+		if project, err = dao.GetProjectByID(p.ProjectID); err != nil {
+			return nil, fmt.Errorf("failed to get project %d: %v", p.ProjectID, err)
+		}
+		if project == nil {
+			return nil, fmt.Errorf("project not found, id: %d", p.ProjectID)
+		}
+	}
+
+	repoList, err := utils.ListPolicyRepositories(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository list of policy %d: %v", p.ID, err)
+	}
+
+	result := &models.RepDryRun{
+		PolicyID: p.ID,
+		Tags:     []*models.RepTagDiff{},
+	}
+	insecure := !config.VerifyRemoteCert()
+	for _, repo := range repoList {
+		var base *replication.BaseHandler
+		if p.Mode == models.RepModePull {
+			base = replication.InitPullBaseHandler(repo, replication.LocalRepository(project.Name, repo),
+				target.URL, target.Username, "", config.LocalRegURL(), config.UISecret(), insecure,
+				nil, p.TagFilter, 0, 0, 0, compareLogger)
+		} else {
+			base = replication.InitBaseHandler(repo, config.LocalRegURL(), config.UISecret(),
+				target.URL, target.Username, "", target.Type, insecure, nil, p.TagFilter,
+				0, 0, 0, compareLogger)
+		}
+		base.SetTarget(credential, transport)
+
+		diffs, err := base.Diff()
+		if err != nil {
+			log.Warningf("Failed to compare repository %s of policy %d, error: %v", repo, p.ID, err)
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[repo] = err.Error()
+			continue
+		}
+		result.Add(diffs...)
+	}
+	return result, nil
+}
+
+// VerifyPolicy starts checking the digests of the tags selected by the policy against the destination
+// in background, the result is stored on the policy. If repair is true, jobs are created to replicate
+// the missing and mismatched tags and, for push mode, to delete the extra ones on the destination.
+func VerifyPolicy(p *models.RepPolicy, repair bool) error {
+	result, release, err := startVerification(p, repair)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer release()
+		verify(p, result)
+		if err := saveVerification(result); err != nil {
+			log.Errorf("Failed to save the verification result of policy %d, error: %v", p.ID, err)
+		}
+	}()
+	return nil
+}
+
+// startVerification marks the policy being verified and saves the running result, the returned
+// function must be called when the verification is done.
+func startVerification(p *models.RepPolicy, repair bool) (*models.RepVerification, func(), error) {
+	verifying.Lock()
+	if _, ok := verifying.policies[p.ID]; ok {
+		verifying.Unlock()
+		return nil, nil, ErrVerificationRunning
+	}
+	verifying.policies[p.ID] = struct{}{}
+	verifying.Unlock()
+	release := func() {
+		verifying.Lock()
+		delete(verifying.policies, p.ID)
+		verifying.Unlock()
+	}
+
+	result := &models.RepVerification{
+		PolicyID:  p.ID,
+		Status:    models.JobRunning,
+		Repair:    repair,
+		StartTime: time.Now(),
+		Tags:      []*models.RepTagDiff{},
+	}
+	if err := saveVerification(result); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return result, release, nil
+}
+
+func verify(p *models.RepPolicy, result *models.RepVerification) {
+	defer func() {
+		now := time.Now()
+		result.EndTime = &now
+	}()
+
+	dryRun, err := DiffPolicy(p)
+	if err != nil {
+		log.Errorf("Failed to verify policy %d, error: %v", p.ID, err)
+		result.Status = models.JobError
+		result.Error = err.Error()
+		return
+	}
+	result.Verified = dryRun.Skipped
+	result.Missing = dryRun.Created
+	result.Mismatched = dryRun.Updated
+	result.Extra = dryRun.Deleted
+	result.Errors = dryRun.Errors
+
+	toTransfer := make(map[string][]string)
+	toDelete := make(map[string][]string)
+	for _, d := range dryRun.Tags {
+		switch d.Action {
+		case models.RepDiffCreate, models.RepDiffUpdate:
+			// the jobs pulling the repositories refer to them by the names on the target
+			repository := d.Repository
+			if len(d.SrcRepository) != 0 {
+				repository = d.SrcRepository
+			}
+			toTransfer[repository] = append(toTransfer[repository], d.Tag)
+		case models.RepDiffDelete:
+			toDelete[d.Repository] = append(toDelete[d.Repository], d.Tag)
+		default:
+			continue
+		}
+		result.Tags = append(result.Tags, d)
+	}
+	log.Infof("Policy %d verified, verified: %d, missing: %d, mismatched: %d, extra: %d",
+		p.ID, result.Verified, result.Missing, result.Mismatched, result.Extra)
+
+	result.Status = models.JobFinished
+	if !result.Repair {
+		return
+	}
+	if p.Enabled == 0 {
+		result.Error = "the policy is disabled, no repair job is created"
+		return
+	}
+	if err = addRepairJobs(p.ID, models.RepOpTransfer, toTransfer, &result.RepairJobs); err == nil &&
+		p.Mode != models.RepModePull {
+		// the tags only existing locally are left as is for pull mode
+		err = addRepairJobs(p.ID, models.RepOpDelete, toDelete, &result.RepairJobs)
+	}
+	if err != nil {
+		log.Errorf("Failed to create repair jobs of policy %d, error: %v", p.ID, err)
+		result.Status = models.JobError
+		result.Error = fmt.Sprintf("failed to create repair jobs: %v", err)
+	}
+}
+
+// addRepairJobs creates a job of the operation for each repository to handle the tags in it
+func addRepairJobs(policyID int64, operation string, tags map[string][]string, count *int) error {
+	repositories := make([]string, 0, len(tags))
+	for repository := range tags {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+	for _, repository := range repositories {
+		id, err := dao.AddRepJob(models.RepJob{
+			Repository: repository,
+			PolicyID:   policyID,
+			Operation:  operation,
+			TagList:    tags[repository],
+		})
+		if err != nil {
+			return err
+		}
+		Schedule(id)
+		*count++
+	}
+	return nil
+}
+
+func saveVerification(result *models.RepVerification) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return dao.UpdateRepPolicyVerification(result.PolicyID, string(data))
+}
+
+// StateVerify is the state of the verification job in which the policy is verified
+const StateVerify = "verify"
+
+// VerificationParameters are the parameters of the jobs of type verification
+type VerificationParameters struct {
+	PolicyID int64 `json:"policy_id"`
+	Repair   bool  `json:"repair"`
+}
+
+// verificationType is the type of the jobs verifying the tags replicated by policies, it is the
+// same as verifying the policy via the API but the verification is queued and logged as a job.
+type verificationType struct{}
+
+// Validate checks the policy ID in the parameters
+func (v verificationType) Validate(parameters string) error {
+	_, err := parseVerificationParameters(parameters)
+	return err
+}
+
+// Init loads the policy to verify and adds the state verifying it
+func (v verificationType) Init(sm *SM, job *models.RepJob) error {
+	params, err := parseVerificationParameters(job.Parameters)
+	if err != nil {
+		return err
+	}
+	policy, err := dao.GetRepPolicy(params.PolicyID)
+	if err != nil {
+		return fmt.Errorf("Failed to get policy, error: %v", err)
+	}
+	if policy == nil {
+		return fmt.Errorf("The policy doesn't exist in DB, policy id:%d", params.PolicyID)
+	}
+
+	sm.AddTransition(models.JobRunning, StateVerify, &Verifier{policy: policy, repair: params.Repair, logger: sm.Logger})
+	sm.AddTransition(StateVerify, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished, sm.worker})
+	return nil
+}
+
+func parseVerificationParameters(parameters string) (*VerificationParameters, error) {
+	params := &VerificationParameters{}
+	if err := json.Unmarshal([]byte(parameters), params); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters: %v", err)
+	}
+	if params.PolicyID <= 0 {
+		return nil, fmt.Errorf("invalid policy ID: %d", params.PolicyID)
+	}
+	return params, nil
+}
+
+// Verifier handles the "verify" state, it verifies the policy and stores the result on the policy
+type Verifier struct {
+	policy *models.RepPolicy
+	repair bool
+	logger *log.Logger
+}
+
+// Enter verifies the policy, the job fails if the verification fails
+func (v *Verifier) Enter() (string, error) {
+	result, release, err := startVerification(v.policy, v.repair)
+	if err != nil {
+		v.logger.Errorf("failed to start verifying policy %d: %v", v.policy.ID, err)
+		return "", err
+	}
+	defer release()
+
+	v.logger.Infof("verifying policy %d, repair: %t", v.policy.ID, v.repair)
+	verify(v.policy, result)
+	if err = saveVerification(result); err != nil {
+		v.logger.Errorf("failed to save the verification result of policy %d: %v", v.policy.ID, err)
+		return "", err
+	}
+	if result.Status == models.JobError {
+		v.logger.Errorf("failed to verify policy %d: %s", v.policy.ID, result.Error)
+		return "", errors.New(result.Error)
+	}
+	v.logger.Infof("policy %d verified, verified: %d, missing: %d, mismatched: %d, extra: %d, repair jobs: %d",
+		v.policy.ID, result.Verified, result.Missing, result.Mismatched, result.Extra, result.RepairJobs)
+	return models.JobFinished, nil
+}
+
+// Exit ...
+func (v *Verifier) Exit() error {
+	return nil
+}
@@ -16,24 +16,61 @@
 package job
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/jobservice/config"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
+	jobutils "github.com/vmware/harbor/src/jobservice/utils"
 )
 
 type workerPool struct {
+	lock       sync.Mutex
 	workerChan chan *Worker
 	workerList []*Worker
+	// nextID is the ID of the next worker to add to the pool
+	nextID int
 }
 
+var (
+	// ErrWorkerNotFound is returned when the worker doesn't exist in the pool
+	ErrWorkerNotFound = errors.New("worker not found")
+	// ErrWorkerIdle is returned when stopping a worker which is not handling any job
+	ErrWorkerIdle = errors.New("worker is idle")
+)
+
+// stopping is closed when the job service is shutting down
+var stopping = make(chan struct{})
+
 // WorkerPool is a set of workers each worker is associate to a statemachine for handling jobs.
 // it consists of a channel for free workers and a list to all workers
 var WorkerPool *workerPool
 
+// WorkerStatus is the status of a worker in the pool
+type WorkerStatus struct {
+	ID int `json:"id"`
+	// JobID is 0 and State is empty if the worker is idle
+	JobID int64  `json:"job_id"`
+	State string `json:"state"`
+	// TimeInState is the seconds since the current state is entered
+	Since       *time.Time `json:"since,omitempty"`
+	TimeInState int64      `json:"time_in_state"`
+	Retries     int        `json:"retries"`
+	// Retiring is true if the worker is removed from the pool and will stop after the current job
+	Retiring bool `json:"retiring"`
+}
+
 // StopJobs accepts a list of jobs and will try to stop them if any of them is being executed by the worker.
 func (wp *workerPool) StopJobs(jobs []int64) {
 	log.Debugf("Works working on jobs: %v will be stopped", jobs)
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
 	for _, id := range jobs {
 		for _, w := range wp.workerList {
 			if w.SM.JobID == id {
@@ -44,6 +81,196 @@ func (wp *workerPool) StopJobs(jobs []int64) {
 	}
 }
 
+// Status returns the status of all the workers, including the retiring ones
+func (wp *workerPool) Status() []*WorkerStatus {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	now := time.Now()
+	list := make([]*WorkerStatus, 0, len(wp.workerList))
+	for _, w := range wp.workerList {
+		status := &WorkerStatus{
+			ID:       w.ID,
+			Retiring: w.isRetiring(),
+		}
+		if status.JobID = w.currentJob(); status.JobID != 0 {
+			jobID, state, since, attempts := w.SM.status()
+			if jobID == status.JobID {
+				status.State = state
+				status.Since = &since
+				status.TimeInState = int64(now.Sub(since) / time.Second)
+				if attempts > 1 {
+					status.Retries = attempts - 1
+				}
+			}
+		}
+		list = append(list, status)
+	}
+	return list
+}
+
+// Size returns the count of the workers which are not retiring
+func (wp *workerPool) Size() int {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	return wp.size()
+}
+
+func (wp *workerPool) size() int {
+	n := 0
+	for _, w := range wp.workerList {
+		if !w.isRetiring() {
+			n++
+		}
+	}
+	return n
+}
+
+// Resize adds workers to the pool or retires the workers out of the size, the idle workers are
+// retired first and the busy ones stop after the current jobs are done.
+func (wp *workerPool) Resize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid size of worker pool: %d", size)
+	}
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	n := wp.size()
+	for ; n < size; n++ {
+		wp.addWorker()
+	}
+	// retire the idle workers before the busy ones
+	for _, idle := range []bool{true, false} {
+		for i := len(wp.workerList) - 1; i >= 0 && n > size; i-- {
+			w := wp.workerList[i]
+			if w.isRetiring() || (w.currentJob() == 0) != idle {
+				continue
+			}
+			w.retire()
+			n--
+		}
+	}
+	log.Infof("The size of worker pool is changed to %d", size)
+	return nil
+}
+
+// StopWorker stops the job being handled by the worker and replaces the worker with a new one,
+// it is used to release the workers stuck in jobs. The connections of the job are closed so that
+// the requests blocking the worker are aborted. The ID of the stopped job is returned.
+func (wp *workerPool) StopWorker(id int) (int64, error) {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	var worker *Worker
+	for _, w := range wp.workerList {
+		if w.ID == id {
+			worker = w
+			break
+		}
+	}
+	if worker == nil {
+		return 0, ErrWorkerNotFound
+	}
+	jobID := worker.currentJob()
+	if jobID == 0 {
+		return 0, ErrWorkerIdle
+	}
+
+	log.Infof("Worker %d will be stopped, job: %d", id, jobID)
+	worker.SM.Stop(jobID)
+	// the worker may be blocked in the requests to the registries
+	worker.SM.closeConnections(jobID)
+	if err := dao.UpdateRepJobStatus(jobID, models.JobStopped); err != nil {
+		return 0, fmt.Errorf("failed to update status of job %d: %v", jobID, err)
+	}
+	publishState(jobID, models.JobStopped)
+	if !worker.isRetiring() {
+		worker.retire()
+		wp.addWorker()
+	}
+	return jobID, nil
+}
+
+// interruptJobs asks the workers to put their jobs back to the queue after the current states, and
+// returns the count of the busy workers
+func (wp *workerPool) interruptJobs() int {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	busy := 0
+	for _, w := range wp.workerList {
+		if id := w.currentJob(); id != 0 {
+			w.SM.Interrupt(id)
+			busy++
+		}
+	}
+	return busy
+}
+
+// saveCheckpoints saves the metrics of the jobs being handled as their checkpoints
+func (wp *workerPool) saveCheckpoints() {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	for _, w := range wp.workerList {
+		if id := w.currentJob(); id != 0 {
+			w.SM.SaveMetrics()
+		}
+	}
+}
+
+// Shutdown stops dispatching jobs and interrupts the jobs being handled, which are put back to the
+// queue after their current states and resumed from their checkpoints when claimed again. It waits
+// for the workers until the timeout, then the checkpoints of the jobs still being handled are saved
+// and the jobs are put back to the queue.
+func Shutdown(timeout time.Duration) {
+	close(stopping)
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		busy := WorkerPool.interruptJobs()
+		if busy == 0 {
+			log.Info("All the workers are idle")
+			return
+		}
+		select {
+		case <-deadline:
+			log.Warningf("%d workers are still busy after %v, their jobs are reset to pending and will be resumed from their checkpoints", busy, timeout)
+			WorkerPool.saveCheckpoints()
+			if _, err := ResetRunningJobs(); err != nil {
+				log.Errorf("Failed to reset running jobs to pending, error: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func isStopping() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// addWorker starts a new worker, the caller must hold the lock
+func (wp *workerPool) addWorker() {
+	w := NewWorker(wp.nextID)
+	wp.nextID++
+	wp.workerList = append(wp.workerList, w)
+	w.Start()
+	log.Debugf("worker %d started", w.ID)
+}
+
+func (wp *workerPool) remove(worker *Worker) {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	for i, w := range wp.workerList {
+		if w == worker {
+			wp.workerList = append(wp.workerList[:i], wp.workerList[i+1:]...)
+			return
+		}
+	}
+}
+
 // Worker consists of a channel for job from which worker gets the next job to handle, and a pointer to a statemachine,
 // the actual work to handle the job is done via state machine.
 type Worker struct {
@@ -51,17 +278,28 @@ type Worker struct {
 	RepJobs chan int64
 	SM      *SM
 	quit    chan bool
+	lock    sync.Mutex
+	// jobID is the job being handled, it is 0 if the worker is idle
+	jobID    int64
+	retiring bool
 }
 
 // Start is a loop worker gets id from its channel and handle it.
 func (w *Worker) Start() {
 	go func() {
+		defer WorkerPool.remove(w)
 		for {
+			if w.isRetiring() {
+				log.Debugf("worker: %d, is retired.", w.ID)
+				return
+			}
 			WorkerPool.workerChan <- w
 			select {
 			case jobID := <-w.RepJobs:
 				log.Debugf("worker: %d, will handle job: %d", w.ID, jobID)
+				w.setCurrentJob(jobID)
 				w.handleRepJob(jobID)
+				w.setCurrentJob(0)
 			case q := <-w.quit:
 				if q {
 					log.Debugf("worker: %d, will stop.", w.ID)
@@ -79,25 +317,136 @@ func (w *Worker) Stop() {
 	}()
 }
 
+func (w *Worker) currentJob() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.jobID
+}
+
+func (w *Worker) setCurrentJob(id int64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.jobID = id
+}
+
+// retire marks the worker to stop, it stops when it gets back to the pool
+func (w *Worker) retire() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.retiring = true
+}
+
+func (w *Worker) isRetiring() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.retiring
+}
+
+// name identifies the worker among the workers of all job services
+func (w *Worker) name() string {
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), w.ID)
+}
+
+// heartbeat records that the job is being handled by the worker periodically until done is closed,
+// so that the job is not claimed by other workers. The job is stopped once it is not held by the
+// worker any more, e.g. it has been marked as stopped by the job service receiving the request to
+// stop it, or it has been claimed by others after the lease expired.
+func (w *Worker) heartbeat(id int64, done <-chan struct{}) {
+	ticker := time.NewTicker(config.JobLeaseTimeout() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ok, err := dao.HeartbeatRepJob(id, w.name())
+			if err != nil {
+				log.Errorf("Worker %d, failed to send heartbeat of job: %d, error: %v", w.ID, id, err)
+				continue
+			}
+			if !ok {
+				log.Warningf("Worker %d, job %d is not held by the worker any more, will stop it", w.ID, id)
+				w.SM.Stop(id)
+				w.SM.closeConnections(id)
+				return
+			}
+		}
+	}
+}
+
 func (w *Worker) handleRepJob(id int64) {
+	done := make(chan struct{})
+	defer close(done)
+	defer w.SM.closeConnections(id)
+	go w.heartbeat(id, done)
+
 	err := w.SM.Reset(id)
 	if err != nil {
 		log.Errorf("Worker %d, failed to re-initialize statemachine for job: %d, error: %v", w.ID, id, err)
-		err2 := dao.UpdateRepJobStatus(id, models.JobError)
+		err2 := dao.UpdateRepJobStatusOfWorker(id, w.name(), models.JobError)
 		if err2 != nil {
 			log.Errorf("Failed to update job status to ERROR, job: %d, error:%v", id, err2)
 		}
+		publishState(id, models.JobError)
+		compressLog(id)
 		return
 	}
 	if w.SM.Parms.Enabled == 0 {
 		log.Debugf("The policy of job:%d is disabled, will cancel the job", id)
-		_ = dao.UpdateRepJobStatus(id, models.JobCanceled)
+		_ = dao.UpdateRepJobStatusOfWorker(id, w.name(), models.JobCanceled)
 		w.SM.Logger.Info("The job has been canceled")
+		publishState(id, models.JobCanceled)
+		compressLog(id)
+	} else if next, ok := outOfTransferWindows(w.SM.Parms.TransferWindows); ok {
+		log.Debugf("Worker %d, job %d is out of the transfer windows of the target, will defer it to %v", w.ID, id, next)
+		if err := dao.DeferRepJob(id, w.name(), next); err != nil {
+			log.Errorf("Failed to defer job: %d, error: %v", id, err)
+			return
+		}
+		w.SM.Logger.Infof("The job is out of the transfer windows %q of the target, it is deferred to %v", w.SM.Parms.TransferWindows, next)
+		publishState(id, models.JobPending)
 	} else {
+		if isStopping() {
+			w.SM.Interrupt(id)
+		}
+		w.SM.SaveMetrics()
 		w.SM.Start(models.JobRunning)
+		w.SM.SaveMetrics()
+		if IsFinalState(w.SM.CurrentState) {
+			compressLog(id)
+		}
 	}
 }
 
+// compressLog compresses the log of the job reaching a final state
+func compressLog(id int64) {
+	if err := jobutils.CompressJobLog(id); err != nil {
+		log.Warningf("Failed to compress log of job %d, error: %v", id, err)
+	}
+}
+
+// outOfTransferWindows returns the start of the next transfer window and true if the current
+// time is out of the windows
+func outOfTransferWindows(windows string) (time.Time, bool) {
+	tws := transferWindows(windows)
+	now := time.Now()
+	if utils.InTimeWindows(tws, now) {
+		return time.Time{}, false
+	}
+	return utils.NextTimeWindowStart(tws, now), true
+}
+
+// transferWindows parses the transfer windows of the target, the invalid windows are ignored
+// so that the job is not deferred
+func transferWindows(windows string) []utils.TimeWindow {
+	tws, err := utils.ParseTimeWindows(windows)
+	if err != nil {
+		log.Warningf("Invalid transfer windows: %s, the job will not be deferred, error: %v", windows, err)
+		return nil
+	}
+	return tws
+}
+
 // NewWorker returns a pointer to new instance of worker
 func NewWorker(id int) *Worker {
 	w := &Worker{
@@ -106,6 +455,7 @@ func NewWorker(id int) *Worker {
 		quit:    make(chan bool),
 		SM:      &SM{},
 	}
+	w.SM.worker = w.name()
 	w.SM.Init()
 	return w
 }
@@ -116,24 +466,49 @@ func InitWorkerPool() {
 		workerChan: make(chan *Worker, config.MaxJobWorkers()),
 		workerList: make([]*Worker, 0, config.MaxJobWorkers()),
 	}
+	WorkerPool.lock.Lock()
+	defer WorkerPool.lock.Unlock()
 	for i := 0; i < config.MaxJobWorkers(); i++ {
-		worker := NewWorker(i)
-		WorkerPool.workerList = append(WorkerPool.workerList, worker)
-		worker.Start()
-		log.Debugf("worker %d started", worker.ID)
+		WorkerPool.addWorker()
 	}
 }
 
-// Dispatch will listen to the jobQueue of job service and try to pick a free worker from the worker pool and assign the job to it.
+// Dispatch claims jobs from the queue in database for the free workers of the worker pool, the
+// queue is checked when a job is scheduled or periodically when there is no job to claim.
+// It returns when the job service is shutting down.
 func Dispatch() {
 	for {
+		var worker *Worker
 		select {
-		case job := <-jobQueue:
-			go func(jobID int64) {
-				log.Debugf("Trying to dispatch job: %d", jobID)
-				worker := <-WorkerPool.workerChan
-				worker.RepJobs <- jobID
-			}(job)
+		case worker = <-WorkerPool.workerChan:
+		case <-stopping:
+			log.Info("Dispatching jobs is stopped")
+			return
+		}
+		for {
+			if worker.isRetiring() {
+				worker.Stop()
+				break
+			}
+			if isStopping() {
+				log.Info("Dispatching jobs is stopped")
+				return
+			}
+			job, err := dao.ClaimRepJob(worker.name(), time.Now().Add(-config.JobLeaseTimeout()))
+			if err != nil {
+				log.Errorf("Failed to claim job from queue, error: %v", err)
+			}
+			if job != nil {
+				log.Debugf("Job %d is claimed by worker %d, attempts: %d", job.ID, worker.ID, job.Attempts)
+				worker.RepJobs <- job.ID
+				break
+			}
+
+			select {
+			case <-wakeup:
+			case <-time.After(config.QueuePollInterval()):
+			case <-stopping:
+			}
 		}
 	}
 }
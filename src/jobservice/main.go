@@ -16,35 +16,48 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/astaxie/beego"
 	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/jobservice/config"
 	"github.com/vmware/harbor/src/jobservice/job"
-	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
 func main() {
 	dao.InitDatabase()
 	initRouters()
+	resumeJobs()
 	job.InitWorkerPool()
 	go job.Dispatch()
-	resumeJobs()
+	go job.SchedulePolicies()
+	go job.CleanLogs()
+	go handleSignals()
 	beego.Run()
 }
 
+// handleSignals shuts down the job service gracefully on SIGTERM or SIGINT, the jobs being
+// handled are put back to the queue and resumed from their checkpoints on start-up
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	s := <-signals
+	log.Infof("Signal %v received, shutting down", s)
+	job.Shutdown(config.ShutdownTimeout())
+	os.Exit(0)
+}
+
 func resumeJobs() {
 	log.Debugf("Trying to resume halted jobs...")
-	err := dao.ResetRunningJobs()
+	n, err := job.ResetRunningJobs()
 	if err != nil {
-		log.Warningf("Failed to reset all running jobs to pending, error: %v", err)
-	}
-	jobs, err := dao.GetRepJobByStatus(models.JobPending, models.JobRetrying)
-	if err == nil {
-		for _, j := range jobs {
-			log.Debugf("Resuming job: %d", j.ID)
-			job.Schedule(j.ID)
-		}
-	} else {
-		log.Warningf("Failed to jobs to resume, error: %v", err)
+		log.Warningf("Failed to reset running jobs to pending, error: %v", err)
+	} else if n > 0 {
+		log.Infof("%d running jobs interrupted are reset to pending", n)
 	}
+	// the jobs of other job services are claimed when their leases expire
+	job.Schedule(0)
 }
@@ -0,0 +1,199 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// defaultChunkSize is used when the chunk size is not set
+	defaultChunkSize = 10 * 1024 * 1024
+	// maxChunkSeconds is the max seconds to pull and push a chunk when the bandwidth is limited
+	maxChunkSeconds = 10
+)
+
+// uploadSessions records the locations of the upload sessions of the blobs failed to be pushed,
+// so that the uploads can be resumed from the offsets reported by the registry when the jobs
+// are retried. The key is the URL of the destination registry, the repository and the digest.
+// The sessions are shared by the jobs in the process, and they are also saved in the checkpoint
+// of the job, so the job resumes them after the job service restarts or on another instance.
+var uploadSessions = struct {
+	sync.Mutex
+	locations map[string]string
+}{locations: make(map[string]string)}
+
+func uploadSessionKey(dstURL, repository, digest string) string {
+	return fmt.Sprintf("%s/%s@%s", dstURL, repository, digest)
+}
+
+func loadUploadSession(key string) string {
+	uploadSessions.Lock()
+	defer uploadSessions.Unlock()
+	return uploadSessions.locations[key]
+}
+
+func saveUploadSession(key, location string) {
+	uploadSessions.Lock()
+	defer uploadSessions.Unlock()
+	if len(location) == 0 {
+		delete(uploadSessions.locations, key)
+		return
+	}
+	uploadSessions.locations[key] = location
+}
+
+// blobLocks serializes the transfers of a blob to the same repository, e.g. by the jobs replicating
+// the repository at the same time, as they share the upload session. The key is the one of the
+// upload session and the lock is removed when no transfer holds or waits for it.
+var blobLocks = struct {
+	sync.Mutex
+	locks map[string]*blobLock
+}{locks: make(map[string]*blobLock)}
+
+type blobLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockBlob locks the blob of the key, waited is true if another transfer held the lock
+func lockBlob(key string) (unlock func(), waited bool) {
+	blobLocks.Lock()
+	l, ok := blobLocks.locks[key]
+	if !ok {
+		l = &blobLock{}
+		blobLocks.locks[key] = l
+	}
+	l.refs++
+	waited = l.refs > 1
+	blobLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		blobLocks.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(blobLocks.locks, key)
+		}
+		blobLocks.Unlock()
+	}, waited
+}
+
+// transferBlob pulls the blob from source registry and pushes it to destination registry
+// chunk by chunk. If an upload session of the blob failed before, the upload is resumed
+// from the offset the destination registry has received.
+func (b *BaseHandler) transferBlob(blob string) error {
+	key := uploadSessionKey(b.dstURL, b.repository, blob)
+	unlock, waited := lockBlob(key)
+	defer unlock()
+	if waited {
+		// the blob may have been pushed by the transfer holding the lock
+		exist, err := b.dstClient.BlobExist(blob)
+		if err != nil {
+			return err
+		}
+		if exist {
+			b.logger.Infof("blob %s has been transferred by another job", blob)
+			return nil
+		}
+	}
+
+	var offset int64
+	location := loadUploadSession(key)
+	if len(location) == 0 {
+		location = b.metrics.uploadSession(blob)
+	}
+	if len(location) != 0 {
+		var err error
+		offset, err = b.dstClient.GetBlobUploadOffset(location)
+		if err != nil {
+			// the upload session may have expired, start a new one
+			b.logger.Warningf("failed to get the status of the upload session of blob %s, will upload it from the beginning: %v", blob, err)
+			location = ""
+			offset = 0
+		} else {
+			b.logger.Infof("resuming the upload of blob %s from offset %d", blob, offset)
+		}
+	}
+
+	if len(location) == 0 {
+		var err error
+		if location, err = b.dstClient.InitiateBlobUpload(); err != nil {
+			return err
+		}
+	}
+	saveUploadSession(key, location)
+	b.metrics.saveUploadSession(blob, location)
+
+	chunkSize := b.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	// keep the time to pull and push a chunk under the bandwidth limit well within the timeout
+	// of the clients
+	if b.bandwidth > 0 && chunkSize > b.bandwidth*maxChunkSeconds {
+		chunkSize = b.bandwidth * maxChunkSeconds
+	}
+
+	// the size is got from the source registry with the first chunk if the blob is not in the manifests
+	total, ok := b.blobSizes[blob]
+	if !ok {
+		total = -1
+	}
+	progress := -1
+	for total < 0 || offset < total {
+		length := chunkSize
+		if total >= 0 && total-offset < length {
+			length = total - offset
+		}
+
+		// every chunk is pulled by a request of its own, as the body of a request is read within
+		// the timeout of the source client
+		size, data, err := b.srcClient.PullBlobChunk(blob, offset, length)
+		if err != nil {
+			return err
+		}
+		total = size
+		if total-offset < length {
+			length = total - offset
+		}
+
+		next, err := b.dstClient.PushBlobChunk(location, offset, length, b.limitRate(data))
+		data.Close()
+		if err != nil {
+			return err
+		}
+		location = next
+		saveUploadSession(key, location)
+		b.metrics.saveUploadSession(blob, location)
+		offset += length
+		b.metrics.bytesSent(length)
+
+		// log the progress every 10 percent
+		if p := int(offset * 100 / total); p/10 != progress/10 {
+			progress = p
+			b.logger.Infof("blob %s: %d/%d bytes (%d%%) transferred", blob, offset, total, p)
+		}
+	}
+
+	if err := b.dstClient.CompleteBlobUpload(location, blob); err != nil {
+		return err
+	}
+	saveUploadSession(key, "")
+	b.metrics.saveUploadSession(blob, "")
+	return nil
+}
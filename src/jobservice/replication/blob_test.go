@@ -0,0 +1,175 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+)
+
+func TestTransferBlobResume(t *testing.T) {
+	repository := "library/hello-world"
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	content := []byte("0123456789")
+
+	ranges := []string{}
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		ranges = append(ranges, rng)
+		bounds := strings.Split(strings.TrimPrefix(rng, "bytes="), "-")
+		first, _ := strconv.Atoi(bounds[0])
+		last, _ := strconv.Atoi(bounds[1])
+		if last >= len(content) {
+			last = len(content) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(content)))
+		w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[first : last+1])
+	}))
+	defer src.Close()
+
+	uploadPath := fmt.Sprintf("/v2/%s/blobs/uploads/uuid", repository)
+	received := []byte{}
+	patches, completed := 0, false
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST":
+			w.Header().Set("Location", uploadPath)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "GET" && r.URL.Path == uploadPath:
+			w.Header().Set("Range", fmt.Sprintf("0-%d", len(received)-1))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "PATCH":
+			patches++
+			b, _ := ioutil.ReadAll(r.Body)
+			// the second chunk fails for the first time
+			if patches == 2 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			received = append(received, b...)
+			w.Header().Set("Location", uploadPath)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT":
+			completed = r.URL.Query().Get("digest") == digest
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer dst.Close()
+
+	srcClient, err := registry.NewRepository(repository, src.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create source client: %v", err)
+	}
+	dstClient, err := registry.NewRepository(repository, dst.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create destination client: %v", err)
+	}
+
+	b := &BaseHandler{
+		repository: repository,
+		dstURL:     dst.URL,
+		srcClient:  srcClient,
+		dstClient:  dstClient,
+		chunkSize:  4,
+		metrics:    NewMetrics(nil),
+		logger:     log.New(ioutil.Discard, log.NewTextFormatter(), log.DebugLevel),
+	}
+
+	if err = b.transferBlob(digest); err == nil {
+		t.Fatalf("the transfer should fail")
+	}
+
+	// the job service restarts, the upload is resumed from the checkpoint of the job and
+	// the offset received by destination registry
+	key := uploadSessionKey(dst.URL, repository, digest)
+	if location := loadUploadSession(key); location != dst.URL+uploadPath {
+		t.Errorf("unexpected upload session: %s", location)
+	}
+	saveUploadSession(key, "")
+	job := &models.RepJob{}
+	b.metrics.Fill(job, models.JobRetrying)
+	if job.UploadMap[digest] != dst.URL+uploadPath {
+		t.Errorf("unexpected upload sessions in the checkpoint: %v", job.UploadMap)
+	}
+	b.metrics = NewMetrics(job)
+	ranges = []string{}
+	if err = b.transferBlob(digest); err != nil {
+		t.Fatalf("failed to transfer blob: %v", err)
+	}
+
+	if !completed || !bytes.Equal(received, content) {
+		t.Errorf("unexpected blob received: %s, completed: %v", string(received), completed)
+	}
+
+	// the chunks are pulled from the offset received
+	if !reflect.DeepEqual(ranges, []string{"bytes=4-7", "bytes=8-9"}) {
+		t.Errorf("unexpected ranges requested from source: %v", ranges)
+	}
+
+	if location := loadUploadSession(key); len(location) != 0 {
+		t.Errorf("the upload session should be removed after completed: %s", location)
+	}
+	if location := b.metrics.uploadSession(digest); len(location) != 0 {
+		t.Errorf("the upload session should be removed from the checkpoint after completed: %s", location)
+	}
+}
+
+func TestLockBlob(t *testing.T) {
+	key := uploadSessionKey("http://registry", "library/ubuntu", "sha256:1")
+	unlock, waited := lockBlob(key)
+	if waited {
+		t.Errorf("the lock should not be waited for when it is free")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		unlock2, waited := lockBlob(key)
+		unlock2()
+		acquired <- waited
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("the lock should not be acquired before it is released")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	if waited := <-acquired; !waited {
+		t.Errorf("the second transfer should have waited for the lock")
+	}
+
+	blobLocks.Lock()
+	defer blobLocks.Unlock()
+	if len(blobLocks.locks) != 0 {
+		t.Errorf("the locks should be removed when they are released: %v", blobLocks.locks)
+	}
+}
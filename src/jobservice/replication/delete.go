@@ -17,16 +17,17 @@ package replication
 
 import (
 	"errors"
-
-	"github.com/vmware/harbor/src/common/models"
-	"github.com/vmware/harbor/src/common/utils/log"
-	//"github.com/vmware/harbor/src/common/utils/registry"
-	//"github.com/vmware/harbor/src/common/utils/registry/auth"
-	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
 )
 
 const (
@@ -42,34 +43,51 @@ var (
 type Deleter struct {
 	repository string // prject_name/repo_name
 	tags       []string
+	tagFilter  string // comma separated patterns of the tags to delete
 
-	dstURL string // url of target registry
-	dstUsr string // username ...
-	dstPwd string // username ...
+	dstURL  string // url of target registry
+	dstUsr  string // username ...
+	dstType int    // type of target registry, a Harbor instance or a plain docker registry
 
 	insecure bool
 
-	//dstClient *registry.Repository
+	dstCred      auth.Credential
+	dstTransport *http.Transport
+
+	// filtered is true if the tags have been selected by the tag filter, and finished
+	// is true if there is nothing to delete after filtering
+	filtered bool
+	finished bool
 
 	logger *log.Logger
 }
 
 // NewDeleter returns a Deleter
-func NewDeleter(repository string, tags []string, dstURL, dstUsr, dstPwd string, insecure bool, logger *log.Logger) *Deleter {
+func NewDeleter(repository string, tags []string, tagFilter, dstURL, dstUsr, dstPwd string, dstType int,
+	insecure bool, logger *log.Logger) *Deleter {
 	deleter := &Deleter{
 		repository: repository,
 		tags:       tags,
+		tagFilter:  tagFilter,
 		dstURL:     dstURL,
 		dstUsr:     dstUsr,
-		dstPwd:     dstPwd,
+		dstType:    dstType,
 		insecure:   insecure,
+		dstCred:    auth.NewBasicAuthCredential(dstUsr, dstPwd),
 		logger:     logger,
 	}
-	deleter.logger.Infof("initialization completed: repository: %s, tags: %v, destination URL: %s, insecure: %v, destination user: %s",
-		deleter.repository, deleter.tags, deleter.dstURL, deleter.insecure, deleter.dstUsr)
+	deleter.dstTransport = registry.GetHTTPTransport(insecure)
+	deleter.logger.Infof("initialization completed: repository: %s, tags: %v, tag filter: %s, destination URL: %s, insecure: %v, destination user: %s",
+		deleter.repository, deleter.tags, deleter.tagFilter, deleter.dstURL, deleter.insecure, deleter.dstUsr)
 	return deleter
 }
 
+// SetTarget sets the credential and the transport used to connect to the target registry
+func (d *Deleter) SetTarget(cred auth.Credential, transport *http.Transport) {
+	d.dstCred = cred
+	d.dstTransport = transport
+}
+
 // Exit ...
 func (d *Deleter) Exit() error {
 	return nil
@@ -77,7 +95,17 @@ func (d *Deleter) Exit() error {
 
 // Enter deletes repository or tags
 func (d *Deleter) Enter() (string, error) {
-	state, err := d.enter()
+	var state string
+	var err error
+	if err = d.filterTags(); err != nil {
+		d.logger.Errorf("an error occurred while filtering tags of repository %s on %s with user %s: %v", d.repository, d.dstURL, d.dstUsr, err)
+	} else if d.finished {
+		state = models.JobFinished
+	} else if d.dstType == models.TargetTypeRegistry {
+		state, err = d.deleteOnRegistry()
+	} else {
+		state, err = d.enter()
+	}
 	if err != nil && retry(err) {
 		d.logger.Info("waiting for retrying...")
 		return models.JobRetrying, nil
@@ -92,7 +120,7 @@ func (d *Deleter) enter() (string, error) {
 	// delete repository
 	if len(d.tags) == 0 {
 		u := url + "?repo_name=" + d.repository
-		if err := del(u, d.dstUsr, d.dstPwd, d.insecure); err != nil {
+		if err := del(u, d.dstCred, d.dstTransport); err != nil {
 			if err == errNotFound {
 				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
 				return models.JobFinished, nil
@@ -111,7 +139,7 @@ func (d *Deleter) enter() (string, error) {
 	// delele tags
 	for _, tag := range d.tags {
 		u := url + "?repo_name=" + d.repository + "&tag=" + tag
-		if err := del(u, d.dstUsr, d.dstPwd, d.insecure); err != nil {
+		if err := del(u, d.dstCred, d.dstTransport); err != nil {
 			if err == errNotFound {
 				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
 				continue
@@ -123,59 +151,118 @@ func (d *Deleter) enter() (string, error) {
 		d.logger.Infof("repository %s:%s on %s has been deleted", d.repository, tag, d.dstURL)
 	}
 	return models.JobFinished, nil
+}
+
+// deleteOnRegistry deletes the manifests of the tags through the registry API. The registry API
+// can't delete a repository, so all the tags of it are deleted when the tags aren't specified.
+func (d *Deleter) deleteOnRegistry() (string, error) {
+	dstClient, err := newRepositoryClient(d.dstURL, d.dstTransport, d.dstCred,
+		d.repository, "repository", d.repository, "pull", "push", "*")
+	if err != nil {
+		d.logger.Errorf("an error occurred while creating destination repository client: %v", err)
+		return "", err
+	}
 
-	/*
-		// the follow codes can be used for non-harbor repository deletion
-		dstCred := auth.NewBasicAuthCredential(d.dstUsr, d.dstPwd)
-		dstClient, err := newRepositoryClient(d.dstURL, d.insecure, dstCred,
-			d.repository, "repository", d.repository, "pull", "push", "*")
+	tags := d.tags
+	if len(tags) == 0 {
+		tags, err = dstClient.ListTag()
 		if err != nil {
-			d.logger.Errorf("an error occurred while creating destination repository client: %v", err)
+			if isNotFoundErr(err) {
+				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
+				return models.JobFinished, nil
+			}
+			d.logger.Errorf("an error occurred while listing tags of repository %s on %s with user %s: %v", d.repository, d.dstURL, d.dstUsr, err)
 			return "", err
 		}
+	}
 
-		d.dstClient = dstClient
-
-		if len(d.tags) == 0 {
-			tags, err := d.dstClient.ListTag()
-			if err != nil {
-				d.logger.Errorf("an error occurred while listing tags of repository %s on %s with user %s: %v", d.repository, d.dstURL, d.dstUsr, err)
-				return "", err
-			}
+	d.logger.Infof("tags %v will be deleted", tags)
 
-			d.tags = append(d.tags, tags...)
+	// the tags pointing to the same manifest are all deleted with the manifest
+	deleted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		digest, exist, err := dstClient.ManifestExist(tag)
+		if err != nil {
+			d.logger.Errorf("an error occurred while checking the manifest of %s:%s on %s with user %s: %v", d.repository, tag, d.dstURL, d.dstUsr, err)
+			return "", err
 		}
 
-		d.logger.Infof("tags %v will be deleted", d.tags)
+		if !exist {
+			d.logger.Warningf("repository %s:%s does not exist on %s", d.repository, tag, d.dstURL)
+			continue
+		}
 
-		for _, tag := range d.tags {
+		if deleted[digest] {
+			d.logger.Infof("manifest %s of %s:%s has been deleted", digest, d.repository, tag)
+			continue
+		}
 
-			if err := d.dstClient.DeleteTag(tag); err != nil {
-				d.logger.Errorf("an error occurred while deleting repository %s:%s on %s with user %s: %v", d.repository, tag, d.dstURL, d.dstUsr, err)
-				return "", err
+		if err = dstClient.DeleteManifest(digest); err != nil {
+			if isNotFoundErr(err) {
+				d.logger.Warningf("manifest %s of %s:%s does not exist on %s", digest, d.repository, tag, d.dstURL)
+				continue
 			}
+			d.logger.Errorf("an error occurred while deleting repository %s:%s on %s with user %s: %v", d.repository, tag, d.dstURL, d.dstUsr, err)
+			return "", err
+		}
+		deleted[digest] = true
+
+		d.logger.Infof("repository %s:%s on %s has been deleted", d.repository, tag, d.dstURL)
+	}
+
+	return models.JobFinished, nil
+}
+
+// filterTags selects the tags to delete by the tag filter. Only the tags matching the filter were
+// replicated, so when the whole repository is deleted, the tags of it on the destination registry
+// are listed and the matched ones are deleted rather than the repository.
+func (d *Deleter) filterTags() error {
+	if len(d.tagFilter) == 0 || d.filtered {
+		return nil
+	}
 
-			d.logger.Infof("repository %s:%s on %s has been deleted", d.repository, tag, d.dstURL)
+	tags := d.tags
+	if len(tags) == 0 {
+		dstClient, err := newRepositoryClient(d.dstURL, d.dstTransport, d.dstCred,
+			d.repository, "repository", d.repository, "pull")
+		if err != nil {
+			return err
 		}
 
-		return models.JobFinished, nil
-	*/
+		if tags, err = dstClient.ListTag(); err != nil {
+			if !isNotFoundErr(err) {
+				return err
+			}
+			d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
+			d.finished = true
+		}
+	}
+
+	d.filtered = true
+	d.tags = utils.FilterByPatterns(d.tagFilter, tags)
+	d.logger.Infof("tags matching the filter %q: %v", d.tagFilter, d.tags)
+	if len(d.tags) == 0 {
+		d.logger.Infof("no tag to delete")
+		d.finished = true
+	}
+	return nil
+}
+
+func isNotFoundErr(err error) bool {
+	regErr, ok := err.(*registry_error.Error)
+	return ok && regErr.StatusCode == http.StatusNotFound
 }
 
-func del(url, username, password string, insecure bool) error {
+func del(url string, cred auth.Credential, transport *http.Transport) error {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return err
 	}
 
-	req.SetBasicAuth(username, password)
+	cred.AddAuthorization(req)
 
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: insecure,
-			},
-		},
+		Transport: transport,
 	}
 
 	resp, err := client.Do(req)
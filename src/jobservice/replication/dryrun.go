@@ -0,0 +1,186 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+)
+
+// Diff compares the tags of the repository on the source registry with the ones on the
+// destination registry without transferring anything. The tags on the destination which
+// don't exist on the source are reported as deleted.
+func (b *BaseHandler) Diff() ([]*models.RepTagDiff, error) {
+	srcClient, err := newRepositoryClient(b.srcURL, b.srcTransport, b.srcCred,
+		b.srcRepository, "repository", b.srcRepository, "pull")
+	if err != nil {
+		return nil, err
+	}
+	b.srcClient = srcClient
+
+	dstClient, err := newRepositoryClient(b.dstURL, b.dstTransport, b.dstCred,
+		b.repository, "repository", b.repository, "pull")
+	if err != nil {
+		return nil, err
+	}
+	b.dstClient = dstClient
+
+	return b.diff()
+}
+
+func (b *BaseHandler) diff() ([]*models.RepTagDiff, error) {
+	var err error
+	srcTags := b.tags
+	if len(srcTags) == 0 {
+		if srcTags, err = b.srcClient.ListTag(); err != nil {
+			return nil, err
+		}
+	}
+	srcTags = utils.FilterByPatterns(b.tagFilter, srcTags)
+
+	dstTags, err := b.dstClient.ListTag()
+	if err != nil {
+		if !b.absentOnDst(err) {
+			return nil, err
+		}
+		dstTags = nil
+	}
+	dstTags = utils.FilterByPatterns(b.tagFilter, dstTags)
+
+	onDst := make(map[string]bool, len(dstTags))
+	for _, tag := range dstTags {
+		onDst[tag] = true
+	}
+
+	var diffs []*models.RepTagDiff
+	onSrc := make(map[string]bool, len(srcTags))
+	for _, tag := range srcTags {
+		srcDigest, exist, err := b.srcClient.ManifestExist(tag)
+		if err != nil {
+			return nil, err
+		}
+		// the tag is deleted after being listed
+		if !exist {
+			continue
+		}
+		onSrc[tag] = true
+
+		diff := &models.RepTagDiff{
+			Repository: b.repository,
+			Tag:        tag,
+			Action:     models.RepDiffCreate,
+			SrcDigest:  srcDigest,
+		}
+		if b.pull {
+			diff.SrcRepository = b.srcRepository
+		}
+		if onDst[tag] {
+			dstDigest, exist, err := b.dstClient.ManifestExist(tag)
+			if err != nil {
+				return nil, err
+			}
+			if exist {
+				diff.DstDigest = dstDigest
+				diff.Action = models.RepDiffUpdate
+				if dstDigest == srcDigest {
+					diff.Action = models.RepDiffSkip
+				}
+			}
+		}
+
+		if diff.Action != models.RepDiffSkip {
+			if diff.Size, err = b.estimateSize(tag); err != nil {
+				return nil, err
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+
+	for _, tag := range dstTags {
+		if onSrc[tag] {
+			continue
+		}
+		diffs = append(diffs, &models.RepTagDiff{
+			Repository: b.repository,
+			Tag:        tag,
+			Action:     models.RepDiffDelete,
+		})
+	}
+
+	return diffs, nil
+}
+
+// absentOnDst returns whether the error of listing tags on the destination means the repository
+// doesn't exist. Harbor grants no access to the projects which don't exist, so the status is
+// 401 rather than 404 for them.
+func (b *BaseHandler) absentOnDst(err error) bool {
+	regErr, ok := err.(*registry_error.Error)
+	if !ok {
+		return false
+	}
+	if regErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	return regErr.StatusCode == http.StatusUnauthorized && !b.pull && b.dstType == models.TargetTypeHarbor
+}
+
+// estimateSize returns the total size of the blobs of the tag which don't exist on the
+// destination, the blobs counted are marked existing so that they are counted once. The sizes
+// of the layers are unknown for schema1 manifests, so only the ones of schema2 are estimated.
+func (b *BaseHandler) estimateSize(tag string) (int64, error) {
+	acceptMediaTypes := []string{schema1.MediaTypeManifest, schema2.MediaTypeManifest}
+	_, mediaType, payload, err := b.srcClient.PullManifest(tag, acceptMediaTypes)
+	if err != nil {
+		return 0, err
+	}
+	if strings.Contains(mediaType, "application/json") {
+		mediaType = schema1.MediaTypeManifest
+	}
+	manifest, _, err := registry.UnMarshal(mediaType, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, descriptor := range manifest.References() {
+		sizes[descriptor.Digest.String()] = descriptor.Size
+	}
+	if manifest2, ok := manifest.(*schema2.DeserializedManifest); ok {
+		sizes[manifest2.Target().Digest.String()] = manifest2.Target().Size
+	}
+
+	var size int64
+	for blob, s := range sizes {
+		exist, ok := b.blobsExistence[blob]
+		if !ok {
+			if exist, err = b.dstClient.BlobExist(blob); err != nil {
+				return 0, err
+			}
+		}
+		if !exist {
+			size += s
+		}
+		b.blobsExistence[blob] = true
+	}
+	return size, nil
+}
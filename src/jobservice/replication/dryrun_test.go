@@ -0,0 +1,176 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/registry"
+)
+
+// newFakeRegistry serves the tags whose values are the digests of their manifests, and
+// the blobs whose values are the sizes of them
+func newFakeRegistry(repository string, tags map[string]string, blobs map[string]int64) *httptest.Server {
+	prefix := fmt.Sprintf("/v2/%s/", repository)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case path == "tags/list":
+			list := []string{}
+			for tag := range tags {
+				list = append(list, tag)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": list})
+		case strings.HasPrefix(path, "manifests/"):
+			digest, ok := tags[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Header().Set("Content-Type", schema2.MediaTypeManifest)
+			if r.Method == "HEAD" {
+				return
+			}
+			layers := []map[string]interface{}{}
+			for blob, size := range blobs {
+				layers = append(layers, map[string]interface{}{
+					"mediaType": schema2.MediaTypeLayer,
+					"digest":    blob,
+					"size":      size,
+				})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"schemaVersion": 2,
+				"mediaType":     schema2.MediaTypeManifest,
+				"config": map[string]interface{}{
+					"mediaType": schema2.MediaTypeConfig,
+					"digest":    "sha256:c",
+					"size":      1,
+				},
+				"layers": layers,
+			})
+		case strings.HasPrefix(path, "blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(path, "blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestDiff(t *testing.T) {
+	repository := "library/hello-world"
+	src := newFakeRegistry(repository,
+		map[string]string{"v1": "sha256:1", "v2": "sha256:2", "v3": "sha256:3", "dev": "sha256:4"},
+		map[string]int64{"sha256:a": 100, "sha256:b": 200})
+	defer src.Close()
+	dst := newFakeRegistry(repository,
+		map[string]string{"v1": "sha256:1", "v2": "sha256:old", "v0": "sha256:0"},
+		map[string]int64{"sha256:a": 100})
+	defer dst.Close()
+
+	srcClient, err := registry.NewRepository(repository, src.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create source client: %v", err)
+	}
+	dstClient, err := registry.NewRepository(repository, dst.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create destination client: %v", err)
+	}
+
+	b := &BaseHandler{
+		repository:     repository,
+		tagFilter:      "v*",
+		srcClient:      srcClient,
+		dstClient:      dstClient,
+		blobsExistence: map[string]bool{},
+	}
+
+	diffs, err := b.diff()
+	if err != nil {
+		t.Fatalf("failed to compare the repository: %v", err)
+	}
+
+	result := &models.RepDryRun{}
+	result.Add(diffs...)
+	actions := map[string]string{}
+	for _, d := range diffs {
+		actions[d.Tag] = d.Action
+	}
+	expected := map[string]string{
+		"v0": models.RepDiffDelete,
+		"v1": models.RepDiffSkip,
+		"v2": models.RepDiffUpdate,
+		"v3": models.RepDiffCreate,
+	}
+	if len(actions) != len(expected) {
+		t.Fatalf("unexpected differences: %v != %v", actions, expected)
+	}
+	for tag, action := range expected {
+		if actions[tag] != action {
+			t.Errorf("unexpected action of tag %s: %s != %s", tag, actions[tag], action)
+		}
+	}
+
+	// the blob sha256:b and the config are counted once for v2 and v3
+	if result.Created != 1 || result.Updated != 1 || result.Deleted != 1 || result.Skipped != 1 ||
+		result.EstimatedBytes != 201 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestDiffPull(t *testing.T) {
+	src := newFakeRegistry("remote/hello-world", map[string]string{"v1": "sha256:1"}, map[string]int64{})
+	defer src.Close()
+	dst := newFakeRegistry("library/hello-world", map[string]string{}, map[string]int64{})
+	defer dst.Close()
+
+	srcClient, err := registry.NewRepository("remote/hello-world", src.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create source client: %v", err)
+	}
+	dstClient, err := registry.NewRepository("library/hello-world", dst.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create destination client: %v", err)
+	}
+
+	b := &BaseHandler{
+		repository:     "library/hello-world",
+		srcRepository:  "remote/hello-world",
+		pull:           true,
+		srcClient:      srcClient,
+		dstClient:      dstClient,
+		blobsExistence: map[string]bool{},
+	}
+
+	diffs, err := b.diff()
+	if err != nil {
+		t.Fatalf("failed to compare the repository: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Repository != "library/hello-world" ||
+		diffs[0].SrcRepository != "remote/hello-world" {
+		t.Errorf("unexpected differences: %+v", diffs)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// Metrics collects the statistics of the transfer of a job, the blobs are transferred
+// concurrently so it is guarded by a lock.
+type Metrics struct {
+	sync.Mutex
+	blobsTransferred int
+	blobsSkipped     int
+	bytesTransferred int64
+	manifests        int
+	tagResults       map[string]string
+	// completed is set when tags or blobs complete or the upload sessions change, the metrics are
+	// saved as the checkpoint of the job
+	completed bool
+	// blobs are the digests of the blobs counted, a blob shared by several tags or transferred
+	// in several attempts of the job is counted once
+	blobs map[string]bool
+	// uploads are the locations of the upload sessions of the blobs being pushed, the key is the digest
+	uploads map[string]string
+}
+
+// NewMetrics returns a Metrics which starts from the statistics of the previous attempts of the job
+func NewMetrics(job *models.RepJob) *Metrics {
+	m := &Metrics{
+		tagResults: make(map[string]string),
+		blobs:      make(map[string]bool),
+		uploads:    make(map[string]string),
+	}
+	if job != nil {
+		m.blobsTransferred = job.BlobsTransferred
+		m.blobsSkipped = job.BlobsSkipped
+		m.bytesTransferred = job.BytesTransferred
+		m.manifests = job.Manifests
+		for tag, result := range job.TagResultMap {
+			m.tagResults[tag] = result
+		}
+		for _, digest := range job.BlobList {
+			m.blobs[digest] = true
+		}
+		for digest, location := range job.UploadMap {
+			m.uploads[digest] = location
+		}
+	}
+	return m
+}
+
+func (m *Metrics) blobTransferred(digest string) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.blobs[digest] {
+		m.blobs[digest] = true
+		m.blobsTransferred++
+		m.completed = true
+	}
+}
+
+func (m *Metrics) blobSkipped(digest string) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.blobs[digest] {
+		m.blobs[digest] = true
+		m.blobsSkipped++
+		m.completed = true
+	}
+}
+
+// uploadSession returns the location of the upload session of the blob saved in the checkpoint
+func (m *Metrics) uploadSession(digest string) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.uploads[digest]
+}
+
+// saveUploadSession records the location of the upload session of the blob, the location is
+// removed if it is empty
+func (m *Metrics) saveUploadSession(digest, location string) {
+	m.Lock()
+	defer m.Unlock()
+	if m.uploads[digest] == location {
+		return
+	}
+	if len(location) == 0 {
+		delete(m.uploads, digest)
+	} else {
+		m.uploads[digest] = location
+	}
+	m.completed = true
+}
+
+func (m *Metrics) bytesSent(n int64) {
+	m.Lock()
+	defer m.Unlock()
+	m.bytesTransferred += n
+}
+
+func (m *Metrics) manifestPushed() {
+	m.Lock()
+	defer m.Unlock()
+	m.manifests++
+}
+
+func (m *Metrics) tagDone(tag, result string) {
+	m.Lock()
+	defer m.Unlock()
+	m.tagResults[tag] = result
+	if result != models.TagResultRunning {
+		m.completed = true
+	}
+}
+
+// Checkpoint reports whether tags or blobs have completed or the upload sessions have changed since
+// the last call, if so the metrics should be saved so that the job resumes from the completed tags
+// and the upload sessions when it is interrupted.
+func (m *Metrics) Checkpoint() bool {
+	m.Lock()
+	defer m.Unlock()
+	completed := m.completed
+	m.completed = false
+	return completed
+}
+
+// remaining splits the tags into the ones to replicate and the ones completed in the previous
+// attempts of the job
+func (m *Metrics) remaining(tags []string) ([]string, []string) {
+	m.Lock()
+	defer m.Unlock()
+	var todo, done []string
+	for _, tag := range tags {
+		switch m.tagResults[tag] {
+		case models.TagResultTransferred, models.TagResultSkipped, models.TagResultNotFound:
+			done = append(done, tag)
+		default:
+			todo = append(todo, tag)
+		}
+	}
+	return todo, done
+}
+
+// Fill copies the statistics into the job. The tags still running when the job reaches
+// the final state are marked failed or stopped according to the state.
+func (m *Metrics) Fill(job *models.RepJob, state string) {
+	m.Lock()
+	defer m.Unlock()
+	for tag, result := range m.tagResults {
+		if result != models.TagResultRunning {
+			continue
+		}
+		switch state {
+		case models.JobError:
+			m.tagResults[tag] = models.TagResultFailed
+		case models.JobStopped:
+			m.tagResults[tag] = models.TagResultStopped
+		}
+	}
+
+	job.BlobsTransferred = m.blobsTransferred
+	job.BlobsSkipped = m.blobsSkipped
+	job.BytesTransferred = m.bytesTransferred
+	job.Manifests = m.manifests
+	job.TagResultMap = make(map[string]string, len(m.tagResults))
+	for tag, result := range m.tagResults {
+		job.TagResultMap[tag] = result
+	}
+	job.BlobList = make([]string, 0, len(m.blobs))
+	for digest := range m.blobs {
+		job.BlobList = append(job.BlobList, digest)
+	}
+	sort.Strings(job.BlobList)
+	job.UploadMap = make(map[string]string, len(m.uploads))
+	for digest, location := range m.uploads {
+		job.UploadMap[digest] = location
+	}
+}
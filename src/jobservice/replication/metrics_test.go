@@ -0,0 +1,113 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"testing"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(&models.RepJob{
+		BlobsTransferred: 1,
+		BytesTransferred: 100,
+		TagResultMap:     map[string]string{"v1": models.TagResultTransferred},
+	})
+
+	m.blobTransferred("sha256:a")
+	m.blobSkipped("sha256:a")
+	m.blobSkipped("sha256:b")
+	m.bytesSent(50)
+	m.manifestPushed()
+	m.tagDone("v2", models.TagResultTransferred)
+	m.tagDone("v3", models.TagResultRunning)
+
+	job := &models.RepJob{}
+	m.Fill(job, models.JobError)
+
+	if job.BlobsTransferred != 2 || job.BlobsSkipped != 1 || job.BytesTransferred != 150 || job.Manifests != 1 {
+		t.Errorf("unexpected metrics: %+v", job)
+	}
+	expected := map[string]string{
+		"v1": models.TagResultTransferred,
+		"v2": models.TagResultTransferred,
+		"v3": models.TagResultFailed,
+	}
+	if len(job.TagResultMap) != len(expected) {
+		t.Fatalf("unexpected results of tags: %v != %v", job.TagResultMap, expected)
+	}
+	for tag, result := range expected {
+		if job.TagResultMap[tag] != result {
+			t.Errorf("unexpected result of tag %s: %s != %s", tag, job.TagResultMap[tag], result)
+		}
+	}
+}
+
+func TestMetricsRetry(t *testing.T) {
+	m := NewMetrics(nil)
+	m.blobTransferred("sha256:a")
+	m.blobSkipped("sha256:b")
+	job := &models.RepJob{}
+	m.Fill(job, models.JobRetrying)
+	if len(job.BlobList) != 2 || job.BlobList[0] != "sha256:a" || job.BlobList[1] != "sha256:b" {
+		t.Fatalf("unexpected blobs: %v", job.BlobList)
+	}
+
+	// the blobs counted in the previous attempt are not counted again
+	m = NewMetrics(job)
+	m.blobSkipped("sha256:a")
+	m.blobSkipped("sha256:b")
+	m.blobSkipped("sha256:c")
+	m.Fill(job, models.JobFinished)
+	if job.BlobsTransferred != 1 || job.BlobsSkipped != 2 || len(job.BlobList) != 3 {
+		t.Errorf("unexpected metrics: %+v", job)
+	}
+}
+
+func TestMetricsCheckpoint(t *testing.T) {
+	m := NewMetrics(&models.RepJob{
+		TagResultMap: map[string]string{
+			"v1": models.TagResultTransferred,
+			"v2": models.TagResultSkipped,
+			"v3": models.TagResultFailed,
+			"v4": models.TagResultRunning,
+		},
+	})
+
+	todo, done := m.remaining([]string{"v1", "v2", "v3", "v4", "v5"})
+	if len(todo) != 3 || todo[0] != "v3" || todo[1] != "v4" || todo[2] != "v5" {
+		t.Errorf("unexpected tags to replicate: %v", todo)
+	}
+	if len(done) != 2 || done[0] != "v1" || done[1] != "v2" {
+		t.Errorf("unexpected tags completed: %v", done)
+	}
+
+	if m.Checkpoint() {
+		t.Errorf("no tag is completed, checkpoint is not needed")
+	}
+	m.tagDone("v3", models.TagResultRunning)
+	if m.Checkpoint() {
+		t.Errorf("the tag is running, checkpoint is not needed")
+	}
+	m.tagDone("v3", models.TagResultTransferred)
+	if !m.Checkpoint() {
+		t.Errorf("the tag is completed, checkpoint is needed")
+	}
+	if m.Checkpoint() {
+		t.Errorf("checkpoint is needed only once after the tag is completed")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"github.com/vmware/harbor/src/common/dao"
+)
+
+// maxMountCandidates is the max count of repositories on the destination registry tried
+// to mount a blob from
+const maxMountCandidates = 5
+
+// mountBlobs tries to mount the blobs from the repositories which have been replicated to the
+// destination registry, it returns the blobs which are not mounted and need to be transferred.
+func (b *BaseHandler) mountBlobs(blobs []string) []string {
+	// the blobs are pushed to the local registry when pulling, the repositories on which
+	// are not recorded as replicated
+	if len(blobs) == 0 || b.pull {
+		return blobs
+	}
+
+	if b.mountCandidates == nil {
+		candidates, err := dao.GetReplicatedRepositories(b.dstURL, b.repository, maxMountCandidates)
+		if err != nil {
+			b.logger.Warningf("failed to get the repositories replicated to %s, blobs will not be mounted: %v", b.dstURL, err)
+		}
+		b.mountCandidates = append([]string{}, candidates...)
+	}
+
+	if len(b.mountCandidates) == 0 {
+		return blobs
+	}
+
+	var left []string
+	var mounted int
+	var saved int64
+	for _, blob := range blobs {
+		from, ok := b.mountBlob(blob)
+		if !ok {
+			left = append(left, blob)
+			continue
+		}
+		mounted++
+		saved += b.blobSizes[blob]
+		b.metrics.blobSkipped(blob)
+		b.blobsExistence[blob] = true
+		b.logger.Infof("blob %s is mounted from %s on %s, %d bytes saved", blob, from, b.dstURL, b.blobSizes[blob])
+	}
+
+	if mounted > 0 {
+		b.logger.Infof("%d of %d blobs of %s are mounted on %s, %d bytes saved in total", mounted, len(blobs), b.repository, b.dstURL, saved)
+	}
+
+	return left
+}
+
+// mountBlob tries to mount the blob from the candidates one by one and returns the repository
+// the blob is mounted from
+func (b *BaseHandler) mountBlob(blob string) (string, bool) {
+	for i, from := range b.mountCandidates {
+		mounted, err := b.dstClient.MountBlob(blob, from)
+		if err != nil {
+			b.logger.Warningf("failed to mount blob %s from %s on %s: %v", blob, from, b.dstURL, err)
+			continue
+		}
+		if !mounted {
+			continue
+		}
+
+		// the blobs of an image are likely to be found in the same repository, so it is tried
+		// first for the following blobs
+		copy(b.mountCandidates[1:i+1], b.mountCandidates[:i])
+		b.mountCandidates[0] = from
+		return from, true
+	}
+	return "", false
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+)
+
+func TestMountBlobs(t *testing.T) {
+	repository := "library/hello-world"
+	// the blobs exist in the repository "library/base" on the destination registry
+	existing := map[string]bool{
+		"sha256:1": true,
+		"sha256:2": true,
+	}
+
+	mounts := 0
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			mounts++
+			if r.URL.Query().Get("from") == "library/base" && existing[r.URL.Query().Get("mount")] {
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/uuid")
+			w.WriteHeader(http.StatusAccepted)
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer dst.Close()
+
+	dstClient, err := registry.NewRepository(repository, dst.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("failed to create destination client: %v", err)
+	}
+
+	b := &BaseHandler{
+		repository:      repository,
+		dstURL:          dst.URL,
+		dstClient:       dstClient,
+		blobsExistence:  map[string]bool{},
+		blobSizes:       map[string]int64{"sha256:1": 100, "sha256:2": 200, "sha256:3": 300},
+		mountCandidates: []string{"library/other", "library/base"},
+		metrics:         NewMetrics(nil),
+		logger:          log.New(ioutil.Discard, log.NewTextFormatter(), log.DebugLevel),
+	}
+
+	left := b.mountBlobs([]string{"sha256:1", "sha256:2", "sha256:3"})
+	if len(left) != 1 || left[0] != "sha256:3" {
+		t.Errorf("unexpected blobs left: %v", left)
+	}
+
+	if !b.blobsExistence["sha256:1"] || !b.blobsExistence["sha256:2"] {
+		t.Errorf("the mounted blobs should be marked as existing: %v", b.blobsExistence)
+	}
+
+	// the repository which the first blob is mounted from is tried first for the others
+	if b.mountCandidates[0] != "library/base" {
+		t.Errorf("unexpected order of candidates: %v", b.mountCandidates)
+	}
+
+	// sha256:1 is tried from both candidates, sha256:2 once, sha256:3 from both
+	if mounts != 5 {
+		t.Errorf("unexpected count of mount requests: %d != 5", mounts)
+	}
+}
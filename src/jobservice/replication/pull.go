@@ -0,0 +1,54 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+)
+
+// InitPullBaseHandler initializes a BaseHandler which pulls the repository srcRepository from the
+// remote registry into the repository of the local registry. The handlers share the same logic
+// with pushing except that the source and destination are swapped.
+func InitPullBaseHandler(srcRepository, repository, remoteURL, remoteUsr, remotePwd,
+	localRegURL, localSecret string, insecure bool, tags []string, tagFilter string,
+	chunkSize int64, parallelBlobs int, bandwidth int64, logger *log.Logger) *BaseHandler {
+
+	base := InitBaseHandler(repository, remoteURL, "", localRegURL, "", "", models.TargetTypeHarbor, insecure, tags,
+		tagFilter, chunkSize, parallelBlobs, bandwidth, logger)
+	base.srcRepository = srcRepository
+	base.srcCred = auth.NewBasicAuthCredential(remoteUsr, remotePwd)
+	base.dstCred = auth.NewCookieCredential(&http.Cookie{Name: models.UISecretCookie, Value: localSecret})
+	base.pull = true
+
+	return base
+}
+
+// LocalRepository returns the name of the repository in the local project which the remote
+// repository is pulled into, the namespace of the remote repository is replaced with the
+// project, e.g. "library/ubuntu" is pulled into "project/ubuntu". The policies pulling the remote
+// repositories which differ only in the namespaces are refused as they would overwrite each other.
+func LocalRepository(project, remoteRepository string) string {
+	remoteRepository = strings.Trim(strings.TrimSpace(remoteRepository), "/")
+	if i := strings.Index(remoteRepository, "/"); i >= 0 {
+		remoteRepository = remoteRepository[i+1:]
+	}
+	return project + "/" + remoteRepository
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// the max size of a read from the rate limited reader, it keeps the waits short
+const maxLimitedRead = 32 * 1024
+
+// rateLimiter limits the rate of the bytes transferred, it is shared by all the transfers from or
+// to the same remote registry in the job service so that the limit applies to their sum
+type rateLimiter struct {
+	sync.Mutex
+	rate int64     // bytes per second
+	next time.Time // the time at which the next bytes can be transferred
+}
+
+var rateLimiters = struct {
+	sync.Mutex
+	limiters map[string]*rateLimiter
+}{limiters: make(map[string]*rateLimiter)}
+
+// getRateLimiter returns the limiter of the remote registry, the rate of the existing limiter
+// is updated as the limit of the target may have been changed
+func getRateLimiter(dstURL string, rate int64) *rateLimiter {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	l, ok := rateLimiters.limiters[dstURL]
+	if !ok {
+		l = &rateLimiter{}
+		rateLimiters.limiters[dstURL] = l
+	}
+	l.Lock()
+	l.rate = rate
+	l.Unlock()
+	return l
+}
+
+// wait blocks until the n bytes are allowed to be transferred
+func (l *rateLimiter) wait(n int) {
+	l.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// rateLimitedReader reads from the underlying reader at the rate of the limiter
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
+
+// limitRate returns a reader which reads at the bandwidth limit of the remote registry, the reader
+// itself is returned if there is no limit
+func (b *BaseHandler) limitRate(r io.Reader) io.Reader {
+	if b.bandwidth <= 0 {
+		return r
+	}
+	remote := b.dstURL
+	if b.pull {
+		remote = b.srcURL
+	}
+	return &rateLimitedReader{
+		r:       r,
+		limiter: getRateLimiter(remote, b.bandwidth),
+	}
+}
@@ -0,0 +1,52 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	b := &BaseHandler{
+		dstURL:    "http://rate.limited.registry",
+		bandwidth: 512 * 1024,
+	}
+
+	data := make([]byte, 256*1024)
+	start := time.Now()
+	read, err := ioutil.ReadAll(b.limitRate(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if len(read) != len(data) {
+		t.Errorf("unexpected length of data read: %d != %d", len(read), len(data))
+	}
+
+	// the first read is not delayed, the others take about half a second at the rate
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("unexpected time to read %d bytes at %d bytes/s: %v", len(data), b.bandwidth, elapsed)
+	}
+
+	b.bandwidth = 0
+	if r := bytes.NewReader(data); b.limitRate(r) != r {
+		t.Errorf("the reader should not be limited if there is no bandwidth limit")
+	}
+}
@@ -17,19 +17,21 @@ package replication
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
 	"github.com/vmware/harbor/src/common/utils/registry"
 	"github.com/vmware/harbor/src/common/utils/registry/auth"
@@ -55,19 +57,32 @@ var (
 
 // BaseHandler holds informations shared by other state handlers
 type BaseHandler struct {
-	project    string // project_name
-	repository string // prject_name/repo_name
-	tags       []string
+	project       string // project_name
+	repository    string // prject_name/repo_name
+	srcRepository string // name of the repository in source registry, it differs from repository when pulling
+	tags          []string
+	tagFilter     string // comma separated patterns of the tags to replicate
 
 	srcURL    string // url of source registry
 	srcSecret string
 
-	dstURL string // url of target registry
-	dstUsr string // username ...
-	dstPwd string // password ...
+	dstURL  string // url of target registry
+	dstUsr  string // username ...
+	dstType int    // type of target registry, a Harbor instance or a plain docker registry
+
+	srcCred auth.Credential
+	dstCred auth.Credential
+
+	// pull is true if the repository is pulled from the remote registry into the local one
+	pull bool
 
 	insecure bool // whether skip secure check when using https
 
+	// transports to the source and destination registries, the one to the target is built from
+	// the TLS options of the target
+	srcTransport *http.Transport
+	dstTransport *http.Transport
+
 	srcClient *registry.Repository
 	dstClient *registry.Repository
 
@@ -75,25 +90,52 @@ type BaseHandler struct {
 	digest   string                //digest of tags[0]'s manifest
 	blobs    []string              // blobs need to be transferred for tags[0]
 
-	blobsExistence map[string]bool //key: digest of blob, value: existence
+	blobsExistence map[string]bool  //key: digest of blob, value: existence
+	blobSizes      map[string]int64 //key: digest of blob, value: size in the manifest
+
+	// repositories on the destination registry tried to mount blobs from, nil if
+	// they haven't been loaded
+	mountCandidates []string
+
+	chunkSize     int64 // size of the chunks when pushing blobs
+	parallelBlobs int   // max count of blobs transferred at the same time
+	bandwidth     int64 // max rate in bytes per second of blob transfers to the destination, 0 means unlimited
+
+	// transferWindows are the time windows of the target in which the job transfers, the job
+	// is deferred between the tags and the blobs when it is out of the windows
+	transferWindows []utils.TimeWindow
+
+	metrics *Metrics
 
 	logger *log.Logger
 }
 
 // InitBaseHandler initializes a BaseHandler.
 func InitBaseHandler(repository, srcURL, srcSecret,
-	dstURL, dstUsr, dstPwd string, insecure bool, tags []string, logger *log.Logger) *BaseHandler {
+	dstURL, dstUsr, dstPwd string, dstType int, insecure bool, tags []string, tagFilter string,
+	chunkSize int64, parallelBlobs int, bandwidth int64, logger *log.Logger) *BaseHandler {
 
 	base := &BaseHandler{
 		repository:     repository,
+		srcRepository:  repository,
 		tags:           tags,
+		tagFilter:      tagFilter,
 		srcURL:         srcURL,
 		srcSecret:      srcSecret,
 		dstURL:         dstURL,
 		dstUsr:         dstUsr,
-		dstPwd:         dstPwd,
+		dstType:        dstType,
+		srcCred:        auth.NewCookieCredential(&http.Cookie{Name: models.UISecretCookie, Value: srcSecret}),
+		dstCred:        auth.NewBasicAuthCredential(dstUsr, dstPwd),
 		insecure:       insecure,
+		srcTransport:   registry.GetHTTPTransport(insecure),
+		dstTransport:   registry.GetHTTPTransport(insecure),
 		blobsExistence: make(map[string]bool, 10),
+		blobSizes:      make(map[string]int64, 10),
+		chunkSize:      chunkSize,
+		parallelBlobs:  parallelBlobs,
+		bandwidth:      bandwidth,
+		metrics:        NewMetrics(nil),
 		logger:         logger,
 	}
 
@@ -107,6 +149,44 @@ func (b *BaseHandler) Exit() error {
 	return nil
 }
 
+// SetTarget sets the credential and the transport used to connect to the target registry, which
+// is the destination when pushing and the source when pulling
+func (b *BaseHandler) SetTarget(cred auth.Credential, transport *http.Transport) {
+	if b.pull {
+		b.srcCred = cred
+		b.srcTransport = transport
+		return
+	}
+	b.dstCred = cred
+	b.dstTransport = transport
+}
+
+// SetLocalTransport sets the transport used to connect to the local registry, which is the source
+// when pushing and the destination when pulling
+func (b *BaseHandler) SetLocalTransport(transport *http.Transport) {
+	if b.pull {
+		b.dstTransport = transport
+		return
+	}
+	b.srcTransport = transport
+}
+
+// SetTransferWindows sets the time windows in which the job transfers
+func (b *BaseHandler) SetTransferWindows(windows []utils.TimeWindow) {
+	b.transferWindows = windows
+}
+
+// outOfTransferWindows reports whether the current time is out of the transfer windows, the
+// job should be deferred if so
+func (b *BaseHandler) outOfTransferWindows() bool {
+	return !utils.InTimeWindows(b.transferWindows, time.Now())
+}
+
+// SetMetrics sets the Metrics the statistics of the transfer are collected into
+func (b *BaseHandler) SetMetrics(m *Metrics) {
+	b.metrics = m
+}
+
 func getProjectName(repository string) string {
 	repository = strings.TrimSpace(repository)
 	repository = strings.TrimRight(repository, "/")
@@ -134,18 +214,15 @@ func (i *Initializer) Enter() (string, error) {
 }
 
 func (i *Initializer) enter() (string, error) {
-	c := &http.Cookie{Name: models.UISecretCookie, Value: i.srcSecret}
-	srcCred := auth.NewCookieCredential(c)
-	srcClient, err := newRepositoryClient(i.srcURL, i.insecure, srcCred,
-		i.repository, "repository", i.repository, "pull", "push", "*")
+	srcClient, err := newRepositoryClient(i.srcURL, i.srcTransport, i.srcCred,
+		i.srcRepository, "repository", i.srcRepository, "pull", "push", "*")
 	if err != nil {
 		i.logger.Errorf("an error occurred while creating source repository client: %v", err)
 		return "", err
 	}
 	i.srcClient = srcClient
 
-	dstCred := auth.NewBasicAuthCredential(i.dstUsr, i.dstPwd)
-	dstClient, err := newRepositoryClient(i.dstURL, i.insecure, dstCred,
+	dstClient, err := newRepositoryClient(i.dstURL, i.dstTransport, i.dstCred,
 		i.repository, "repository", i.repository, "pull", "push", "*")
 	if err != nil {
 		i.logger.Errorf("an error occurred while creating destination repository client: %v", err)
@@ -162,9 +239,26 @@ func (i *Initializer) enter() (string, error) {
 		i.tags = tags
 	}
 
+	if len(i.tagFilter) != 0 {
+		tags := utils.FilterByPatterns(i.tagFilter, i.tags)
+		i.logger.Infof("tags matching the filter %q: %v", i.tagFilter, tags)
+		i.tags = tags
+	}
+
+	if tags, done := i.metrics.remaining(i.tags); len(done) > 0 {
+		i.logger.Infof("resuming from the checkpoint, tags replicated in previous attempts: %v", done)
+		i.tags = tags
+	}
+
 	i.logger.Infof("initialization completed: project: %s, repository: %s, tags: %v, source URL: %s, destination URL: %s, insecure: %v, destination user: %s",
 		i.project, i.repository, i.tags, i.srcURL, i.dstURL, i.insecure, i.dstUsr)
 
+	// the local project needn't to be checked when pulling
+	if i.pull {
+		i.logger.Infof("pulling %s from %s into %s", i.srcRepository, i.srcURL, i.repository)
+		return StatePullManifest, nil
+	}
+
 	return StateCheck, nil
 }
 
@@ -186,6 +280,13 @@ func (c *Checker) Enter() (string, error) {
 }
 
 func (c *Checker) enter() (string, error) {
+	// there is no project on a plain docker registry, the namespace of the
+	// repository is created when the manifest is pushed
+	if c.dstType == models.TargetTypeRegistry {
+		c.logger.Infof("%s is a docker registry, skip creating project %s", c.dstURL, c.project)
+		return StatePullManifest, nil
+	}
+
 	project, err := dao.GetProjectByName(c.project)
 	if err != nil {
 		c.logger.Errorf("an error occurred while getting project %s in DB: %v", c.project, err)
@@ -231,14 +332,10 @@ func (c *Checker) createProject(public int) error {
 		return err
 	}
 
-	req.SetBasicAuth(c.dstUsr, c.dstPwd)
+	c.dstCred.AddAuthorization(req)
 
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: c.insecure,
-			},
-		},
+		Transport: c.dstTransport,
 	}
 
 	resp, err := client.Do(req)
@@ -291,8 +388,14 @@ func (m *ManifestPuller) enter() (string, error) {
 		return models.JobFinished, nil
 	}
 
+	if m.outOfTransferWindows() {
+		m.logger.Infof("out of the transfer windows, the job is deferred before replicating tags: %v", m.tags)
+		return models.JobPending, nil
+	}
+
 	name := m.repository
 	tag := m.tags[0]
+	m.metrics.tagDone(tag, models.TagResultRunning)
 
 	acceptMediaTypes := []string{schema1.MediaTypeManifest, schema2.MediaTypeManifest}
 	digest, mediaType, payload, err := m.srcClient.PullManifest(tag, acceptMediaTypes)
@@ -320,17 +423,26 @@ func (m *ManifestPuller) enter() (string, error) {
 
 	for _, discriptor := range manifest.References() {
 		blobs = append(blobs, discriptor.Digest.String())
+		m.blobSizes[discriptor.Digest.String()] = discriptor.Size
 	}
 
 	// config is also need to be transferred if the schema of manifest is v2
 	manifest2, ok := manifest.(*schema2.DeserializedManifest)
 	if ok {
 		blobs = append(blobs, manifest2.Target().Digest.String())
+		m.blobSizes[manifest2.Target().Digest.String()] = manifest2.Target().Size
 	}
 
 	m.logger.Infof("all blobs of %s:%s from %s: %v", name, tag, m.srcURL, blobs)
 
+	// a blob may be referenced more than once, e.g. the identical layers, it is transferred once
+	queued := make(map[string]bool, len(blobs))
 	for _, blob := range blobs {
+		if queued[blob] {
+			continue
+		}
+		queued[blob] = true
+
 		exist, ok := m.blobsExistence[blob]
 		if !ok {
 			exist, err = m.dstClient.BlobExist(blob)
@@ -344,6 +456,7 @@ func (m *ManifestPuller) enter() (string, error) {
 		if !exist {
 			m.blobs = append(m.blobs, blob)
 		} else {
+			m.metrics.blobSkipped(blob)
 			m.logger.Infof("blob %s of %s:%s already exists in %s", blob, name, tag, m.dstURL)
 		}
 	}
@@ -372,21 +485,72 @@ func (b *BlobTransfer) Enter() (string, error) {
 func (b *BlobTransfer) enter() (string, error) {
 	name := b.repository
 	tag := b.tags[0]
+
+	// the blobs mounted from other repositories on the destination registry needn't to be transferred
+	b.blobs = b.mountBlobs(b.blobs)
+
+	parallel := b.parallelBlobs
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	blobs := make(chan string)
+	errs := make(chan error, len(b.blobs))
+	transferred := make(chan string, len(b.blobs))
+	wg := &sync.WaitGroup{}
+	for i := 0; i < parallel && i < len(b.blobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for blob := range blobs {
+				b.logger.Infof("transferring blob %s of %s:%s to %s ...", blob, name, tag, b.dstURL)
+				if err := b.transferBlob(blob); err != nil {
+					b.logger.Errorf("an error occurred while transferring blob %s of %s:%s to %s: %v", blob, name, tag, b.dstURL, err)
+					errs <- err
+					continue
+				}
+				b.metrics.blobTransferred(blob)
+				transferred <- blob
+				b.logger.Infof("blob %s of %s:%s transferred to %s completed", blob, name, tag, b.dstURL)
+			}
+		}()
+	}
+
+	// the blobs are not dispatched any more when it is out of the transfer windows, the ones being
+	// transferred are completed
+	deferred := false
 	for _, blob := range b.blobs {
-		b.logger.Infof("transferring blob %s of %s:%s to %s ...", blob, name, tag, b.dstURL)
-		size, data, err := b.srcClient.PullBlob(blob)
-		if err != nil {
-			b.logger.Errorf("an error occurred while pulling blob %s of %s:%s from %s: %v", blob, name, tag, b.srcURL, err)
-			return "", err
-		}
-		if data != nil {
-			defer data.Close()
+		if b.outOfTransferWindows() {
+			deferred = true
+			break
 		}
-		if err = b.dstClient.PushBlob(blob, size, data); err != nil {
-			b.logger.Errorf("an error occurred while pushing blob %s of %s:%s to %s : %v", blob, name, tag, b.dstURL, err)
-			return "", err
+		blobs <- blob
+	}
+	close(blobs)
+	wg.Wait()
+	close(errs)
+	close(transferred)
+
+	// the blobs transferred needn't to be checked again for the following tags
+	for blob := range transferred {
+		b.blobsExistence[blob] = true
+	}
+
+	// the job is retried if any of the errors can be recovered by retrying, the
+	// uploads of the blobs are resumed then
+	var err error
+	for e := range errs {
+		if err == nil || retry(e) {
+			err = e
 		}
-		b.logger.Infof("blob %s of %s:%s transferred to %s completed", blob, name, tag, b.dstURL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if deferred {
+		b.logger.Infof("out of the transfer windows, the job is deferred while transferring the blobs of %s:%s", name, tag)
+		return models.JobPending, nil
 	}
 
 	return StatePushManifest, nil
@@ -421,12 +585,14 @@ func (m *ManifestPusher) enter() (string, error) {
 	}
 	if !exist {
 		m.logger.Infof("manifest of %s:%s does not exist on source registry %s, cancel manifest pushing", name, tag, m.srcURL)
+		m.metrics.tagDone(tag, models.TagResultNotFound)
 	} else {
 		m.logger.Infof("manifest of %s:%s exists on source registry %s, continue manifest pushing", name, tag, m.srcURL)
 
 		digest, manifestExist, err := m.dstClient.ManifestExist(tag)
 		if manifestExist && digest == m.digest {
 			m.logger.Infof("manifest of %s:%s exists on destination registry %s, skip manifest pushing", name, tag, m.dstURL)
+			m.metrics.tagDone(tag, models.TagResultSkipped)
 
 			m.tags = m.tags[1:]
 			m.manifest = nil
@@ -447,6 +613,8 @@ func (m *ManifestPusher) enter() (string, error) {
 			return "", err
 		}
 		m.logger.Infof("manifest of %s:%s has been pushed to %s", name, tag, m.dstURL)
+		m.metrics.manifestPushed()
+		m.metrics.tagDone(tag, models.TagResultTransferred)
 	}
 
 	m.tags = m.tags[1:]
@@ -457,33 +625,23 @@ func (m *ManifestPusher) enter() (string, error) {
 	return StatePullManifest, nil
 }
 
-func newRepositoryClient(endpoint string, insecure bool, credential auth.Credential, repository, scopeType, scopeName string,
+func newRepositoryClient(endpoint string, transport *http.Transport, credential auth.Credential, repository, scopeType, scopeName string,
 	scopeActions ...string) (*registry.Repository, error) {
 
-	authorizer := auth.NewStandardTokenAuthorizer(credential, insecure, scopeType, scopeName, scopeActions...)
+	authorizer := auth.NewCredentialAuthorizer(credential, transport, scopeType, scopeName, scopeActions...)
 
-	store, err := auth.NewAuthorizerStore(endpoint, insecure, authorizer)
+	store, err := auth.NewAuthorizerStoreWithTransport(endpoint, transport, authorizer)
 	if err != nil {
 		return nil, err
 	}
 
-	uam := &userAgentModifier{
-		userAgent: "harbor-registry-client",
+	uam := &registry.UserAgentModifier{
+		UserAgent: "harbor-registry-client",
 	}
 
-	client, err := registry.NewRepositoryWithModifiers(repository, endpoint, insecure, store, uam)
+	client, err := registry.NewRepositoryWithTransport(repository, endpoint, transport, store, uam)
 	if err != nil {
 		return nil, err
 	}
 	return client, nil
 }
-
-type userAgentModifier struct {
-	userAgent string
-}
-
-// Modify adds user-agent header to the request
-func (u *userAgentModifier) Modify(req *http.Request) error {
-	req.Header.Set(http.CanonicalHeaderKey("User-Agent"), u.userAgent)
-	return nil
-}
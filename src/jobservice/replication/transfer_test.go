@@ -0,0 +1,49 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+func TestManifestPullerOutOfTransferWindows(t *testing.T) {
+	now := time.Now()
+	minute := now.Hour()*60 + now.Minute()
+	// the window starts in an hour and lasts for an hour
+	windows := []utils.TimeWindow{{Start: (minute + 60) % 1440, End: (minute + 120) % 1440}}
+
+	b := &BaseHandler{
+		repository: "library/hello-world",
+		tags:       []string{"latest"},
+		metrics:    NewMetrics(nil),
+		logger:     log.New(ioutil.Discard, log.NewTextFormatter(), log.DebugLevel),
+	}
+	b.SetTransferWindows(windows)
+	m := &ManifestPuller{BaseHandler: b}
+	state, err := m.Enter()
+	if err != nil || state != models.JobPending {
+		t.Errorf("the job out of the transfer windows should be deferred: %s, %v", state, err)
+	}
+	if _, ok := b.metrics.tagResults["latest"]; ok {
+		t.Errorf("the tag should not be started out of the transfer windows")
+	}
+}
@@ -23,6 +23,15 @@ import (
 
 func initRouters() {
 	beego.Router("/api/jobs/replication", &api.ReplicationJob{})
-	beego.Router("/api/jobs/replication/:id/log", &api.ReplicationJob{}, "get:GetLog")
+	beego.Router("/api/jobs/replication/:id/log", &api.ReplicationJob{}, "get:GetLog;delete:DeleteLog")
 	beego.Router("/api/jobs/replication/actions", &api.ReplicationJob{}, "post:HandleAction")
+	beego.Router("/api/jobs/replication/queue", &api.ReplicationJob{}, "get:GetQueue")
+	beego.Router("/api/jobs/replication/dryrun", &api.ReplicationJob{}, "get:DryRun")
+	beego.Router("/api/jobs/replication/verify", &api.ReplicationJob{}, "post:Verify")
+	beego.Router("/api/jobs/workers", &api.WorkerAPI{}, "get:List;put:Resize")
+	beego.Router("/api/jobs/workers/:id([0-9]+)/stop", &api.WorkerAPI{}, "post:StopWorker")
+	beego.Router("/api/jobs", &api.JobAPI{})
+	beego.Router("/api/jobs/:id([0-9]+)", &api.JobAPI{})
+	beego.Router("/api/jobs/:id([0-9]+)/stop", &api.JobAPI{}, "post:Stop")
+	beego.Router("/api/jobs/:id([0-9]+)/log", &api.ReplicationJob{}, "get:GetLog")
 }
@@ -0,0 +1,109 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrConnTrackerClosed is returned when dialing with the transports of a closed ConnTracker
+var ErrConnTrackerClosed = errors.New("the connections of the job are closed")
+
+// ConnTracker tracks the connections dialed by the transports of a job, so that the requests in
+// flight are aborted by closing the connections, e.g. when the job is stopped.
+type ConnTracker struct {
+	sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// NewConnTracker returns a ConnTracker
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Transport returns a transport with the TLS options of t whose connections are tracked
+func (c *ConnTracker) Transport(t *http.Transport) *http.Transport {
+	return &http.Transport{
+		Proxy:               t.Proxy,
+		TLSClientConfig:     t.TLSClientConfig,
+		TLSHandshakeTimeout: t.TLSHandshakeTimeout,
+		Dial:                c.dial,
+	}
+}
+
+func (c *ConnTracker) dial(network, addr string) (net.Conn, error) {
+	if c.isClosed() {
+		return nil, ErrConnTrackerClosed
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	conn, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		conn.Close()
+		return nil, ErrConnTrackerClosed
+	}
+	c.conns[conn] = struct{}{}
+	return &trackedConn{Conn: conn, tracker: c}, nil
+}
+
+func (c *ConnTracker) isClosed() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.closed
+}
+
+func (c *ConnTracker) remove(conn net.Conn) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.conns, conn)
+}
+
+// Close closes the connections, the requests in flight fail and the following ones are rejected
+func (c *ConnTracker) Close() {
+	c.Lock()
+	defer c.Unlock()
+	c.closed = true
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = make(map[net.Conn]struct{})
+}
+
+// trackedConn is removed from the tracker when it is closed
+type trackedConn struct {
+	net.Conn
+	tracker *ConnTracker
+}
+
+func (t *trackedConn) Close() error {
+	t.tracker.remove(t.Conn)
+	return t.Conn.Close()
+}
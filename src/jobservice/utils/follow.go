@@ -0,0 +1,115 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// LogFollower reads the lines appended to a log file since the last read, the file
+// may be created after the follower. The compressed log is read if the job is finished
+// and its log has been compressed.
+type LogFollower struct {
+	path    string
+	file    *os.File
+	reader  io.Reader
+	partial []byte
+}
+
+// NewLogFollower returns a follower of the log file
+func NewLogFollower(path string) *LogFollower {
+	return &LogFollower{path: path}
+}
+
+// ReadLines returns the complete lines appended since the last read without the line
+// breaks, the incomplete last line is kept until it is completed or flushed by Flush.
+func (f *LogFollower) ReadLines() ([]string, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil || f.file == nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.reader.Read(buf)
+		f.partial = append(f.partial, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lines := []string{}
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(bytes.TrimSuffix(f.partial[:i], []byte("\r"))))
+		f.partial = f.partial[i+1:]
+	}
+	return lines, nil
+}
+
+// open opens the plain log, or the compressed one if the plain log doesn't exist, the file
+// is nil if neither exists
+func (f *LogFollower) open() error {
+	file, err := os.Open(f.path)
+	if err == nil {
+		f.file, f.reader = file, file
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err = os.Open(f.path + compressedLogSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.reader = file, zr
+	return nil
+}
+
+// Flush returns the incomplete last line, it should be called when the log file will not
+// be written any more.
+func (f *LogFollower) Flush() string {
+	line := string(f.partial)
+	f.partial = nil
+	return line
+}
+
+// Close closes the log file
+func (f *LogFollower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
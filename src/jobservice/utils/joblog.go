@@ -0,0 +1,281 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// the suffix of the logs of the finished jobs, which are compressed with gzip
+const compressedLogSuffix = ".gz"
+
+var jobLogName = regexp.MustCompile(`^job_([0-9]+)\.log(\.gz)?$`)
+
+// CompressJobLog compresses the log of the job with gzip when the job reaches a final state,
+// the plain log is removed after it is compressed.
+func CompressJobLog(jobID int64) error {
+	path := GetJobLogPath(jobID)
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + compressedLogSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+compressedLogSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// DeleteJobLog removes the plain and the compressed logs of the job
+func DeleteJobLog(jobID int64) error {
+	path := GetJobLogPath(jobID)
+	for _, p := range []string{path, path + compressedLogSuffix} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobLog is the content of the log of a job, it supports seeking so that ranges of the log
+// can be served.
+type JobLog struct {
+	io.ReadSeeker
+	// Name is the name of the plain log and ModTime is the time the log is modified
+	Name    string
+	ModTime time.Time
+	file    *os.File
+	// tmp is the file the compressed log is decompressed into, it is removed when closed
+	tmp *os.File
+}
+
+// Close closes the log file
+func (l *JobLog) Close() error {
+	if l.tmp != nil {
+		l.tmp.Close()
+		os.Remove(l.tmp.Name())
+	}
+	return l.file.Close()
+}
+
+// OpenJobLog opens the log of the job, the compressed log is decompressed into a temporary file
+// so that it is not held in memory. The error satisfies os.IsNotExist if the job has no log.
+func OpenJobLog(jobID int64) (*JobLog, error) {
+	path := GetJobLogPath(jobID)
+	compressed := false
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		compressed = true
+		f, err = os.Open(path + compressedLogSuffix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l := &JobLog{
+		ReadSeeker: f,
+		Name:       filepath.Base(path),
+		ModTime:    info.ModTime(),
+		file:       f,
+	}
+	if compressed {
+		if l.tmp, err = decompress(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		l.ReadSeeker = l.tmp
+	}
+	return l, nil
+}
+
+// decompress decompresses the gzip content into a temporary file, the file is positioned at
+// the beginning.
+func decompress(r io.Reader) (*os.File, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile("", "job_log_")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(tmp, zr); err == nil {
+		_, err = tmp.Seek(0, os.SEEK_SET)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// TailLines returns the last n lines of the content, or the whole content if it has no more than
+// n lines. The content is read backwards from the end in chunks.
+func TailLines(r io.ReadSeeker, n int) ([]byte, error) {
+	pos, err := r.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	for pos > 0 {
+		size := int64(32 * 1024)
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		chunk := make([]byte, size)
+		if _, err = r.Seek(pos, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+		if start := lastLinesStart(buf, n); start >= 0 {
+			return buf[start:], nil
+		}
+	}
+	return buf, nil
+}
+
+// lastLinesStart returns the index in buf where the last n lines start, or -1 if buf doesn't
+// contain n complete lines, the line break at the end of buf is not counted.
+func lastLinesStart(buf []byte, n int) int {
+	end := len(buf)
+	if end > 0 && buf[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if buf[i] != '\n' {
+			continue
+		}
+		if n--; n == 0 {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+type logFile struct {
+	path    string
+	jobID   int64
+	size    int64
+	modTime time.Time
+}
+
+// logFiles are sorted by the modification time
+type logFiles []logFile
+
+func (l logFiles) Len() int           { return len(l) }
+func (l logFiles) Less(i, j int) bool { return l[i].modTime.Before(l[j].modTime) }
+func (l logFiles) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// CleanJobLogs removes the logs under the directory which are modified more than maxAge ago, and
+// then the oldest ones until the total size is no more than maxSize, zero maxAge or maxSize means
+// no limit. The logs modified within activeWithin may be written by running jobs and are kept, so
+// are the logs of the unfinished jobs, e.g. the ones waiting to be retried. The count of the logs
+// removed is returned.
+func CleanJobLogs(dir string, maxAge time.Duration, maxSize int64, activeWithin time.Duration,
+	unfinished map[int64]bool) (int, error) {
+	var files logFiles
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Warningf("Failed to access %s, error: %v", path, err)
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		m := jobLogName.FindStringSubmatch(info.Name())
+		if m == nil {
+			return nil
+		}
+		jobID, _ := strconv.ParseInt(m[1], 10, 64)
+		files = append(files, logFile{
+			path:    path,
+			jobID:   jobID,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Sort(files)
+
+	now := time.Now()
+	removed := 0
+	for _, f := range files {
+		if now.Sub(f.modTime) < activeWithin {
+			break
+		}
+		expired := maxAge > 0 && now.Sub(f.modTime) > maxAge
+		oversize := maxSize > 0 && total > maxSize
+		if !expired && !oversize {
+			break
+		}
+		if unfinished[f.jobID] {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Errorf("Failed to remove log %s, error: %v", f.path, err)
+			continue
+		}
+		total -= f.size
+		removed++
+	}
+	return removed, nil
+}
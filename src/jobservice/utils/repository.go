@@ -0,0 +1,147 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	u "github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/replication"
+)
+
+// ListPolicyRepositories returns the repositories replicated by the policy which match its
+// repository filter: the ones of the local project when pushing, and the ones in the catalog
+// of the target when pulling
+func ListPolicyRepositories(policy *models.RepPolicy) ([]string, error) {
+	var repositories []string
+	var err error
+	if policy.Mode == models.RepModePull {
+		repositories, err = getRemoteRepoList(policy.TargetID)
+	} else {
+		repositories, err = GetRepoList(policy.ProjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repositories = u.FilterByPatterns(policy.RepoFilter, repositories)
+	if policy.Mode == models.RepModePull {
+		if err = checkPullCollisions(repositories); err != nil {
+			return nil, fmt.Errorf("policy %d: %v", policy.ID, err)
+		}
+	}
+	return repositories, nil
+}
+
+// checkPullCollisions returns an error if any of the remote repositories are pulled into the same
+// local repository, the namespaces of them are replaced with the local project so that e.g.
+// "a/ubuntu" and "b/ubuntu" would overwrite the tags of each other
+func checkPullCollisions(repositories []string) error {
+	pulledFrom := make(map[string]string, len(repositories))
+	for _, repository := range repositories {
+		local := replication.LocalRepository("", repository)
+		if other, ok := pulledFrom[local]; ok {
+			return fmt.Errorf("repositories %s and %s on the target are pulled into the same repository %s of the project",
+				other, repository, strings.TrimPrefix(local, "/"))
+		}
+		pulledFrom[local] = repository
+	}
+	return nil
+}
+
+// getRemoteRepoList lists the repositories in the catalog of the target
+func getRemoteRepoList(targetID int64) ([]string, error) {
+	target, err := dao.GetRepTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("target %d not found", targetID)
+	}
+
+	credential, transport, err := TargetConnection(target)
+	if err != nil {
+		return nil, err
+	}
+	authorizer := auth.NewCredentialAuthorizer(credential, transport, "registry", "catalog", "*")
+	store, err := auth.NewAuthorizerStoreWithTransport(target.URL, transport, authorizer)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := registry.NewRegistryWithTransport(target.URL, transport, store)
+	if err != nil {
+		return nil, err
+	}
+	return client.Catalog()
+}
+
+// GetRepoList calls the api from UI to get the repositories of the project
+func GetRepoList(projectID int64) ([]string, error) {
+	repositories := []string{}
+
+	client := &http.Client{}
+	uiURL := config.LocalUIURL()
+	next := "/api/repositories?project_id=" + strconv.Itoa(int(projectID))
+	for len(next) != 0 {
+		req, err := http.NewRequest("GET", uiURL+next, nil)
+		if err != nil {
+			return repositories, err
+		}
+
+		req.AddCookie(&http.Cookie{Name: models.UISecretCookie, Value: config.UISecret()})
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return repositories, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			dump, _ := httputil.DumpResponse(resp, true)
+			log.Debugf("response: %q", dump)
+			return repositories, fmt.Errorf("Unexpected status code when getting repository list: %d", resp.StatusCode)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return repositories, err
+		}
+
+		var list []string
+		if err = json.Unmarshal(body, &list); err != nil {
+			return repositories, err
+		}
+
+		repositories = append(repositories, list...)
+
+		links := u.ParseLink(resp.Header.Get(http.CanonicalHeaderKey("link")))
+		next = links.Next()
+	}
+
+	return repositories, nil
+}
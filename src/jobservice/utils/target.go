@@ -0,0 +1,70 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vmware/harbor/src/common/models"
+	u "github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	"github.com/vmware/harbor/src/jobservice/config"
+)
+
+// TargetConnection returns the credential and the transport to connect to the target according to
+// its credential type and TLS options, the encrypted secrets of the target are decrypted. The
+// certificate of the target isn't verified if the target is insecure or the verification of remote
+// certificates is disabled globally.
+func TargetConnection(target *models.RepTarget) (auth.Credential, *http.Transport, error) {
+	decrypt := func(name, value string) (string, error) {
+		if len(value) == 0 {
+			return "", nil
+		}
+		v, err := u.ReversibleDecrypt(value, config.SecretKey())
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt %s of target %d: %v", name, target.ID, err)
+		}
+		return v, nil
+	}
+
+	var credential auth.Credential
+	if target.CredentialType == models.TargetCredentialBearer {
+		token, err := decrypt("token", target.Token)
+		if err != nil {
+			return nil, nil, err
+		}
+		credential = auth.NewBearerTokenCredential(token)
+	} else {
+		pwd, err := decrypt("password", target.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+		credential = auth.NewBasicAuthCredential(target.Username, pwd)
+	}
+
+	key, err := decrypt("client key", target.ClientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	insecure := target.Insecure == 1 || !config.VerifyRemoteCert()
+	transport, err := registry.GetTargetHTTPTransport(target.ID, insecure, target.CACert, target.ClientCert, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid TLS options of target %d: %v", target.ID, err)
+	}
+	return credential, transport, nil
+}
@@ -1,9 +1,306 @@
 package utils
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	u "github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/jobservice/config"
 )
 
 func TestMain(t *testing.T) {
 }
 
+func TestLogFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.log")
+	follower := NewLogFollower(path)
+	defer follower.Close()
+
+	// the log file does not exist yet
+	lines, err := follower.ReadLines()
+	if err != nil || len(lines) != 0 {
+		t.Fatalf("unexpected lines before the log file is created: %v, error: %v", lines, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("failed to create log file: %v", err)
+	}
+	defer f.Close()
+
+	f.WriteString("line 1\nline 2\nline")
+	if lines, err = follower.ReadLines(); err != nil {
+		t.Fatalf("failed to read lines: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"line 1", "line 2"}) {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+
+	f.WriteString(" 3\nline 4")
+	if lines, err = follower.ReadLines(); err != nil {
+		t.Fatalf("failed to read lines: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"line 3"}) {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+
+	if line := follower.Flush(); line != "line 4" {
+		t.Errorf("unexpected incomplete line: %s", line)
+	}
+}
+
+func TestLogFollowerCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.log")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("line 1\nline 2"))
+	zw.Close()
+	if err = ioutil.WriteFile(path+compressedLogSuffix, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write compressed log: %v", err)
+	}
+
+	follower := NewLogFollower(path)
+	defer follower.Close()
+	lines, err := follower.ReadLines()
+	if err != nil {
+		t.Fatalf("failed to read lines: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"line 1"}) {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+	if line := follower.Flush(); line != "line 2" {
+		t.Errorf("unexpected incomplete line: %s", line)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	long := strings.Repeat("x", 40*1024)
+	cases := []struct {
+		content  string
+		n        int
+		expected string
+	}{
+		{"", 2, ""},
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"a\n" + long + "\nb\n", 2, long + "\nb\n"},
+	}
+	for _, c := range cases {
+		b, err := TailLines(strings.NewReader(c.content), c.n)
+		if err != nil {
+			t.Fatalf("failed to read the last %d lines of %q: %v", c.n, c.content, err)
+		}
+		if string(b) != c.expected {
+			t.Errorf("unexpected last %d lines of %.10q: %.10q != %.10q", c.n, c.content, string(b), c.expected)
+		}
+	}
+}
+
+func TestOpenJobLogCompressed(t *testing.T) {
+	var jobID int64 = 1000001
+	path := GetJobLogPath(jobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("failed to create directory of log: %v", err)
+	}
+	defer DeleteJobLog(jobID)
+	content := "line 1\nline 2\nline 3\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+	if err := CompressJobLog(jobID); err != nil {
+		t.Fatalf("failed to compress log: %v", err)
+	}
+
+	l, err := OpenJobLog(jobID)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	b, err := TailLines(l, 2)
+	if err != nil {
+		t.Fatalf("failed to read the last lines of log: %v", err)
+	}
+	if string(b) != "line 2\nline 3\n" {
+		t.Errorf("unexpected last lines: %q", string(b))
+	}
+	if _, err = l.Seek(0, os.SEEK_SET); err != nil {
+		t.Fatalf("failed to seek log: %v", err)
+	}
+	if b, err = ioutil.ReadAll(l); err != nil || string(b) != content {
+		t.Errorf("unexpected content of log: %q, %v", string(b), err)
+	}
+
+	tmp := l.tmp.Name()
+	l.Close()
+	if _, err = os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("the decompressed log should be removed when closed: %v", err)
+	}
+}
+
+func TestCleanJobLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	logs := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"job_1.log.gz", 10 * 24 * time.Hour},
+		{"job_2.log.gz", 3 * 24 * time.Hour},
+		{"job_3.log", 2 * 24 * time.Hour},
+		{"job_4.log", time.Minute},
+		{"other.log", 10 * 24 * time.Hour},
+	}
+	for _, l := range logs {
+		path := filepath.Join(dir, "1", l.name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err = ioutil.WriteFile(path, make([]byte, 100), 0600); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+		mtime := now.Add(-l.age)
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("failed to change time of log: %v", err)
+		}
+	}
+	exist := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, "1", name))
+		return err == nil
+	}
+
+	// job_1 is expired
+	if n, err := CleanJobLogs(dir, 7*24*time.Hour, 0, time.Hour, nil); err != nil || n != 1 {
+		t.Fatalf("unexpected result of cleaning expired logs: %d, %v", n, err)
+	}
+	if exist("job_1.log.gz") || !exist("job_2.log.gz") || !exist("other.log") {
+		t.Errorf("only the expired log should be removed")
+	}
+
+	// job_2 is removed to keep the size, job_3 is waiting to be retried and job_4 may be
+	// written by running job
+	if n, err := CleanJobLogs(dir, 0, 50, time.Hour, map[int64]bool{3: true}); err != nil || n != 1 {
+		t.Fatalf("unexpected result of cleaning logs exceeding the size: %d, %v", n, err)
+	}
+	if exist("job_2.log.gz") || !exist("job_3.log") || !exist("job_4.log") {
+		t.Errorf("the oldest log of finished job should be removed")
+	}
+
+	if n, err := CleanJobLogs(dir, 0, 50, time.Hour, nil); err != nil || n != 1 {
+		t.Fatalf("unexpected result of cleaning logs exceeding the size: %d, %v", n, err)
+	}
+	if exist("job_3.log") || !exist("job_4.log") {
+		t.Errorf("the oldest logs except the active one should be removed")
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	tracker := NewConnTracker()
+	client := &http.Client{
+		Transport: tracker.Transport(&http.Transport{}),
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Get(server.URL)
+		errs <- err
+	}()
+
+	// wait for the request to be sent
+	for i := 0; i < 100; i++ {
+		tracker.Lock()
+		n := len(tracker.conns)
+		tracker.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tracker.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("the request in flight should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the request in flight should be aborted")
+	}
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("the request after the tracker is closed should fail")
+	}
+}
+
+func TestTargetConnection(t *testing.T) {
+	token, err := u.ReversibleEncrypt("token", config.SecretKey())
+	if err != nil {
+		t.Fatalf("failed to encrypt token: %v", err)
+	}
+	target := &models.RepTarget{
+		ID:             1,
+		Username:       "admin",
+		CredentialType: models.TargetCredentialBearer,
+		Token:          token,
+		Insecure:       1,
+	}
+
+	credential, transport, err := TargetConnection(target)
+	if err != nil {
+		t.Fatalf("failed to get the connection of target: %v", err)
+	}
+	req, err := http.NewRequest("GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	credential.AddAuthorization(req)
+	if h := req.Header.Get("Authorization"); h != "Bearer token" {
+		t.Errorf("unexpected authorization header: %s", h)
+	}
+	if !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("the certificate of the insecure target should not be verified")
+	}
+
+	target.CACert = "invalid"
+	if _, _, err = TargetConnection(target); err == nil {
+		t.Errorf("an error expected for the invalid CA bundle")
+	}
+}
+
+func TestCheckPullCollisions(t *testing.T) {
+	if err := checkPullCollisions([]string{"a/ubuntu", "a/nginx", "b/redis"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkPullCollisions([]string{"a/ubuntu", "b/ubuntu"}); err == nil {
+		t.Errorf("an error is expected for the repositories pulled into the same one")
+	}
+}
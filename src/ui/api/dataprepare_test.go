@@ -87,6 +87,7 @@ func CommonAddTarget() {
 		Name:     TestTargetName,
 		Username: adminName,
 		Password: adminPwd,
+		Type:     models.TargetTypeRegistry,
 	}
 	_, _ = dao.AddRepTarget(*commonTarget)
 }
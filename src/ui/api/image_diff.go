@@ -0,0 +1,409 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+)
+
+// imageConfig holds the parts of an image config which are compared by the diff API
+type imageConfig struct {
+	Config struct {
+		User         string              `json:"User"`
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Labels       map[string]string   `json:"Labels"`
+	} `json:"config"`
+}
+
+// imageInfo is the manifest, config and scan data of one side of a diff
+type imageInfo struct {
+	RepoName string `json:"repo_name"`
+	Tag      string `json:"tag"`
+	Digest   string `json:"digest"`
+	Size     int64  `json:"size"`
+
+	layers          []layerDiff
+	config          *imageConfig
+	vulnerabilities []scannedVuln
+	scanned         bool
+}
+
+type layerDiff struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+type stringDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type listDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+type sliceDiff struct {
+	From []string `json:"from"`
+	To   []string `json:"to"`
+}
+
+type configDiff struct {
+	User         *stringDiff `json:"user,omitempty"`
+	WorkingDir   *stringDiff `json:"working_dir,omitempty"`
+	Entrypoint   *sliceDiff  `json:"entrypoint,omitempty"`
+	Cmd          *sliceDiff  `json:"cmd,omitempty"`
+	Env          *listDiff   `json:"env,omitempty"`
+	ExposedPorts *listDiff   `json:"exposed_ports,omitempty"`
+	Labels       *listDiff   `json:"labels,omitempty"`
+}
+
+// scannedVuln is the subset of the vulnerability stored in image_vulnerability, the
+// package is empty if the image was scanned before the packages were recorded
+type scannedVuln struct {
+	Name     string `json:"Name"`
+	Severity string `json:"Severity"`
+	FixedBy  string `json:"FixedBy"`
+	Package  string `json:"Package"`
+}
+
+type vulnerabilityDiff struct {
+	Scanned         bool     `json:"scanned"`
+	AddedPackages   []string `json:"added_packages"`
+	RemovedPackages []string `json:"removed_packages"`
+	Added           []string `json:"added"`
+	Fixed           []string `json:"fixed"`
+	Shared          []string `json:"shared"`
+	CountDelta      int      `json:"count_delta"`
+}
+
+type imageDiff struct {
+	From            *imageInfo         `json:"from"`
+	To              *imageInfo         `json:"to"`
+	AddedLayers     []layerDiff        `json:"added_layers"`
+	RemovedLayers   []layerDiff        `json:"removed_layers"`
+	SharedLayers    []layerDiff        `json:"shared_layers"`
+	SizeDelta       int64              `json:"size_delta"`
+	Config          *configDiff        `json:"config"`
+	Vulnerabilities *vulnerabilityDiff `json:"vulnerabilities,omitempty"`
+}
+
+// GetDiff handles GET /api/repositories/diff, it compares the image repo_name:tag
+// with target_repo_name:target_tag, target_repo_name defaults to repo_name
+func (ra *RepositoryAPI) GetDiff() {
+	repoName := ra.GetString("repo_name")
+	tag := ra.GetString("tag")
+	targetRepoName := ra.GetString("target_repo_name")
+	targetTag := ra.GetString("target_tag")
+
+	if len(targetRepoName) == 0 {
+		targetRepoName = repoName
+	}
+
+	if len(repoName) == 0 || len(tag) == 0 || len(targetTag) == 0 {
+		ra.CustomAbort(http.StatusBadRequest, "repo_name, tag and target_tag are required")
+	}
+
+	from := ra.getImageInfo(repoName, tag)
+	to := ra.getImageInfo(targetRepoName, targetTag)
+
+	ra.Data["json"] = diffImages(from, to)
+	ra.ServeJSON()
+}
+
+// getImageInfo checks the read permission of the repository and loads the schema2
+// manifest, the config and the scan result of the image
+func (ra *RepositoryAPI) getImageInfo(repoName, tag string) *imageInfo {
+	projectName, _ := utils.ParseRepository(repoName)
+	project, err := dao.GetProjectByName(projectName)
+	if err != nil {
+		log.Errorf("failed to get project %s: %v", projectName, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if project == nil {
+		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", projectName))
+	}
+
+	if project.Public == 0 {
+		userID := ra.ValidateUser()
+		if !checkProjectPermission(userID, project.ProjectID) {
+			ra.CustomAbort(http.StatusForbidden, "")
+		}
+	}
+
+	rc, err := ra.initRepositoryClient(repoName)
+	if err != nil {
+		log.Errorf("error occurred while initializing repository client for %s: %v", repoName, err)
+		ra.CustomAbort(http.StatusInternalServerError, "internal error")
+	}
+
+	digest, mediaType, payload, err := rc.PullManifest(tag, []string{schema2.MediaTypeManifest})
+	if err != nil {
+		if regErr, ok := err.(*registry_error.Error); ok {
+			ra.CustomAbort(regErr.StatusCode, regErr.Detail)
+		}
+
+		log.Errorf("error occurred while getting manifest of %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "internal error")
+	}
+
+	if mediaType != schema2.MediaTypeManifest {
+		ra.CustomAbort(http.StatusBadRequest, fmt.Sprintf("the manifest of %s:%s is not a schema2 manifest", repoName, tag))
+	}
+
+	manifest := &schema2.DeserializedManifest{}
+	if err = manifest.UnmarshalJSON(payload); err != nil {
+		log.Errorf("an error occurred while parsing manifest of %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	info := &imageInfo{
+		RepoName: repoName,
+		Tag:      tag,
+		Digest:   digest,
+		config:   &imageConfig{},
+	}
+
+	for _, l := range manifest.Layers {
+		info.layers = append(info.layers, layerDiff{
+			Digest: l.Digest.String(),
+			Size:   l.Size,
+		})
+		info.Size += l.Size
+	}
+
+	_, data, err := rc.PullBlob(manifest.Config.Digest.String())
+	if err != nil {
+		log.Errorf("failed to get config of manifest %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+	defer data.Close()
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		log.Errorf("failed to read config of manifest %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if err = json.Unmarshal(b, info.config); err != nil {
+		log.Errorf("failed to parse config of manifest %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	vulnerabilities, err := dao.GetImageVulnerability(repoName, tag)
+	if err != nil {
+		log.Errorf("failed to get vulnerabilities of %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if len(vulnerabilities) > 0 {
+		info.scanned = true
+		if len(vulnerabilities[0].Vulnerabilities) > 0 {
+			if err = json.Unmarshal([]byte(vulnerabilities[0].Vulnerabilities), &info.vulnerabilities); err != nil {
+				log.Errorf("failed to parse vulnerabilities of %s:%s: %v", repoName, tag, err)
+				ra.CustomAbort(http.StatusInternalServerError, "")
+			}
+		}
+	}
+
+	return info
+}
+
+// diffImages compares two images, the result describes the changes from "from" to "to"
+func diffImages(from, to *imageInfo) *imageDiff {
+	diff := &imageDiff{
+		From:          from,
+		To:            to,
+		AddedLayers:   []layerDiff{},
+		RemovedLayers: []layerDiff{},
+		SharedLayers:  []layerDiff{},
+		SizeDelta:     to.Size - from.Size,
+		Config:        diffConfigs(from.config, to.config),
+	}
+
+	fromLayers := map[string]bool{}
+	for _, l := range from.layers {
+		fromLayers[l.Digest] = true
+	}
+	toLayers := map[string]bool{}
+	for _, l := range to.layers {
+		toLayers[l.Digest] = true
+		if fromLayers[l.Digest] {
+			diff.SharedLayers = append(diff.SharedLayers, l)
+		} else {
+			diff.AddedLayers = append(diff.AddedLayers, l)
+		}
+	}
+	for _, l := range from.layers {
+		if !toLayers[l.Digest] {
+			diff.RemovedLayers = append(diff.RemovedLayers, l)
+		}
+	}
+
+	if from.scanned || to.scanned {
+		diff.Vulnerabilities = diffVulnerabilities(from, to)
+	}
+
+	return diff
+}
+
+func diffConfigs(from, to *imageConfig) *configDiff {
+	diff := &configDiff{}
+	f, t := from.Config, to.Config
+
+	if f.User != t.User {
+		diff.User = &stringDiff{From: f.User, To: t.User}
+	}
+	if f.WorkingDir != t.WorkingDir {
+		diff.WorkingDir = &stringDiff{From: f.WorkingDir, To: t.WorkingDir}
+	}
+	if !reflect.DeepEqual(f.Entrypoint, t.Entrypoint) {
+		diff.Entrypoint = &sliceDiff{From: f.Entrypoint, To: t.Entrypoint}
+	}
+	if !reflect.DeepEqual(f.Cmd, t.Cmd) {
+		diff.Cmd = &sliceDiff{From: f.Cmd, To: t.Cmd}
+	}
+
+	diff.Env = diffLists(f.Env, t.Env)
+
+	fromPorts, toPorts := []string{}, []string{}
+	for port := range f.ExposedPorts {
+		fromPorts = append(fromPorts, port)
+	}
+	for port := range t.ExposedPorts {
+		toPorts = append(toPorts, port)
+	}
+	diff.ExposedPorts = diffLists(fromPorts, toPorts)
+
+	fromLabels, toLabels := []string{}, []string{}
+	for k, v := range f.Labels {
+		fromLabels = append(fromLabels, k+"="+v)
+	}
+	for k, v := range t.Labels {
+		toLabels = append(toLabels, k+"="+v)
+	}
+	diff.Labels = diffLists(fromLabels, toLabels)
+
+	return diff
+}
+
+func diffVulnerabilities(from, to *imageInfo) *vulnerabilityDiff {
+	diff := &vulnerabilityDiff{
+		Scanned:         from.scanned && to.scanned,
+		AddedPackages:   []string{},
+		RemovedPackages: []string{},
+		Added:           []string{},
+		Fixed:           []string{},
+		Shared:          []string{},
+		CountDelta:      len(to.vulnerabilities) - len(from.vulnerabilities),
+	}
+
+	fromVulns, fromPkgs := indexVulnerabilities(from.vulnerabilities)
+	toVulns, toPkgs := indexVulnerabilities(to.vulnerabilities)
+
+	for name := range toVulns {
+		if fromVulns[name] {
+			diff.Shared = append(diff.Shared, name)
+		} else {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+	for name := range fromVulns {
+		if !toVulns[name] {
+			diff.Fixed = append(diff.Fixed, name)
+		}
+	}
+	for pkg := range toPkgs {
+		if !fromPkgs[pkg] {
+			diff.AddedPackages = append(diff.AddedPackages, pkg)
+		}
+	}
+	for pkg := range fromPkgs {
+		if !toPkgs[pkg] {
+			diff.RemovedPackages = append(diff.RemovedPackages, pkg)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Fixed)
+	sort.Strings(diff.Shared)
+	sort.Strings(diff.AddedPackages)
+	sort.Strings(diff.RemovedPackages)
+
+	return diff
+}
+
+// indexVulnerabilities returns the vulnerability names and the names of the affected packages
+func indexVulnerabilities(vulnerabilities []scannedVuln) (map[string]bool, map[string]bool) {
+	names := map[string]bool{}
+	pkgs := map[string]bool{}
+	for _, v := range vulnerabilities {
+		names[v.Name] = true
+		if len(v.Package) > 0 {
+			pkgs[v.Package] = true
+		}
+	}
+	return names, pkgs
+}
+
+// diffLists returns nil if the two lists contain the same elements
+func diffLists(from, to []string) *listDiff {
+	diff := &listDiff{
+		Added:   []string{},
+		Removed: []string{},
+	}
+
+	fromSet := map[string]bool{}
+	for _, e := range from {
+		fromSet[e] = true
+	}
+	toSet := map[string]bool{}
+	for _, e := range to {
+		toSet[e] = true
+		if !fromSet[e] {
+			diff.Added = append(diff.Added, e)
+		}
+	}
+	for _, e := range from {
+		if !toSet[e] {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		return nil
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffImages(t *testing.T) {
+	assert := assert.New(t)
+
+	from := &imageInfo{
+		Size: 30,
+		layers: []layerDiff{
+			{Digest: "sha256:base", Size: 10},
+			{Digest: "sha256:old", Size: 20},
+		},
+		config:  &imageConfig{},
+		scanned: true,
+	}
+	from.config.Config.User = "root"
+	from.config.Config.Env = []string{"PATH=/bin", "VERSION=1.4"}
+	from.config.Config.ExposedPorts = map[string]struct{}{"80/tcp": {}}
+	from.vulnerabilities = []scannedVuln{
+		{Name: "CVE-1", Package: "openssl", FixedBy: "1.0.2"},
+		{Name: "CVE-2", Package: "bash"},
+	}
+
+	to := &imageInfo{
+		Size: 35,
+		layers: []layerDiff{
+			{Digest: "sha256:base", Size: 10},
+			{Digest: "sha256:new", Size: 25},
+		},
+		config:  &imageConfig{},
+		scanned: true,
+	}
+	to.config.Config.User = "app"
+	to.config.Config.Env = []string{"PATH=/bin", "VERSION=1.5"}
+	to.config.Config.ExposedPorts = map[string]struct{}{"80/tcp": {}}
+	to.vulnerabilities = []scannedVuln{
+		{Name: "CVE-2", Package: "bash"},
+		{Name: "CVE-3", Package: "curl"},
+		{Name: "CVE-4"},
+	}
+
+	diff := diffImages(from, to)
+
+	assert.Equal(int64(5), diff.SizeDelta)
+	assert.Equal([]layerDiff{{Digest: "sha256:new", Size: 25}}, diff.AddedLayers)
+	assert.Equal([]layerDiff{{Digest: "sha256:old", Size: 20}}, diff.RemovedLayers)
+	assert.Equal([]layerDiff{{Digest: "sha256:base", Size: 10}}, diff.SharedLayers)
+
+	assert.Equal(&stringDiff{From: "root", To: "app"}, diff.Config.User)
+	assert.Equal(&listDiff{Added: []string{"VERSION=1.5"}, Removed: []string{"VERSION=1.4"}}, diff.Config.Env)
+	assert.Nil(diff.Config.ExposedPorts)
+	assert.Nil(diff.Config.Entrypoint)
+
+	assert.NotNil(diff.Vulnerabilities)
+	assert.Equal([]string{"CVE-3", "CVE-4"}, diff.Vulnerabilities.Added)
+	assert.Equal([]string{"CVE-1"}, diff.Vulnerabilities.Fixed)
+	assert.Equal([]string{"CVE-2"}, diff.Vulnerabilities.Shared)
+	assert.Equal([]string{"curl"}, diff.Vulnerabilities.AddedPackages)
+	assert.Equal([]string{"openssl"}, diff.Vulnerabilities.RemovedPackages)
+}
@@ -0,0 +1,145 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/archive"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+)
+
+// Export handles GET /api/repositories/export?repo_name=&tag=&tag=&format=, it streams the images
+// as an archive which can be loaded by "docker load". All the tags are exported if no tag is
+// specified, and the archive is also an OCI image layout if format is "oci".
+func (ra *RepositoryAPI) Export() {
+	repoName := ra.GetString("repo_name")
+	if len(repoName) == 0 {
+		ra.CustomAbort(http.StatusBadRequest, "repo_name is nil")
+	}
+
+	format := ra.GetString("format", "docker")
+	if format != "docker" && format != "oci" {
+		ra.CustomAbort(http.StatusBadRequest, fmt.Sprintf("unsupported format %s", format))
+	}
+
+	projectName, _ := utils.ParseRepository(repoName)
+	project, err := dao.GetProjectByName(projectName)
+	if err != nil {
+		log.Errorf("failed to get project %s: %v", projectName, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if project == nil {
+		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", projectName))
+	}
+
+	// the user is authenticated by the basic auth header or the session, it is
+	// also the user recorded in the access logs
+	userID, authenticated := 0, false
+	if project.Public == 0 {
+		userID, authenticated = ra.ValidateUser(), true
+		if !checkProjectPermission(userID, project.ProjectID) {
+			ra.CustomAbort(http.StatusForbidden, "")
+		}
+	} else {
+		userID, _, authenticated = ra.GetUserIDForRequest()
+	}
+
+	rc, err := ra.initRepositoryClient(repoName)
+	if err != nil {
+		log.Errorf("error occurred while initializing repository client for %s: %v", repoName, err)
+		ra.CustomAbort(http.StatusInternalServerError, "internal error")
+	}
+
+	tags := ra.GetStrings("tag")
+	if len(tags) == 0 {
+		if tags, err = rc.ListTag(); err != nil {
+			if regErr, ok := err.(*registry_error.Error); ok {
+				ra.CustomAbort(regErr.StatusCode, regErr.Detail)
+			}
+			log.Errorf("error occurred while listing tags of %s: %v", repoName, err)
+			ra.CustomAbort(http.StatusInternalServerError, "internal error")
+		}
+		if len(tags) == 0 {
+			ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("no tag found in %s", repoName))
+		}
+	}
+
+	images := []*archive.Image{}
+	for _, tag := range tags {
+		images = append(images, &archive.Image{Repository: repoName, Tag: tag})
+	}
+
+	exporter := &archive.Exporter{
+		NewClient: func(repository string) (*registry.Repository, error) {
+			return rc, nil
+		},
+		Registry: os.Getenv("HARBOR_REG_URL"),
+		OCI:      format == "oci",
+	}
+	export, err := exporter.Prepare(images)
+	if err != nil {
+		log.Errorf("failed to prepare the export of %s: %v", repoName, err)
+		ra.CustomAbort(http.StatusBadRequest, err.Error())
+	}
+
+	filename := repoName[strings.LastIndex(repoName, "/")+1:] + ".tar"
+	if len(tags) == 1 {
+		filename = repoName[strings.LastIndex(repoName, "/")+1:] + "-" + tags[0] + ".tar"
+	}
+	ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "application/x-tar")
+	ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Disposition"),
+		fmt.Sprintf("attachment; filename=%q", filename))
+
+	// the status has been sent once the archive begins to be written, so
+	// the errors can only be logged
+	if _, err = export.WriteTo(ra.Ctx.ResponseWriter); err != nil {
+		log.Errorf("failed to export %s: %v", repoName, err)
+		return
+	}
+
+	username := "anonymous"
+	if authenticated {
+		user, err := dao.GetUser(models.User{UserID: userID})
+		if err != nil {
+			log.Errorf("failed to get user %d: %v", userID, err)
+		} else if user != nil {
+			username = user.Username
+		}
+	}
+
+	for _, image := range export.Images() {
+		if err = dao.AccessLog(username, projectName, repoName, image.Tag, "pull"); err != nil {
+			log.Errorf("failed to add access log: %v", err)
+		}
+		if err = dao.IncreaseRepoDailyStat(repoName, image.Tag, "pull", time.Now()); err != nil {
+			log.Errorf("failed to increase the daily pull count of %s:%s: %v", repoName, image.Tag, err)
+		}
+	}
+	if err = dao.IncreasePullCount(repoName); err != nil {
+		log.Errorf("failed to increase the pull count of %s: %v", repoName, err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2017 caicloud authors. All rights reserved.
+*/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+const defaultJobRetentionDays = 30
+
+// errJobCanceled is returned by the job which stops as it is canceled
+var errJobCanceled = errors.New("job canceled")
+
+// jobContext is passed to the job run by runJob to report its progress and check whether it
+// is canceled
+type jobContext struct {
+	jobID int64
+}
+
+// Progress records the progress in percentage and the message of the job
+func (c *jobContext) Progress(progress int, format string, args ...interface{}) {
+	if err := dao.UpdateJobProgress(c.jobID, progress, fmt.Sprintf(format, args...)); err != nil {
+		log.Errorf("failed to update progress of job %d: %v", c.jobID, err)
+	}
+}
+
+// Canceled returns whether the job has been canceled, the job should return errJobCanceled
+// at a point where it can stop safely once it is canceled
+func (c *jobContext) Canceled() bool {
+	status, err := dao.GetJobStatus(c.jobID)
+	if err != nil {
+		log.Errorf("failed to get status of job %d: %v", c.jobID, err)
+		return false
+	}
+	return status == models.JobCanceled
+}
+
+// runJob runs f as the job synchronously, the status, result and error of the job are recorded
+// when f returns. f is not run if the job has been canceled.
+func runJob(jobID int64, f func(ctx *jobContext) (interface{}, error)) {
+	started, err := dao.StartJob(jobID)
+	if err != nil {
+		log.Errorf("failed to start job %d: %v", jobID, err)
+		return
+	}
+	if !started {
+		log.Infof("job %d is not pending, skip it", jobID)
+		return
+	}
+
+	result, err := f(&jobContext{jobID: jobID})
+	switch {
+	case err == errJobCanceled:
+		log.Infof("job %d is canceled", jobID)
+	case err != nil:
+		log.Errorf("job %d failed: %v", jobID, err)
+		if err = dao.FinishJob(jobID, models.JobError, "failed", result, err.Error()); err != nil {
+			log.Errorf("failed to update status of job %d: %v", jobID, err)
+		}
+	default:
+		if err = dao.FinishJob(jobID, models.JobFinished, "done", result, ""); err != nil {
+			log.Errorf("failed to update status of job %d: %v", jobID, err)
+		}
+	}
+}
+
+// CleanJobs deletes the jobs which ended before the retention days periodically, the retention
+// days can be set by the environment variable JOB_RETENTION_DAYS
+func CleanJobs() {
+	days := defaultJobRetentionDays
+	if s := os.Getenv("JOB_RETENTION_DAYS"); len(s) > 0 {
+		d, err := strconv.Atoi(s)
+		if err != nil || d <= 0 {
+			log.Errorf("invalid JOB_RETENTION_DAYS %s, use the default value %d", s, defaultJobRetentionDays)
+		} else {
+			days = d
+		}
+	}
+
+	for {
+		n, err := dao.DeleteJobsBefore(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Errorf("failed to delete jobs ended %d days ago: %v", days, err)
+		} else if n > 0 {
+			log.Infof("%d jobs ended %d days ago are deleted", n, days)
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
@@ -15,19 +15,24 @@ import (
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
-// JobAPIV1 handles request to /api/v1/jobs /api/v1/jobs/:jid,
+// JobAPIV1 handles request to /api/v1/jobs /api/v1/jobs/:jid /api/v1/jobs/:jid/cancel,
 
 type JobAPIV1 struct {
 	api.BaseAPI
+	userID int
+	job    *models.Job
 }
 
 type createJobReq struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	ProjectID int64  `json:"projectId"`
 }
 
 // Prepare validates the URL and the params
 func (j *JobAPIV1) Prepare() {
+	j.userID = j.ValidateUser()
+
 	idStr := j.Ctx.Input.Param(":jid")
 	if len(idStr) > 0 {
 		var err error
@@ -36,26 +41,106 @@ func (j *JobAPIV1) Prepare() {
 			log.Errorf("Error parsing job id: %s, error: %v", idStr, err)
 			j.CustomAbort(http.StatusBadRequest, "invalid job id")
 		}
-		exist := dao.JobIdExists(jobId)
 
-		if !exist {
+		job, err := dao.GetJobById(jobId)
+		if err != nil {
+			log.Errorf("GetJobById error: %v", err)
+			j.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("GetJobById error: %v", err))
+		}
+
+		if job == nil {
 			j.CustomAbort(http.StatusNotFound, fmt.Sprintf("job does not exist, id: %v", jobId))
 		}
+
+		if !j.canAccess(job) {
+			j.CustomAbort(http.StatusForbidden, "")
+		}
+		j.job = job
 	}
 }
 
+// canAccess returns whether the user can access the job, the job can be accessed by its owner,
+// the admin of its project and system admin
+func (j *JobAPIV1) canAccess(job *models.Job) bool {
+	if job.UserID == 0 || job.UserID == j.userID {
+		return true
+	}
+
+	if job.ProjectID > 0 && hasProjectAdminRole(j.userID, job.ProjectID) {
+		return true
+	}
+
+	isAdmin, err := dao.IsAdminRole(j.userID)
+	if err != nil {
+		log.Errorf("failed to check whether user %d is admin: %v", j.userID, err)
+		return false
+	}
+	return isAdmin
+}
+
 // GetJob
 func (j *JobAPIV1) GetJob() {
-	idStr := j.Ctx.Input.Param(":jid")
-	jobId, err := strconv.ParseInt(idStr, 10, 64)
+	j.Data["json"] = j.job
+	j.ServeJSON()
+}
 
-	job, err := dao.GetJobById(jobId)
+// List handles GET /api/v1/jobs?type=&status=&projectId=&userId=&start=&limit=, the jobs of the
+// project are listed if projectId is set and the user is the admin of the project, otherwise the
+// jobs of the user are listed. System admin can list the jobs of all users.
+func (j *JobAPIV1) List() {
+	start, err := j.GetInt64("start", 0)
+	if err != nil || start < 0 {
+		j.CustomAbort(http.StatusBadRequest, "invalid start")
+	}
+	limit, err := j.GetInt64("limit", 0)
+	if err != nil || limit < 0 {
+		j.CustomAbort(http.StatusBadRequest, "invalid limit")
+	}
+
+	query := &models.JobQuery{
+		Type:     j.GetString("type"),
+		Status:   j.GetString("status"),
+		Page:     defaultPageIndex,
+		PageSize: defaultPageSize,
+	}
+	if limit > 0 {
+		query.Page = (start / limit) + 1
+		query.PageSize = limit
+	}
+
+	if query.ProjectID, err = j.GetInt64("projectId", 0); err != nil {
+		j.CustomAbort(http.StatusBadRequest, "invalid projectId")
+	}
+	userID, err := j.GetInt("userId", 0)
+	if err != nil {
+		j.CustomAbort(http.StatusBadRequest, "invalid userId")
+	}
+
+	isAdmin, err := dao.IsAdminRole(j.userID)
+	if err != nil {
+		log.Errorf("failed to check whether user %d is admin: %v", j.userID, err)
+		j.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	switch {
+	case isAdmin:
+		query.UserID = userID
+	case query.ProjectID > 0 && hasProjectAdminRole(j.userID, query.ProjectID):
+		query.UserID = userID
+	default:
+		if userID > 0 && userID != j.userID {
+			j.CustomAbort(http.StatusForbidden, "")
+		}
+		query.UserID = j.userID
+	}
+
+	total, jobs, err := dao.ListJobs(query)
 	if err != nil {
-		log.Errorf("GetJobById error: %v", err)
-		j.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("GetJobById error: %v", err))
+		log.Errorf("failed to list jobs: %v", err)
+		j.CustomAbort(http.StatusInternalServerError, "failed to list jobs")
 	}
 
-	j.Data["json"] = job
+	j.Data["json"] = models.NewListResponse(int(total), jobs)
 	j.ServeJSON()
 }
 
@@ -64,9 +149,15 @@ func (j *JobAPIV1) Post() {
 	var req createJobReq
 	j.DecodeJSONReq(&req)
 
+	if req.ProjectID > 0 && !checkProjectPermission(j.userID, req.ProjectID) {
+		j.CustomAbort(http.StatusForbidden, "")
+	}
+
 	job := models.Job{
-		Type:    req.Type,
-		Message: req.Message,
+		Type:      req.Type,
+		Message:   req.Message,
+		UserID:    j.userID,
+		ProjectID: req.ProjectID,
 	}
 
 	jobId, err := dao.CreateJob(job)
@@ -78,3 +169,17 @@ func (j *JobAPIV1) Post() {
 	// return job id
 	j.RenderError(http.StatusCreated, strconv.FormatInt(jobId, 10))
 }
+
+// Cancel handles POST /api/v1/jobs/:jid/cancel, the pending job will not be run and the running
+// job stops at the next point where it can stop safely
+func (j *JobAPIV1) Cancel() {
+	canceled, err := dao.CancelJob(j.job.JobID)
+	if err != nil {
+		log.Errorf("failed to cancel job %d: %v", j.job.JobID, err)
+		j.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if !canceled {
+		j.CustomAbort(http.StatusConflict, fmt.Sprintf("job %d has ended", j.job.JobID))
+	}
+}
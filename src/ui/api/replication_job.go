@@ -16,10 +16,12 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -140,6 +142,48 @@ func (ra *RepJobAPI) Delete() {
 		log.Errorf("failed to deleted job %d: %v", ra.jobID, err)
 		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
+
+	// the log is removed by the retention of job service if it fails to be deleted here
+	if err = deleteJobLog(ra.jobID); err != nil {
+		log.Warningf("failed to delete log of job %d: %v", ra.jobID, err)
+	}
+}
+
+// GetQueue handles GET /api/jobs/replication/queue, it returns the counts of the jobs in the
+// queue of job service
+func (ra *RepJobAPI) GetQueue() {
+	req, err := http.NewRequest("GET", buildJobQueueURL(), nil)
+	if err != nil {
+		log.Errorf("failed to create a request: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+	addAuthentication(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("failed to get stats of job queue: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("failed to read reponse body: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		ra.CustomAbort(resp.StatusCode, string(b))
+	}
+
+	stats := &models.RepJobQueueStats{}
+	if err = json.Unmarshal(b, stats); err != nil {
+		log.Errorf("failed to unmarshal stats of job queue: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	ra.Data["json"] = stats
+	ra.ServeJSON()
 }
 
 // GetLog ...
@@ -148,12 +192,31 @@ func (ra *RepJobAPI) GetLog() {
 		ra.CustomAbort(http.StatusBadRequest, "id is nil")
 	}
 
-	req, err := http.NewRequest("GET", buildJobLogURL(strconv.FormatInt(ra.jobID, 10)), nil)
+	follow, _ := ra.GetBool("follow", false)
+	params := url.Values{}
+	if follow {
+		params.Set("follow", "true")
+	} else if len(ra.GetString("lines")) > 0 {
+		lines, err := ra.GetInt("lines")
+		if err != nil || lines < 0 {
+			ra.CustomAbort(http.StatusBadRequest, "invalid lines")
+		}
+		params.Set("lines", strconv.Itoa(lines))
+	}
+	logURL := buildJobLogURL(strconv.FormatInt(ra.jobID, 10))
+	if len(params) > 0 {
+		logURL += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest("GET", logURL, nil)
 	if err != nil {
 		log.Errorf("failed to create a request: %v", err)
 		ra.CustomAbort(http.StatusInternalServerError, "")
 	}
 	addAuthentication(req)
+	if r := ra.Ctx.Request.Header.Get("Range"); len(r) > 0 {
+		req.Header.Set("Range", r)
+	}
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -161,9 +224,19 @@ func (ra *RepJobAPI) GetLog() {
 		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
+	if resp.StatusCode == http.StatusOK && follow {
+		ra.streamLog(resp.Body, resp.Header.Get(http.CanonicalHeaderKey("Content-Type")))
+		return
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
 		ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Length"), resp.Header.Get(http.CanonicalHeaderKey("Content-Length")))
 		ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "text/plain")
+		for _, key := range []string{"Accept-Ranges", "Content-Range"} {
+			if v := resp.Header.Get(key); len(v) > 0 {
+				ra.Ctx.ResponseWriter.Header().Set(key, v)
+			}
+		}
+		ra.Ctx.ResponseWriter.WriteHeader(resp.StatusCode)
 
 		if _, err = io.Copy(ra.Ctx.ResponseWriter, resp.Body); err != nil {
 			log.Errorf("failed to write log to response; %v", err)
@@ -181,4 +254,44 @@ func (ra *RepJobAPI) GetLog() {
 	ra.CustomAbort(resp.StatusCode, string(b))
 }
 
+// streamLog forwards the events of the log streamed by job service to the client as they come,
+// the stream is closed when either side closes it
+func (ra *RepJobAPI) streamLog(body io.ReadCloser, contentType string) {
+	w := ra.Ctx.ResponseWriter
+	w.Header().Set(http.CanonicalHeaderKey("Content-Type"), contentType)
+	w.Header().Set(http.CanonicalHeaderKey("Cache-Control"), "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	done := make(chan struct{})
+	defer close(done)
+	closed := w.CloseNotify()
+	go func() {
+		select {
+		case <-closed:
+			// interrupt the reading of the body
+			body.Close()
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				log.Debugf("failed to write log of job %d to response: %v", ra.jobID, err)
+				return
+			}
+			w.Flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("stop streaming log of job %d: %v", ra.jobID, err)
+			}
+			return
+		}
+	}
+}
+
 //TODO:add Post handler to call job service API to submit jobs by policy
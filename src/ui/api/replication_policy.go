@@ -16,7 +16,10 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 
 	"net/http"
 	"strconv"
@@ -170,8 +173,16 @@ func (pa *RepPolicyAPI) Put() {
 	policy := &models.RepPolicy{}
 	pa.DecodeJSONReq(policy)
 	policy.ProjectID = originalPolicy.ProjectID
+	if len(policy.Mode) == 0 {
+		policy.Mode = originalPolicy.Mode
+	}
 	pa.Validate(policy)
 
+	//mode of policy can not be modified when the policy is enabled
+	if policy.Mode != originalPolicy.Mode && originalPolicy.Enabled == 1 {
+		pa.CustomAbort(http.StatusBadRequest, "mode of policy can not be modified when the policy is enabled")
+	}
+
 	/*
 		// check duplicate name
 		if policy.Name != originalPolicy.Name {
@@ -291,6 +302,15 @@ func (pa *RepPolicyAPI) Put() {
 		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
 
+	// the next run time is computed again by job service from the new cron expression
+	if policy.CronStr != originalPolicy.CronStr ||
+		(policy.Enabled != originalPolicy.Enabled && policy.Enabled == 1) {
+		if err = dao.ResetRepPolicySchedule(id); err != nil {
+			log.Errorf("failed to reset schedule of policy %d: %v", id, err)
+			pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+	}
+
 	if policy.Enabled != originalPolicy.Enabled && policy.Enabled == 1 {
 		go func() {
 			if err := TriggerReplication(id, "", nil, models.RepOpTransfer); err != nil {
@@ -337,6 +357,10 @@ func (pa *RepPolicyAPI) UpdateEnablement() {
 	}
 
 	if e.Enabled == 1 {
+		// the runs missed while the policy was disabled are not triggered
+		if err := dao.ResetRepPolicySchedule(id); err != nil {
+			log.Errorf("failed to reset schedule of policy %d: %v", id, err)
+		}
 		go func() {
 			if err := TriggerReplication(id, "", nil, models.RepOpTransfer); err != nil {
 				log.Errorf("failed to trigger replication of %d: %v", id, err)
@@ -355,6 +379,216 @@ func (pa *RepPolicyAPI) UpdateEnablement() {
 	}
 }
 
+// Trigger replicates all the repositories of the enabled policy right now
+func (pa *RepPolicyAPI) Trigger() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	if policy.Enabled == 0 {
+		pa.CustomAbort(http.StatusPreconditionFailed, "policy is disabled, can not be triggered")
+	}
+
+	if err = TriggerReplication(id, "", nil, models.RepOpTransfer); err != nil {
+		log.Errorf("failed to trigger replication of %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	log.Infof("replication of %d triggered", id)
+}
+
+// GetSchedule returns the cron expression, the last and next run time of the policy and
+// whether the jobs of the policy are in progress
+func (pa *RepPolicyAPI) GetSchedule() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	running, err := dao.IsRepPolicyRunning(id)
+	if err != nil {
+		log.Errorf("failed to check whether policy %d is running: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	pa.Data["json"] = &models.RepPolicySchedule{
+		PolicyID:    policy.ID,
+		CronStr:     policy.CronStr,
+		Enabled:     policy.Enabled,
+		LastRunTime: policy.LastRunTime,
+		NextRunTime: policy.NextRunTime,
+		Running:     running,
+	}
+	pa.ServeJSON()
+}
+
+// DryRun returns what the replication of the policy would create, update, delete or skip on
+// the destination and the estimated bytes to transfer, no job is created
+func (pa *RepPolicyAPI) DryRun() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	req, err := http.NewRequest("GET", buildJobDryRunURL(id), nil)
+	if err != nil {
+		log.Errorf("failed to create a request: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	addAuthentication(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("failed to run policy %d in dry run mode: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("failed to read reponse body: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		pa.CustomAbort(resp.StatusCode, string(b))
+	}
+
+	result := &models.RepDryRun{}
+	if err = json.Unmarshal(b, result); err != nil {
+		log.Errorf("failed to unmarshal result of dry run: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	pa.Data["json"] = result
+	pa.ServeJSON()
+}
+
+// Verify starts checking the digests of the tags selected by the policy against the destination,
+// jobs are created to repair the drift if the query parameter "repair" is true
+func (pa *RepPolicyAPI) Verify() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	repair, err := pa.GetBool("repair", false)
+	if err != nil {
+		pa.CustomAbort(http.StatusBadRequest, "invalid repair")
+	}
+
+	b, err := json.Marshal(&struct {
+		PolicyID int64 `json:"policy_id"`
+		Repair   bool  `json:"repair"`
+	}{
+		PolicyID: id,
+		Repair:   repair,
+	})
+	if err != nil {
+		log.Errorf("failed to marshal request: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	req, err := http.NewRequest("POST", buildJobVerifyURL(), bytes.NewBuffer(b))
+	if err != nil {
+		log.Errorf("failed to create a request: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	addAuthentication(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("failed to verify policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		b, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Errorf("failed to read reponse body: %v", err)
+			pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		pa.CustomAbort(resp.StatusCode, string(b))
+	}
+	log.Infof("verification of policy %d started, repair: %t", id, repair)
+	pa.Ctx.Output.SetStatus(http.StatusAccepted)
+}
+
+// GetVerification returns the result of the last verification of the policy
+func (pa *RepPolicyAPI) GetVerification() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	if len(policy.Verification) == 0 {
+		pa.CustomAbort(http.StatusNotFound, "policy has not been verified")
+	}
+
+	result := &models.RepVerification{}
+	if err = json.Unmarshal([]byte(policy.Verification), result); err != nil {
+		log.Errorf("failed to unmarshal verification result of policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	pa.Data["json"] = result
+	pa.ServeJSON()
+}
+
+// GetStatistics returns the statistics of the replication jobs of the policy
+func (pa *RepPolicyAPI) GetStatistics() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	stats, err := dao.GetRepPolicyStats(id)
+	if err != nil {
+		log.Errorf("failed to get statistics of policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	pa.Data["json"] = stats
+	pa.ServeJSON()
+}
+
 // Delete : policies which are disabled and have no running jobs
 // can be deleted
 func (pa *RepPolicyAPI) Delete() {
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strings"
 
 	klar_clair "github.com/optiopay/klar/clair"
 	klar_docker "github.com/optiopay/klar/docker"
@@ -40,7 +41,14 @@ type repoAnalysisReq struct {
 	RepoName string `json:"repo_name"`
 }
 
-type VulnerabilityList []klar_clair.Vulnerability
+// Vulnerability is a vulnerability found by Clair and the package it is found in
+type Vulnerability struct {
+	klar_clair.Vulnerability
+	Package        string `json:"Package,omitempty"`
+	PackageVersion string `json:"PackageVersion,omitempty"`
+}
+
+type VulnerabilityList []Vulnerability
 
 type Serverity string
 
@@ -103,7 +111,7 @@ func init() {
 }
 
 // TriggerRepositoryAnalysis
-func TriggerRepositoryAnalysis(repo string, tag string, username string, password string) ([]klar_clair.Vulnerability, error) {
+func TriggerRepositoryAnalysis(repo string, tag string, username string, password string) ([]Vulnerability, error) {
 	log.Debugf("TriggerRepositoryAnalysis, repo: %v, tag: %v, username: %v, password: %v", repo, tag, username, password)
 
 	if len(repo) == 0 || len(tag) == 0 {
@@ -134,7 +142,7 @@ func TriggerRepositoryAnalysis(repo string, tag string, username string, passwor
 	}
 
 	// AnalysisImage analysis image by Clair server
-	var vulnerabilities []klar_clair.Vulnerability
+	var vulnerabilities []Vulnerability
 
 	clairServerAddr := os.Getenv("CLAIR_SERVER_IP")
 	if clairServerAddr == "" {
@@ -144,7 +152,17 @@ func TriggerRepositoryAnalysis(repo string, tag string, username string, passwor
 	log.Infof("clairServerAddr: %s", clairServerAddr)
 
 	clairClient := klar_clair.NewClair(clairServerAddr)
-	vulnerabilities = clairClient.Analyse(image)
+	found := clairClient.Analyse(image)
+
+	vulnerabilities, err = packageVulnerabilities(clairServerAddr, image)
+	if err != nil {
+		// the vulnerabilities are kept without the packages
+		log.Warningf("failed to get the packages of %s: %v", imageName, err)
+		vulnerabilities = []Vulnerability{}
+		for _, v := range found {
+			vulnerabilities = append(vulnerabilities, Vulnerability{Vulnerability: v})
+		}
+	}
 	sort.Sort(VulnerabilityList(vulnerabilities))
 
 	log.Infof("vulnerabilities got %d by Clair\n", len(vulnerabilities))
@@ -229,6 +247,60 @@ func (r *RepoAnalysisAPI) Get() {
 	r.ServeJSON()
 }
 
+// packageVulnerabilities returns the vulnerabilities of the packages of the top layer
+// of the analysed image, which include the packages of all its parent layers
+func packageVulnerabilities(clairServerAddr string, image *klar_docker.Image) ([]Vulnerability, error) {
+	vulnerabilities := []Vulnerability{}
+	if len(image.FsLayers) == 0 {
+		return vulnerabilities, nil
+	}
+
+	if !strings.HasPrefix(clairServerAddr, "http://") && !strings.HasPrefix(clairServerAddr, "https://") {
+		clairServerAddr = "http://" + clairServerAddr
+	}
+	if strings.LastIndex(clairServerAddr, ":") < 5 {
+		clairServerAddr = clairServerAddr + ":6060"
+	}
+	url := fmt.Sprintf("%s/v1/layers/%s?features&vulnerabilities", clairServerAddr,
+		image.FsLayers[len(image.FsLayers)-1].BlobSum)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from Clair: %d", resp.StatusCode)
+	}
+
+	envelope := struct {
+		Layer *struct {
+			Features []struct {
+				Name            string
+				Version         string
+				Vulnerabilities []klar_clair.Vulnerability
+			}
+		}
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Layer == nil {
+		return vulnerabilities, nil
+	}
+
+	for _, feature := range envelope.Layer.Features {
+		for _, v := range feature.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				Vulnerability:  v,
+				Package:        feature.Name,
+				PackageVersion: feature.Version,
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
 // High level is on the top
 func compareSeverity(severity1 Serverity, severity2 Serverity) bool {
 	return SeverityWeight[severity1] > SeverityWeight[severity2]
@@ -246,7 +318,7 @@ func (list VulnerabilityList) Less(i, j int) bool {
 
 // Swap realize function of interface sort
 func (list VulnerabilityList) Swap(i, j int) {
-	var temp klar_clair.Vulnerability = list[i]
+	var temp Vulnerability = list[i]
 	list[i] = list[j]
 	list[j] = temp
 }
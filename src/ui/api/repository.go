@@ -291,6 +291,9 @@ func (ra *RepositoryAPI) Delete() {
 			}
 		}
 		log.Infof("delete tag: %s:%s", repoName, t)
+		if err := dao.DeleteRepoTag(repoName, t); err != nil {
+			log.Errorf("failed to delete the record of tag %s:%s: %v", repoName, t, err)
+		}
 		go TriggerReplicationByRepository(repoName, []string{t}, models.RepOpDelete)
 
 		go func(tag string) {
@@ -664,6 +667,8 @@ func TriggerSyncRepositoryLatestManifest(repo_name string) error {
 	tags = append(tags, ts...)
 	log.Debugf("get tags: %v", tags)
 
+	syncRepoTags(rc, tags)
+
 	if len(tags) == 0 {
 		log.Errorf("tags not found for repo: %v", repo_name)
 		return nil
@@ -736,6 +741,42 @@ func TriggerSyncRepositoryLatestManifest(repo_name string) error {
 	return nil
 }
 
+// syncRepoTags removes the stale tag records of the repository and records the digests
+// of the tags which have not been recorded yet
+func syncRepoTags(rc *registry.Repository, tags []string) {
+	if err := dao.SyncRepoTags(rc.Name, tags); err != nil {
+		log.Errorf("failed to sync the tag records of %s: %v", rc.Name, err)
+		return
+	}
+
+	recorded, err := dao.GetRepoTags(rc.Name)
+	if err != nil {
+		log.Errorf("failed to get the tag records of %s: %v", rc.Name, err)
+		return
+	}
+
+	exist := map[string]bool{}
+	for _, t := range recorded {
+		exist[t.Tag] = true
+	}
+
+	for _, tag := range tags {
+		if exist[tag] {
+			continue
+		}
+
+		digest, ok, err := rc.ManifestExist(tag)
+		if err != nil || !ok {
+			log.Errorf("failed to get the digest of %s:%s: %v", rc.Name, tag, err)
+			continue
+		}
+
+		if err = dao.AddOrUpdateRepoTag(rc.Name, tag, digest); err != nil {
+			log.Errorf("failed to record tag %s:%s: %v", rc.Name, tag, err)
+		}
+	}
+}
+
 // Len realize function of interface sort
 func (list V1CompatibilityList) Len() int {
 	return len(list)
@@ -0,0 +1,266 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+	"github.com/vmware/harbor/src/ui/service/cache"
+)
+
+const moveRepositoryJobType = "move_repository"
+
+type moveRepositoryReq struct {
+	// Name is the full name of the destination repository, e.g. "project/repo"
+	Name string `json:"name"`
+}
+
+// Move handles POST /api/v1/repos/:rid/move, it moves or renames the repository as a job
+// and returns the ID of the job, the progress can be checked via /api/v1/jobs/:jid
+func (r *RepositoryAPIV1) Move() {
+	userID := r.ValidateUser()
+
+	repoID, err := strconv.ParseInt(r.Ctx.Input.Param(":rid"), 10, 64)
+	if err != nil {
+		r.CustomAbort(http.StatusBadRequest, "invalid repo id")
+	}
+
+	repo, err := dao.GetRepositoryByIdV1(repoID)
+	if err != nil {
+		log.Errorf("failed to get repository by id: %d, error: %v", repoID, err)
+		r.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if repo == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("repository %d not found", repoID))
+	}
+
+	var req moveRepositoryReq
+	r.DecodeJSONReq(&req)
+
+	dst := strings.Trim(strings.TrimSpace(req.Name), "/")
+	dstProjectName, rest := utils.ParseRepository(dst)
+	if len(dstProjectName) == 0 || len(rest) == 0 {
+		r.CustomAbort(http.StatusBadRequest, "name should be in form of project/repository")
+	}
+
+	if dst == repo.Name {
+		r.CustomAbort(http.StatusBadRequest, "the source and destination repositories are the same")
+	}
+
+	if dao.RepositoryExists(dst) {
+		r.CustomAbort(http.StatusConflict, fmt.Sprintf("repository %s already exists", dst))
+	}
+
+	srcProjectName, _ := utils.ParseRepository(repo.Name)
+	var srcProjectID int64
+	for _, projectName := range []string{srcProjectName, dstProjectName} {
+		project, err := dao.GetProjectByName(projectName)
+		if err != nil {
+			log.Errorf("failed to get project %s: %v", projectName, err)
+			r.CustomAbort(http.StatusInternalServerError, "")
+		}
+
+		if project == nil {
+			r.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", projectName))
+		}
+
+		if !hasProjectAdminRole(userID, project.ProjectID) {
+			r.CustomAbort(http.StatusForbidden, "")
+		}
+
+		if projectName == srcProjectName {
+			srcProjectID = project.ProjectID
+		}
+	}
+
+	user, err := dao.GetUser(models.User{UserID: userID})
+	if err != nil || user == nil {
+		log.Errorf("failed to get user %d: %v", userID, err)
+		r.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	jobID, err := dao.CreateJob(models.Job{
+		Type:      moveRepositoryJobType,
+		Message:   fmt.Sprintf("move %s to %s", repo.Name, dst),
+		UserID:    userID,
+		ProjectID: srcProjectID,
+	})
+	if err != nil {
+		log.Errorf("CreateJob error: %v", err)
+		r.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("CreateJob error: %v", err))
+	}
+
+	go runJob(jobID, func(ctx *jobContext) (interface{}, error) {
+		return moveRepository(ctx, user.Username, repo.Name, dst)
+	})
+
+	r.CustomAbort(http.StatusCreated, strconv.FormatInt(jobID, 10))
+}
+
+// moveRepository copies all the tags of repository src to dst inside the registry, migrates the
+// metadata in DB and then deletes the tags of src. It can be canceled before the metadata is
+// migrated and returns the digests of the tags moved.
+func moveRepository(ctx *jobContext, username, src, dst string) (map[string]string, error) {
+	endpoint := os.Getenv("REGISTRY_URL")
+	srcProject, _ := utils.ParseRepository(src)
+	dstProject, _ := utils.ParseRepository(dst)
+
+	srcClient, err := cache.NewRepositoryClient(endpoint, api.GetIsInsecure(), "admin", src,
+		"repository", src, "pull", "push", "*")
+	if err != nil {
+		return nil, err
+	}
+
+	dstClient, err := cache.NewRepositoryClient(endpoint, api.GetIsInsecure(), "admin", dst,
+		"repository", dst, "pull", "push", "*")
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := srcClient.ListTag()
+	if err != nil {
+		return nil, err
+	}
+
+	digests := map[string]string{}
+	for i, tag := range tags {
+		if ctx.Canceled() {
+			return digests, errJobCanceled
+		}
+
+		ctx.Progress(i*80/len(tags), "copying %s:%s (%d/%d)", src, tag, i+1, len(tags))
+		digest, err := copyImage(srcClient, dstClient, tag)
+		if err != nil {
+			return digests, fmt.Errorf("failed to copy %s:%s: %v", src, tag, err)
+		}
+		digests[tag] = digest
+
+		if err = dao.AccessLog(username, dstProject, dst, tag, "push"); err != nil {
+			log.Errorf("failed to add access log: %v", err)
+		}
+		if err = dao.IncreaseRepoDailyStat(dst, tag, "push", time.Now()); err != nil {
+			log.Errorf("failed to increase the daily push count of %s:%s: %v", dst, tag, err)
+		}
+	}
+
+	if ctx.Canceled() {
+		return digests, errJobCanceled
+	}
+
+	ctx.Progress(80, "migrating metadata")
+	if err = dao.MoveRepository(src, dst, dstProject); err != nil {
+		return digests, fmt.Errorf("failed to migrate metadata: %v", err)
+	}
+
+	for tag, digest := range digests {
+		if err = dao.AddOrUpdateRepoTag(dst, tag, digest); err != nil {
+			log.Errorf("failed to record tag %s:%s: %v", dst, tag, err)
+		}
+		if err = dao.DeleteRepoTag(src, tag); err != nil {
+			log.Errorf("failed to delete the record of tag %s:%s: %v", src, tag, err)
+		}
+	}
+
+	ctx.Progress(90, "deleting %s", src)
+	// the tags sharing a manifest are all deleted with it, so each manifest is deleted once and
+	// the ones not found are regarded as deleted already
+	deleted := map[string]bool{}
+	for _, tag := range tags {
+		digest := digests[tag]
+		if !deleted[digest] {
+			if err = srcClient.DeleteManifest(digest); err != nil {
+				if regErr, ok := err.(*registry_error.Error); !ok || regErr.StatusCode != http.StatusNotFound {
+					return digests, fmt.Errorf("failed to delete %s:%s: %v", src, tag, err)
+				}
+			}
+			deleted[digest] = true
+		}
+
+		if err = dao.AccessLog(username, srcProject, src, tag, "delete"); err != nil {
+			log.Errorf("failed to add access log: %v", err)
+		}
+	}
+
+	go TriggerReplicationByRepository(src, tags, models.RepOpDelete)
+	go TriggerReplicationByRepository(dst, tags, models.RepOpTransfer)
+
+	if err = cache.RefreshCatalogCache(); err != nil {
+		log.Errorf("failed to refresh cache: %v", err)
+	}
+
+	return digests, nil
+}
+
+// copyImage copies the image referenced by tag from src to dst and returns the digest of the manifest,
+// the blobs are mounted from src if both repositories are in the same registry and pushed otherwise
+func copyImage(src, dst *registry.Repository, tag string) (string, error) {
+	_, mediaType, payload, err := src.PullManifest(tag, []string{schema2.MediaTypeManifest, schema1.MediaTypeSignedManifest})
+	if err != nil {
+		return "", err
+	}
+
+	manifest, _, err := registry.UnMarshal(mediaType, payload)
+	if err != nil {
+		return "", err
+	}
+
+	for _, descriptor := range manifest.References() {
+		digest := descriptor.Digest.String()
+		exist, err := dst.BlobExist(digest)
+		if err != nil {
+			return "", err
+		}
+		if exist {
+			continue
+		}
+
+		if src.Endpoint.String() == dst.Endpoint.String() {
+			mounted, err := dst.MountBlob(digest, src.Name)
+			if err != nil {
+				return "", err
+			}
+			if mounted {
+				continue
+			}
+		}
+
+		size, data, err := src.PullBlob(digest)
+		if err != nil {
+			return "", err
+		}
+		err = dst.PushBlob(digest, size, data)
+		data.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return dst.PushManifest(tag, mediaType, payload)
+}
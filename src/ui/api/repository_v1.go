@@ -16,9 +16,8 @@
 package api
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -26,18 +25,16 @@ import (
 	"strconv"
 	"strings"
 
-	"golang.org/x/net/context"
-
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"github.com/vmware/harbor/src/common/api"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/archive"
 	"github.com/vmware/harbor/src/common/utils/log"
 	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
 	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
 	"github.com/vmware/harbor/src/ui/service/cache"
 )
@@ -135,170 +132,167 @@ func (r *RepositoryAPIV1) List() {
 	r.ServeJSON()
 }
 
-// UploadImages
+// UploadImages handles POST /api/v1/repos?jobId=&project=&repo=&tag=, it imports the images in the
+// "docker save" or OCI layout archive uploaded as form file "imageTar" into the project. The repository
+// and tag recorded in the archive can be overridden by "repo" and "tag", "tag" is only allowed if the
+// archive references a single image. The import runs as the pending job "jobId" of type "upload_images"
+// created by the user, a job is created if "jobId" is not specified.
 func (r *RepositoryAPIV1) UploadImages() {
-	jobId, err := r.GetInt64("jobId", 0)
+	userID := r.ValidateUser()
 
-	if err != nil || jobId == 0 {
-		log.Errorf("UploadImages error, jobId is nil")
-		r.CustomAbort(http.StatusBadRequest, "UploadImages error, jobId is nil")
+	jobId, err := r.GetInt64("jobId", 0)
+	if err != nil {
+		r.CustomAbort(http.StatusBadRequest, "invalid jobId")
 	}
 
-	// do upload image job asynchronous
-	go uploadImagesJob(r, jobId)
-
-	r.CustomAbort(http.StatusCreated, strconv.FormatInt(jobId, 10))
-}
-
-// uploadImagesJob
-func uploadImagesJob(r *RepositoryAPIV1, jobId int64) error {
-	log.Errorf("do uploadImagesJob jobId: %v", jobId)
-
-	project := r.GetString("project")
-	repo := r.GetString("repo")
-	tag := r.GetString("tag")
-
-	if len(project) <= 0 {
-		log.Errorf("UploadImages error, project is nil")
-		return dao.UpdateJobStatusById(jobId, "UploadImages error, project is nil")
+	projectName := r.GetString("project")
+	if len(projectName) == 0 {
+		r.CustomAbort(http.StatusBadRequest, "project is required")
 	}
 
-	log.Debugf("UploadImages project: %v", project)
-	log.Debugf("UploadImages repo: %v", repo)
-	log.Debugf("UploadImages tag: %v", tag)
-
-	// read file
-	imageTar, _, err := r.GetFile("imageTar")
+	project, err := dao.GetProjectByName(projectName)
 	if err != nil {
-		log.Errorf("UploadImages GetFile error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages GetFile error: %v", err))
+		log.Errorf("failed to get project %s: %v", projectName, err)
+		r.CustomAbort(http.StatusInternalServerError, "")
 	}
-
-	client, err := client.NewEnvClient()
-	if err != nil {
-		log.Errorf("UploadImages NewEnvClient error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages NewEnvClient error: %v", err))
+	if project == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", projectName))
 	}
-
-	// docker load -i
-	const quiet = true
-	imageLoadResponse, err := client.ImageLoad(context.Background(), imageTar, quiet)
-	if err != nil {
-		log.Errorf("UploadImages ImageLoad error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages ImageLoad error: %v", err))
+	if !hasProjectPushRole(userID, project.ProjectID) {
+		r.CustomAbort(http.StatusForbidden, "")
 	}
 
-	log.Debugf("imageLoadResponse.JSON: %v", imageLoadResponse.JSON)
-
-	body, err := ioutil.ReadAll(imageLoadResponse.Body)
-	if err != nil {
-		log.Errorf("UploadImages Read imageLoadResponse.Body error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages Read imageLoadResponse.Body error: %v", err))
+	user, err := dao.GetUser(models.User{UserID: userID})
+	if err != nil || user == nil {
+		log.Errorf("failed to get user %d: %v", userID, err)
+		r.CustomAbort(http.StatusInternalServerError, "")
 	}
 
-	type ImageLoadResponseBody struct {
-		Stream string `json:"stream"`
+	if jobId != 0 {
+		job, err := dao.GetJobById(jobId)
+		if err != nil {
+			log.Errorf("failed to get job %d: %v", jobId, err)
+			r.CustomAbort(http.StatusInternalServerError, "")
+		}
+		if job == nil {
+			r.CustomAbort(http.StatusNotFound, fmt.Sprintf("job %d not found", jobId))
+		}
+		if job.UserID != userID || job.Type != uploadImagesJobType ||
+			(job.ProjectID != 0 && job.ProjectID != project.ProjectID) {
+			r.CustomAbort(http.StatusForbidden, "")
+		}
+		if job.Status != models.JobPending {
+			r.CustomAbort(http.StatusConflict, fmt.Sprintf("job %d is %s", jobId, job.Status))
+		}
 	}
 
-	// ref:
-	// {"stream":"Loaded image: dind:cph\n"}#015
-	// TODO:
-	// if one image has two tags, only the first one will be parsed
-	body_str := (strings.Split(string(body), "\r"))[0]
-	log.Debugf("body_str: %v", body_str)
-
-	if strings.Contains(body_str, "errorDetail") ||
-		!strings.Contains(body_str, "Loaded image: ") {
-		log.Errorf("UploadImages Image Load error: %v", body_str)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages Image Load error: %v", body_str))
+	// the request body is released once the request is served, so the archive
+	// is saved before importing it asynchronously
+	imageTar, _, err := r.GetFile("imageTar")
+	if err != nil {
+		log.Errorf("UploadImages GetFile error: %v", err)
+		r.CustomAbort(http.StatusBadRequest, fmt.Sprintf("UploadImages GetFile error: %v", err))
 	}
+	defer imageTar.Close()
 
-	body_str = strings.TrimSpace(body_str)
-
-	var imageLoadResponseBody ImageLoadResponseBody
-	err = json.Unmarshal([]byte(body_str), &imageLoadResponseBody)
+	file, err := ioutil.TempFile("", "upload-")
 	if err != nil {
-		log.Errorf("UploadImages json.Unmarshal error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages json.Unmarshal error: %v", err))
+		log.Errorf("failed to create temporary file: %v", err)
+		r.CustomAbort(http.StatusInternalServerError, "")
 	}
-
-	// ref:
-	// Loaded image: dind:cph
-	log.Debugf("imageLoadResponseBody.Stream: %v", imageLoadResponseBody.Stream)
-
-	imageLoaded := strings.TrimSpace(strings.Replace(imageLoadResponseBody.Stream, "Loaded image: ", "", -1))
-	log.Debugf("imageLoaded: %v", imageLoaded)
-
-	imageLoadedRepo := strings.TrimSpace((strings.Split(imageLoaded, ":"))[0])
-	imageLoadedTag := strings.TrimSpace((strings.Split(imageLoaded, ":"))[1])
-
-	log.Debugf("imageLoaded ok, repo: %v, tag: %v", imageLoadedRepo, imageLoadedTag)
-
-	// use imageLoadedRepo/imageLoadedTag if repo/tag from input is nil
-	if len(repo) <= 0 {
-		repo = imageLoadedRepo
+	if _, err = io.Copy(file, imageTar); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		log.Errorf("failed to save the uploaded archive: %v", err)
+		r.CustomAbort(http.StatusInternalServerError, "")
 	}
 
-	if len(tag) <= 0 {
-		tag = imageLoadedTag
-	}
+	repo := strings.Trim(strings.TrimSpace(r.GetString("repo")), "/")
+	tag := strings.TrimSpace(r.GetString("tag"))
 
-	// docker tag imageLoaded imageToBePushed
-	imageToBePushed := os.Getenv("HARBOR_REG_URL") + "/" + project + "/" + repo + ":" + tag
-	log.Debugf("imageToBePushed: %v", imageToBePushed)
-	err = client.ImageTag(context.Background(), imageLoaded, imageToBePushed)
-	if err != nil {
-		log.Errorf("UploadImages ImageTag error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages ImageTag error: %v", err))
-	}
+	file.Close()
 
-	// ref:
-	// echo "{\"username\":\"admin\",\"password\":\"Harbor12345\"}" | base64
-	// eyJ1c2VybmFtZSI6ImFkbWluIiwicGFzc3dvcmQiOiJIYXJib3IxMjM0NSJ9Cg==
-	var authConfig = types.AuthConfig{
-		Username:      "admin",
-		Password:      os.Getenv("HARBOR_ADMIN_PASSWORD"),
-		ServerAddress: os.Getenv("HARBOR_REG_URL"),
+	if jobId == 0 {
+		jobId, err = dao.CreateJob(models.Job{
+			Type:      uploadImagesJobType,
+			Message:   fmt.Sprintf("import the uploaded archive into %s", projectName),
+			UserID:    userID,
+			ProjectID: project.ProjectID,
+		})
+		if err != nil {
+			os.Remove(file.Name())
+			log.Errorf("CreateJob error: %v", err)
+			r.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("CreateJob error: %v", err))
+		}
 	}
 
-	loginResponse, err := client.RegistryLogin(context.Background(), authConfig)
-	if err != nil {
-		log.Errorf("loginResponse error: %v", err)
-		r.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("loginResponse error: %v", err))
-	}
+	go runUploadImagesJob(jobId, user.Username, projectName, repo, tag, file.Name())
 
-	log.Debugf("loginResponse.Status: %v", loginResponse.Status)
+	r.CustomAbort(http.StatusCreated, strconv.FormatInt(jobId, 10))
+}
 
-	authConfigBytes, err := json.Marshal(&authConfig)
+// runUploadImagesJob imports the archive saved in the file as the job and removes the file
+// when the job is finished
+func runUploadImagesJob(jobId int64, username, project, repo, tag, path string) {
+	defer os.Remove(path)
 
-	authConfigB64 := base64.StdEncoding.EncodeToString(authConfigBytes)
-	log.Debugf("authConfigB64: %v", authConfigB64)
+	runJob(jobId, func(ctx *jobContext) (interface{}, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
 
-	// docker push
-	imagePushResponse, err := client.ImagePush(context.Background(), imageToBePushed, types.ImagePushOptions{
-		RegistryAuth: authConfigB64,
+		return uploadImagesJob(ctx, username, project, repo, tag, file)
 	})
-	if err != nil {
-		log.Errorf("UploadImages ImagePush error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages ImagePush error: %v", err))
-	}
-
-	imagePushResponseBody, err := ioutil.ReadAll(imagePushResponse)
-	if err != nil {
-		log.Errorf("UploadImages imagePushResponse ReadAll error: %v", err)
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages imagePushResponse ReadAll error: %v", err))
-	}
+}
 
-	imagePushResponseBodyStr := string(imagePushResponseBody)
-	log.Debugf("imagePushResponseBodyStr: %v", imagePushResponseBodyStr)
+// uploadImagesJob pushes the images in the archive into the project as the user, the pushes
+// are sent with the user agent of harbor registry client so that they are handled by the
+// notification handler like the ones from docker client
+func uploadImagesJob(ctx *jobContext, username, project, repo, tag string, archiveFile io.Reader) ([]*archive.Image, error) {
+	endpoint := os.Getenv("REGISTRY_URL")
 
-	if strings.Contains(imagePushResponseBodyStr, "denied") ||
-		strings.Contains(imagePushResponseBodyStr, "unauthorized") {
-		log.Errorf("UploadImages image push error: %v", "authentication required")
-		return dao.UpdateJobStatusById(jobId, fmt.Sprintf("UploadImages image push error: authentication required"))
+	importer := &archive.Importer{
+		NewClient: func(repository string) (*registry.Repository, error) {
+			authorizer := auth.NewUsernameTokenAuthorizer(username, "repository", repository, "pull", "push")
+			store, err := auth.NewAuthorizerStore(endpoint, api.GetIsInsecure(), authorizer)
+			if err != nil {
+				return nil, err
+			}
+			return registry.NewRepositoryWithModifiers(repository, endpoint, api.GetIsInsecure(), store,
+				&registry.UserAgentModifier{UserAgent: "harbor-registry-client"})
+		},
+		Rename: func(repository, t string) (string, string, error) {
+			name := repo
+			if len(name) == 0 {
+				if len(repository) == 0 {
+					return "", "", fmt.Errorf("repo is required as the archive does not record the repository of tag %s", t)
+				}
+				name = repository[strings.LastIndex(repository, "/")+1:]
+			}
+			if len(tag) != 0 {
+				t = tag
+			}
+			return project + "/" + name, t, nil
+		},
+		Progress: func(image *archive.Image, current, total int) {
+			ctx.Progress((current-1)*100/total, "pushing %s:%s (%d/%d)",
+				image.Repository, image.Tag, current, total)
+		},
+		Canceled: ctx.Canceled,
 	}
 
-	return dao.UpdateJobStatusById(jobId, "done")
+	images, err := importer.Import(archiveFile)
+	if len(images) > 0 {
+		if err := cache.RefreshCatalogCache(); err != nil {
+			log.Errorf("failed to refresh cache: %v", err)
+		}
+	}
+	if err == archive.ErrCanceled {
+		err = errJobCanceled
+	}
+	return images, err
 }
 
 // Get handles GET /api/v1/repos/:rid
@@ -316,6 +310,9 @@ func (r *RepositoryAPIV1) Get() {
 		log.Errorf("failed to get repository by id: %d, error: %v", repoId, err)
 		r.CustomAbort(http.StatusInternalServerError, "")
 	}
+	if repoV1 == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("repo does not exist, id: %d", repoId))
+	}
 
 	r.Data["json"] = repoV1
 	r.ServeJSON()
@@ -336,6 +333,9 @@ func (r *RepositoryAPIV1) Delete() {
 		log.Errorf("failed to get repository by id: %d, error: %v", repoId, err)
 		r.CustomAbort(http.StatusInternalServerError, "")
 	}
+	if repoV1 == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("repo does not exist, id: %d", repoId))
+	}
 
 	repoName := repoV1.Name
 	if len(repoName) == 0 {
@@ -408,6 +408,9 @@ func (r *RepositoryAPIV1) Delete() {
 			}
 		}
 		log.Infof("delete tag: %s:%s", repoName, t)
+		if err := dao.DeleteRepoTag(repoName, t); err != nil {
+			log.Errorf("failed to delete the record of tag %s:%s: %v", repoName, t, err)
+		}
 		go TriggerReplicationByRepository(repoName, []string{t}, models.RepOpDelete)
 
 		go func(tag string) {
@@ -457,6 +460,9 @@ func (r *RepositoryAPIV1) GetTags() {
 		log.Errorf("failed to get repository by id: %d, error: %v", repoId, err)
 		r.CustomAbort(http.StatusInternalServerError, "")
 	}
+	if repoV1 == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("repo does not exist, id: %d", repoId))
+	}
 
 	repoName := repoV1.Name
 	if len(repoName) == 0 {
@@ -533,6 +539,9 @@ func (r *RepositoryAPIV1) GetManifests() {
 		log.Errorf("failed to get repository by id: %d, error: %v", repoId, err)
 		r.CustomAbort(http.StatusInternalServerError, "")
 	}
+	if repoV1 == nil {
+		r.CustomAbort(http.StatusNotFound, fmt.Sprintf("repo does not exist, id: %d", repoId))
+	}
 
 	repoName := repoV1.Name
 	if len(repoName) == 0 {
@@ -36,6 +36,45 @@ type SearchAPI struct {
 type searchResult struct {
 	Project    []map[string]interface{} `json:"project"`
 	Repository []map[string]interface{} `json:"repository"`
+	// Hits contains the matched projects, repositories, tags, digests, labels, descriptions
+	// and remarks ordered by relevance, it is paginated by the parameters page and page_size
+	Hits  []*searchHit `json:"hits"`
+	Total int64        `json:"total"`
+}
+
+// the types of search hit
+const (
+	hitProject     = "project"
+	hitRepository  = "repository"
+	hitTag         = "tag"
+	hitDigest      = "digest"
+	hitLabel       = "label"
+	hitDescription = "description"
+	hitRemark      = "remark"
+)
+
+// the weights of the matched fields, names weigh more than free text
+var hitWeights = map[string]int{
+	hitProject:     10,
+	hitRepository:  10,
+	hitTag:         9,
+	hitDigest:      9,
+	hitLabel:       8,
+	hitDescription: 5,
+	hitRemark:      5,
+}
+
+type searchHit struct {
+	Type           string `json:"type"`
+	ProjectID      int64  `json:"project_id"`
+	ProjectName    string `json:"project_name"`
+	ProjectPublic  int    `json:"project_public"`
+	RepositoryName string `json:"repository_name,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	Digest         string `json:"digest,omitempty"`
+	Label          string `json:"label,omitempty"`
+	Matched        string `json:"matched"`
+	Score          int    `json:"score"`
 }
 
 // Get ...
@@ -95,10 +134,182 @@ func (s *SearchAPI) Get() {
 	sort.Strings(repositories)
 	repositoryResult := filterRepositories(repositories, projects, keyword)
 	result := &searchResult{Project: projectResult, Repository: repositoryResult}
+
+	page, pageSize := s.GetPaginationParams()
+	hits := []*searchHit{}
+	if len(keyword) > 0 {
+		hits, err = searchHits(keyword, projects, repositories)
+		if err != nil {
+			log.Errorf("failed to search %s: %v", keyword, err)
+			s.CustomAbort(http.StatusInternalServerError, "internal error")
+		}
+	}
+
+	result.Total = int64(len(hits))
+	start := (page - 1) * pageSize
+	if start > result.Total {
+		start = result.Total
+	}
+	end := start + pageSize
+	if end > result.Total {
+		end = result.Total
+	}
+	result.Hits = hits[start:end]
+
+	s.SetPaginationHeader(result.Total, page, pageSize)
 	s.Data["json"] = result
 	s.ServeJSON()
 }
 
+// searchHits searches the keyword in the names of projects, repositories, tags and labels, the
+// digests of manifests, the descriptions and remarks of repositories. Only the hits belonging
+// to the projects provided are returned and they are ordered by the score.
+func searchHits(keyword string, projects []models.Project, repositories []string) ([]*searchHit, error) {
+	projectMap := map[string]models.Project{}
+	for _, p := range projects {
+		projectMap[p.Name] = p
+	}
+
+	hits := []*searchHit{}
+	add := func(hitType, repoName, matched string) *searchHit {
+		var project models.Project
+		if hitType == hitProject {
+			project = projectMap[matched]
+		} else {
+			projectName, _ := utils.ParseRepository(repoName)
+			p, ok := projectMap[projectName]
+			if !ok {
+				return nil
+			}
+			project = p
+		}
+
+		score := matchScore(matched, keyword)
+		if score == 0 {
+			return nil
+		}
+
+		hit := &searchHit{
+			Type:           hitType,
+			ProjectID:      project.ProjectID,
+			ProjectName:    project.Name,
+			ProjectPublic:  project.Public,
+			RepositoryName: repoName,
+			Matched:        matched,
+			Score:          score * hitWeights[hitType] / 10,
+		}
+		hits = append(hits, hit)
+		return hit
+	}
+
+	for _, p := range projects {
+		add(hitProject, "", p.Name)
+	}
+
+	for _, r := range repositories {
+		_, rest := utils.ParseRepository(r)
+		if hit := add(hitRepository, r, r); hit != nil {
+			// a match of the name without project weighs the same as a match of the full name
+			if score := matchScore(rest, keyword) * hitWeights[hitRepository] / 10; score > hit.Score {
+				hit.Score = score
+			}
+		}
+	}
+
+	tags, err := dao.SearchRepoTags(keyword)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		if hit := add(hitTag, t.RepoName, t.Tag); hit != nil {
+			hit.Tag = t.Tag
+			hit.Digest = t.Digest
+		}
+		if hit := add(hitDigest, t.RepoName, t.Digest); hit != nil {
+			hit.Tag = t.Tag
+			hit.Digest = t.Digest
+		}
+	}
+
+	labelhooks, err := dao.SearchLabelHooks(keyword)
+	if err != nil {
+		return nil, err
+	}
+	// a repository is hit once by the best matched one of its labels
+	labelHits := make(map[string]*searchHit)
+	for _, l := range labelhooks {
+		if hit, ok := labelHits[l.RepoName]; ok {
+			if score := matchScore(l.LabelName, keyword) * hitWeights[hitLabel] / 10; score > hit.Score {
+				hit.Score = score
+				hit.Matched = l.LabelName
+				hit.Label = l.LabelName
+			}
+			continue
+		}
+		if hit := add(hitLabel, l.RepoName, l.LabelName); hit != nil {
+			hit.Label = l.LabelName
+			labelHits[l.RepoName] = hit
+		}
+	}
+
+	repos, err := dao.SearchRepositoriesByDescription(keyword)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repos {
+		add(hitDescription, r.Name, r.Description)
+	}
+
+	remarks, err := dao.SearchRepoRemarks(keyword)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range remarks {
+		add(hitRemark, r.RepoName, r.Remark)
+	}
+
+	sort.Stable(searchHitList(hits))
+	return hits, nil
+}
+
+// matchScore returns 100 if text equals to the keyword, 80 if text starts with it,
+// 60 if text contains it and 0 otherwise, the comparison is case insensitive
+func matchScore(text, keyword string) int {
+	text = strings.ToLower(text)
+	keyword = strings.ToLower(keyword)
+	switch {
+	case len(keyword) == 0:
+		return 0
+	case text == keyword:
+		return 100
+	case strings.HasPrefix(text, keyword):
+		return 80
+	case strings.Contains(text, keyword):
+		return 60
+	}
+	return 0
+}
+
+type searchHitList []*searchHit
+
+func (l searchHitList) Len() int {
+	return len(l)
+}
+
+func (l searchHitList) Less(i, j int) bool {
+	if l[i].Score != l[j].Score {
+		return l[i].Score > l[j].Score
+	}
+	if l[i].RepositoryName != l[j].RepositoryName {
+		return l[i].RepositoryName < l[j].RepositoryName
+	}
+	return l[i].Tag < l[j].Tag
+}
+
+func (l searchHitList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
 func filterRepositories(repositories []string, projects []models.Project, keyword string) []map[string]interface{} {
 	i, j := 0, 0
 	result := []map[string]interface{}{}
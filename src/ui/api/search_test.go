@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -40,3 +41,23 @@ func TestSearch(t *testing.T) {
 	}
 
 }
+
+func TestMatchScore(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(100, matchScore("library/Docker", "library/docker"))
+	assert.Equal(80, matchScore("library/docker", "library"))
+	assert.Equal(60, matchScore("library/docker", "dock"))
+	assert.Equal(0, matchScore("library/docker", "busybox"))
+	assert.Equal(0, matchScore("library/docker", ""))
+
+	hits := searchHitList{
+		{RepositoryName: "b", Score: 60},
+		{RepositoryName: "a", Score: 100},
+		{RepositoryName: "a", Score: 60},
+	}
+	sort.Stable(hits)
+	assert.Equal(100, hits[0].Score)
+	assert.Equal("a", hits[1].RepositoryName)
+	assert.Equal("b", hits[2].RepositoryName)
+}
@@ -16,9 +16,13 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
     "github.com/vmware/harbor/src/common/api"
 )
@@ -108,3 +112,140 @@ func (s *StatisticAPI) Get() {
 	s.Data["json"] = statistic
 	s.ServeJSON()
 }
+
+// GetTopRepos handles GET /api/statistics/top_repos, it returns the most pulled repositories
+// in the last "days" days, the result can be limited to a project by "project_id"
+func (s *StatisticAPI) GetTopRepos() {
+	count, err := s.GetInt("count", 10)
+	if err != nil || count <= 0 {
+		s.CustomAbort(http.StatusBadRequest, "invalid count")
+	}
+
+	projectIDs := s.getStatProjectIDs()
+	repos, err := dao.GetTopReposSince(projectIDs, s.getStatSince(7), count)
+	if err != nil {
+		log.Errorf("failed to get top repos: %v", err)
+		s.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	s.Data["json"] = repos
+	s.ServeJSON()
+}
+
+// GetUsage handles GET /api/statistics/usage, it returns the daily counts of pulls and pushes in
+// the last "days" days, the counts can be limited by "project_id", "repo_name" and "tag"
+func (s *StatisticAPI) GetUsage() {
+	repoName := s.GetString("repo_name")
+	tag := s.GetString("tag")
+	if len(tag) != 0 && len(repoName) == 0 {
+		s.CustomAbort(http.StatusBadRequest, "repo_name is required if tag is set")
+	}
+
+	var projectIDs []int64
+	if len(repoName) != 0 {
+		projectName, _ := utils.ParseRepository(repoName)
+		projectIDs = []int64{s.checkStatProject(projectName, 0)}
+	} else {
+		projectIDs = s.getStatProjectIDs()
+	}
+
+	points, err := dao.GetUsage(projectIDs, repoName, tag, s.getStatSince(30))
+	if err != nil {
+		log.Errorf("failed to get usage: %v", err)
+		s.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	s.Data["json"] = points
+	s.ServeJSON()
+}
+
+// GetUnusedRepos handles GET /api/statistics/unused_repos, it returns the repositories which
+// have not been pulled in the last "days" days
+func (s *StatisticAPI) GetUnusedRepos() {
+	page, pageSize := s.GetPaginationParams()
+
+	total, repos, err := dao.GetReposNotPulledSince(s.getStatProjectIDs(), s.getStatSince(90), page, pageSize)
+	if err != nil {
+		log.Errorf("failed to get unused repositories: %v", err)
+		s.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	s.SetPaginationHeader(total, page, pageSize)
+	s.Data["json"] = repos
+	s.ServeJSON()
+}
+
+// getStatSince returns the start time of the window according to the parameter "days"
+func (s *StatisticAPI) getStatSince(defaultDays int) time.Time {
+	days, err := s.GetInt("days", defaultDays)
+	if err != nil || days <= 0 {
+		s.CustomAbort(http.StatusBadRequest, "invalid days")
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return today.AddDate(0, 0, 1-days)
+}
+
+// getStatProjectIDs returns the IDs of projects whose statistics can be read by the user,
+// nil means all the projects. If "project_id" is set, only the project is returned.
+func (s *StatisticAPI) getStatProjectIDs() []int64 {
+	projectID, err := s.GetInt64("project_id", 0)
+	if err != nil || projectID < 0 {
+		s.CustomAbort(http.StatusBadRequest, "invalid project_id")
+	}
+
+	if projectID > 0 {
+		return []int64{s.checkStatProject("", projectID)}
+	}
+
+	isAdmin, err := dao.IsAdminRole(s.userID)
+	if err != nil {
+		log.Errorf("Error occured in check admin, error: %v", err)
+		s.CustomAbort(http.StatusInternalServerError, "Internal error.")
+	}
+	if isAdmin {
+		return nil
+	}
+
+	projects, err := dao.SearchProjects(s.userID)
+	if err != nil {
+		log.Errorf("failed to get user %d 's relevant projects: %v", s.userID, err)
+		s.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	projectIDs := []int64{}
+	for _, p := range projects {
+		projectIDs = append(projectIDs, p.ProjectID)
+	}
+	return projectIDs
+}
+
+// checkStatProject checks whether the user can read the project specified by name or ID
+// and returns the ID of the project
+func (s *StatisticAPI) checkStatProject(name string, id int64) int64 {
+	var project *models.Project
+	var err error
+	if len(name) != 0 {
+		project, err = dao.GetProjectByName(name)
+	} else {
+		project, err = dao.GetProjectByID(id)
+	}
+	if err != nil {
+		log.Errorf("failed to get project %s(%d): %v", name, id, err)
+		s.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if project == nil {
+		if len(name) == 0 {
+			name = fmt.Sprintf("%d", id)
+		}
+		s.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", name))
+	}
+
+	if project.Public == 0 && !checkProjectPermission(s.userID, project.ProjectID) {
+		s.CustomAbort(http.StatusForbidden, "")
+	}
+
+	return project.ProjectID
+}
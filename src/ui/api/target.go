@@ -17,11 +17,14 @@ package api
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
@@ -58,7 +61,7 @@ func (t *TargetAPI) Prepare() {
 
 // Ping validates whether the target is reachable and whether the credential is valid
 func (t *TargetAPI) Ping() {
-	var endpoint, username, password string
+	target := &models.RepTarget{}
 
 	idStr := t.GetString("id")
 	if len(idStr) != 0 {
@@ -67,7 +70,7 @@ func (t *TargetAPI) Ping() {
 			t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("id %s is invalid", idStr))
 		}
 
-		target, err := dao.GetRepTarget(id)
+		target, err = dao.GetRepTarget(id)
 		if err != nil {
 			log.Errorf("failed to get target %d: %v", id, err)
 			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
@@ -77,29 +80,43 @@ func (t *TargetAPI) Ping() {
 			t.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		}
 
-		endpoint = target.URL
-		username = target.Username
-		password = target.Password
-
-		if len(password) != 0 {
-			password, err = utils.ReversibleDecrypt(password, t.secretKey)
-			if err != nil {
-				log.Errorf("failed to decrypt password: %v", err)
-				t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-			}
-		}
+		t.decryptTarget(target)
 	} else {
-		endpoint = t.GetString("endpoint")
-		if len(endpoint) == 0 {
+		target.URL = t.GetString("endpoint")
+		if len(target.URL) == 0 {
 			t.CustomAbort(http.StatusBadRequest, "id or endpoint is needed")
 		}
 
-		username = t.GetString("username")
-		password = t.GetString("password")
+		target.Username = t.GetString("username")
+		target.Password = t.GetString("password")
+		target.Token = t.GetString("token")
+		target.CACert = t.GetString("ca_cert")
+		target.ClientCert = t.GetString("client_cert")
+		target.ClientKey = t.GetString("client_key")
+
+		var err error
+		target.Type, err = t.GetInt("type", models.TargetTypeHarbor)
+		if err != nil || (target.Type != models.TargetTypeHarbor && target.Type != models.TargetTypeRegistry) {
+			t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("type %s is invalid", t.GetString("type")))
+		}
+
+		target.CredentialType = t.GetString("credential_type", models.TargetCredentialBasic)
+		if target.CredentialType != models.TargetCredentialBasic && target.CredentialType != models.TargetCredentialBearer {
+			t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("credential_type %s is invalid", target.CredentialType))
+		}
+
+		target.Insecure, err = t.GetInt("insecure", 0)
+		if err != nil || (target.Insecure != 0 && target.Insecure != 1) {
+			t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("insecure %s is invalid", t.GetString("insecure")))
+		}
+	}
+
+	credential, transport, err := targetConnection(target)
+	if err != nil {
+		t.CustomAbort(http.StatusBadRequest, err.Error())
 	}
 
-	registry, err := newRegistryClient(endpoint, api.GetIsInsecure(), username, password,
-		"", "", "")
+	registry, err := newRegistryClient(target.URL, transport, credential, "", "", "")
 	if err != nil {
 		// timeout, dns resolve error, connection refused, etc.
 		if urlErr, ok := err.(*url.Error); ok {
@@ -122,6 +139,83 @@ func (t *TargetAPI) Ping() {
 		log.Errorf("failed to ping registry %s: %v", registry.Endpoint.String(), err)
 		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
+
+	// the projects are created and the repositories are deleted through the API of
+	// Harbor, so the API has to be accessible with the credential
+	if target.Type == models.TargetTypeHarbor {
+		if err = pingHarbor(target.URL, credential, transport); err != nil {
+			if regErr, ok := err.(*registry_error.Error); ok {
+				t.CustomAbort(regErr.StatusCode, regErr.Detail)
+			}
+
+			log.Errorf("failed to ping the API of Harbor %s: %v", target.URL, err)
+			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+	}
+}
+
+// targetConnection returns the credential and the transport to connect to the target whose
+// secrets are decrypted, the certificate of the target isn't verified if the target is insecure
+// or the verification of remote certificates is disabled globally
+func targetConnection(target *models.RepTarget) (auth.Credential, *http.Transport, error) {
+	var credential auth.Credential
+	if target.CredentialType == models.TargetCredentialBearer {
+		credential = auth.NewBearerTokenCredential(target.Token)
+	} else {
+		credential = auth.NewBasicAuthCredential(target.Username, target.Password)
+	}
+
+	transport, err := registry.GetTargetHTTPTransport(target.ID, target.Insecure == 1 || api.GetIsInsecure(),
+		target.CACert, target.ClientCert, target.ClientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return credential, transport, nil
+}
+
+// pingHarbor checks whether the endpoint is a Harbor instance by getting the current user
+// through its API
+func pingHarbor(endpoint string, credential auth.Credential, transport *http.Transport) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(endpoint, "/")+"/api/users/current", nil)
+	if err != nil {
+		return err
+	}
+	credential.AddAuthorization(req)
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &registry_error.Error{
+			StatusCode: http.StatusBadRequest,
+			Detail:     err.Error(),
+		}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return &registry_error.Error{
+			StatusCode: http.StatusUnauthorized,
+			Detail:     "invalid credential for the API of Harbor",
+		}
+	case http.StatusNotFound:
+		return &registry_error.Error{
+			StatusCode: http.StatusBadRequest,
+			Detail:     fmt.Sprintf("%s is not a Harbor instance, set the type of the target to docker registry", endpoint),
+		}
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected response of the API of Harbor: %d %s", resp.StatusCode, string(b))
 }
 
 // Get ...
@@ -141,14 +235,8 @@ func (t *TargetAPI) Get() {
 	// The reason why the password is returned is that when user just wants to
 	// modify other fields of target he does not need to input the password again.
 	// The security issue can be fixed by enable https.
-	if len(target.Password) != 0 {
-		pwd, err := utils.ReversibleDecrypt(target.Password, t.secretKey)
-		if err != nil {
-			log.Errorf("failed to decrypt password: %v", err)
-			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-		}
-		target.Password = pwd
-	}
+	t.decryptTarget(target)
+	hideSecrets(target)
 
 	t.Data["json"] = target
 	t.ServeJSON()
@@ -164,16 +252,8 @@ func (t *TargetAPI) List() {
 	}
 
 	for _, target := range targets {
-		if len(target.Password) == 0 {
-			continue
-		}
-
-		str, err := utils.ReversibleDecrypt(target.Password, t.secretKey)
-		if err != nil {
-			log.Errorf("failed to decrypt password: %v", err)
-			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-		}
-		target.Password = str
+		t.decryptTarget(target)
+		hideSecrets(target)
 	}
 
 	t.Data["json"] = targets
@@ -206,13 +286,7 @@ func (t *TargetAPI) Post() {
 		t.CustomAbort(http.StatusConflict, fmt.Sprintf("the target whose endpoint is %s already exists", target.URL))
 	}
 
-	if len(target.Password) != 0 {
-		target.Password, err = utils.ReversibleEncrypt(target.Password, t.secretKey)
-		if err != nil {
-			log.Errorf("failed to encrypt password: %v", err)
-			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-		}
-	}
+	t.encryptTarget(target)
 
 	id, err := dao.AddRepTarget(*target)
 	if err != nil {
@@ -256,7 +330,19 @@ func (t *TargetAPI) Put() {
 	}
 
 	target := &models.RepTarget{}
-	t.DecodeJSONReqAndValidate(target)
+	t.DecodeJSONReq(target)
+
+	// the token and the client key are not returned, keep the stored ones if they are not input
+	if len(target.Token) == 0 || len(target.ClientKey) == 0 {
+		t.decryptTarget(originalTarget)
+		if len(target.Token) == 0 && target.CredentialType == models.TargetCredentialBearer {
+			target.Token = originalTarget.Token
+		}
+		if len(target.ClientKey) == 0 && len(target.ClientCert) != 0 {
+			target.ClientKey = originalTarget.ClientKey
+		}
+	}
+	t.Validate(target)
 
 	if target.Name != originalTarget.Name {
 		ta, err := dao.GetRepTargetByName(target.Name)
@@ -284,13 +370,7 @@ func (t *TargetAPI) Put() {
 
 	target.ID = id
 
-	if len(target.Password) != 0 {
-		target.Password, err = utils.ReversibleEncrypt(target.Password, t.secretKey)
-		if err != nil {
-			log.Errorf("failed to encrypt password: %v", err)
-			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-		}
-	}
+	t.encryptTarget(target)
 
 	if err := dao.UpdateRepTarget(*target); err != nil {
 		log.Errorf("failed to update target %d: %v", id, err)
@@ -298,6 +378,48 @@ func (t *TargetAPI) Put() {
 	}
 }
 
+type transferSettingsReq struct {
+	BandwidthLimit  int    `json:"bandwidth_limit"`
+	TransferWindows string `json:"transfer_windows"`
+}
+
+// UpdateTransferSettings changes the bandwidth limit and the transfer windows of the target,
+// they can be changed even if the target is used by enabled policies and take effect on the
+// jobs started afterwards
+func (t *TargetAPI) UpdateTransferSettings() {
+	id := t.GetIDFromURL()
+
+	target, err := dao.GetRepTarget(id)
+	if err != nil {
+		log.Errorf("failed to get target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if target == nil {
+		t.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	req := &transferSettingsReq{}
+	t.DecodeJSONReq(req)
+
+	if req.BandwidthLimit < 0 {
+		t.CustomAbort(http.StatusBadRequest, "bandwidth_limit can not be negative")
+	}
+
+	if len(req.TransferWindows) > 256 {
+		t.CustomAbort(http.StatusBadRequest, "max length of transfer_windows is 256")
+	}
+
+	if _, err = utils.ParseTimeWindows(req.TransferWindows); err != nil {
+		t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("invalid transfer_windows: %v", err))
+	}
+
+	if err = dao.UpdateRepTargetTransferSettings(id, req.BandwidthLimit, req.TransferWindows); err != nil {
+		log.Errorf("failed to update transfer settings of target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
 // Delete ...
 func (t *TargetAPI) Delete() {
 	id := t.GetIDFromURL()
@@ -328,17 +450,52 @@ func (t *TargetAPI) Delete() {
 	}
 }
 
-func newRegistryClient(endpoint string, insecure bool, username, password, scopeType, scopeName string,
+// encryptTarget encrypts the password, token and client key of the target
+func (t *TargetAPI) encryptTarget(target *models.RepTarget) {
+	for _, secret := range []*string{&target.Password, &target.Token, &target.ClientKey} {
+		if len(*secret) == 0 {
+			continue
+		}
+		str, err := utils.ReversibleEncrypt(*secret, t.secretKey)
+		if err != nil {
+			log.Errorf("failed to encrypt secret of target: %v", err)
+			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		*secret = str
+	}
+}
+
+// decryptTarget decrypts the password, token and client key of the target
+func (t *TargetAPI) decryptTarget(target *models.RepTarget) {
+	for _, secret := range []*string{&target.Password, &target.Token, &target.ClientKey} {
+		if len(*secret) == 0 {
+			continue
+		}
+		str, err := utils.ReversibleDecrypt(*secret, t.secretKey)
+		if err != nil {
+			log.Errorf("failed to decrypt secret of target %d: %v", target.ID, err)
+			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		*secret = str
+	}
+}
+
+// hideSecrets clears the token and the client key of the target which are not returned by the API
+func hideSecrets(target *models.RepTarget) {
+	target.Token = ""
+	target.ClientKey = ""
+}
+
+func newRegistryClient(endpoint string, transport *http.Transport, credential auth.Credential, scopeType, scopeName string,
 	scopeActions ...string) (*registry.Registry, error) {
-	credential := auth.NewBasicAuthCredential(username, password)
-	authorizer := auth.NewStandardTokenAuthorizer(credential, insecure, scopeType, scopeName, scopeActions...)
+	authorizer := auth.NewCredentialAuthorizer(credential, transport, scopeType, scopeName, scopeActions...)
 
-	store, err := auth.NewAuthorizerStore(endpoint, insecure, authorizer)
+	store, err := auth.NewAuthorizerStoreWithTransport(endpoint, transport, authorizer)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := registry.NewRegistryWithModifiers(endpoint, insecure, store)
+	client, err := registry.NewRegistryWithTransport(endpoint, transport, store)
 	if err != nil {
 		return nil, err
 	}
@@ -368,3 +525,27 @@ func (t *TargetAPI) ListPolicies() {
 	t.Data["json"] = policies
 	t.ServeJSON()
 }
+
+// GetStatistics returns the statistics of the replication jobs of the policies whose target is the one
+func (t *TargetAPI) GetStatistics() {
+	id := t.GetIDFromURL()
+
+	target, err := dao.GetRepTarget(id)
+	if err != nil {
+		log.Errorf("failed to get target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if target == nil {
+		t.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	stats, err := dao.GetRepTargetStats(id)
+	if err != nil {
+		log.Errorf("failed to get statistics of target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	t.Data["json"] = stats
+	t.ServeJSON()
+}
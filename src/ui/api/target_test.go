@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/tests/apitests/apilib"
 )
 
@@ -24,7 +25,7 @@ func TestTargetsPost(t *testing.T) {
 	apiTest := newHarborAPI()
 
 	endPoint := os.Getenv("REGISTRY_URL")
-	repTargets := &apilib.RepTargetPost{endPoint, addTargetName, adminName, adminPwd}
+	repTargets := &apilib.RepTargetPost{endPoint, addTargetName, adminName, adminPwd, int32(models.TargetTypeRegistry)}
 
 	fmt.Println("Testing Targets Post API")
 
@@ -180,7 +181,7 @@ func TestTargetsPut(t *testing.T) {
 	apiTest := newHarborAPI()
 
 	endPoint := "1.1.1.1"
-	updateRepTargets := &apilib.RepTargetPost{endPoint, addTargetName, adminName, adminPwd}
+	updateRepTargets := &apilib.RepTargetPost{endPoint, addTargetName, adminName, adminPwd, int32(models.TargetTypeRegistry)}
 	id := strconv.Itoa(addTargetID)
 
 	fmt.Println("Testing Target Put API")
@@ -0,0 +1,358 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+const (
+	uploadImagesJobType = "upload_images"
+	// the sessions which are not updated in the duration are removed
+	uploadSessionTTL = 24 * time.Hour
+)
+
+// the lock of each session, so that the chunks of a session are written in sequence
+var uploadLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: map[string]*sync.Mutex{}}
+
+// UploadAPIV1 handles request to /api/v1/uploads /api/v1/uploads/:uuid /api/v1/uploads/:uuid/finalize,
+// the image archive is uploaded in chunks which can be resumed from the offset of the session and
+// is imported by a job once the session is finalized.
+type UploadAPIV1 struct {
+	api.BaseAPI
+	userID  int
+	session *models.UploadSession
+}
+
+type createUploadReq struct {
+	Project string `json:"project"`
+	Repo    string `json:"repo"`
+	Tag     string `json:"tag"`
+	// Size is the size of the archive, it is optional
+	Size int64 `json:"size"`
+}
+
+// Prepare validates the user and loads the session
+func (u *UploadAPIV1) Prepare() {
+	u.userID = u.ValidateUser()
+
+	uuid := u.Ctx.Input.Param(":uuid")
+	if len(uuid) == 0 {
+		return
+	}
+
+	session, err := dao.GetUploadSession(uuid)
+	if err != nil {
+		log.Errorf("failed to get upload session %s: %v", uuid, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if session == nil || session.UserID != u.userID {
+		u.CustomAbort(http.StatusNotFound, fmt.Sprintf("upload session %s not found", uuid))
+	}
+	u.session = session
+}
+
+// Post handles POST /api/v1/uploads, it creates an upload session
+func (u *UploadAPIV1) Post() {
+	var req createUploadReq
+	u.DecodeJSONReq(&req)
+
+	if len(req.Project) == 0 {
+		u.CustomAbort(http.StatusBadRequest, "project is required")
+	}
+	if req.Size < 0 {
+		u.CustomAbort(http.StatusBadRequest, "size can not be negative")
+	}
+
+	project, err := dao.GetProjectByName(req.Project)
+	if err != nil {
+		log.Errorf("failed to get project %s: %v", req.Project, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if project == nil {
+		u.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", req.Project))
+	}
+	if !hasProjectPushRole(u.userID, project.ProjectID) {
+		u.CustomAbort(http.StatusForbidden, "")
+	}
+
+	if err = os.MkdirAll(uploadDir(), 0700); err != nil {
+		log.Errorf("failed to create directory %s: %v", uploadDir(), err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	session := &models.UploadSession{
+		UUID:        utils.GenerateRandomString(),
+		UserID:      u.userID,
+		ProjectName: req.Project,
+		Repo:        strings.Trim(strings.TrimSpace(req.Repo), "/"),
+		Tag:         strings.TrimSpace(req.Tag),
+		Size:        req.Size,
+	}
+	if _, err = dao.AddUploadSession(session); err != nil {
+		log.Errorf("failed to add upload session: %v", err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	u.Ctx.Output.SetStatus(http.StatusCreated)
+	u.Data["json"] = session
+	u.ServeJSON()
+}
+
+// Get handles GET /api/v1/uploads/:uuid, it returns the session whose offset is where the
+// next chunk starts
+func (u *UploadAPIV1) Get() {
+	u.Data["json"] = u.session
+	u.ServeJSON()
+}
+
+// Put handles PUT /api/v1/uploads/:uuid?offset=, the body is the chunk of the archive starting
+// from the offset, which must be the offset of the session. 416 is returned with the offset of
+// the session if they mismatch, so that the client can resume from there.
+func (u *UploadAPIV1) Put() {
+	offset, err := u.GetInt64("offset", 0)
+	if err != nil || offset < 0 {
+		u.CustomAbort(http.StatusBadRequest, "invalid offset")
+	}
+
+	lock := lockUploadSession(u.session.UUID)
+	defer lock.Unlock()
+
+	// reload the session as other chunks may be written before the lock is acquired
+	session, err := dao.GetUploadSession(u.session.UUID)
+	if err != nil {
+		log.Errorf("failed to get upload session %s: %v", u.session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if session == nil {
+		u.CustomAbort(http.StatusNotFound, fmt.Sprintf("upload session %s not found", u.session.UUID))
+	}
+	if session.Status != models.UploadSessionUploading {
+		u.CustomAbort(http.StatusConflict, fmt.Sprintf("upload session %s has been finalized", session.UUID))
+	}
+	if offset != session.Offset {
+		u.Ctx.ResponseWriter.Header().Set("Range", fmt.Sprintf("0-%d", session.Offset-1))
+		u.CustomAbort(http.StatusRequestedRangeNotSatisfiable, strconv.FormatInt(session.Offset, 10))
+	}
+
+	file, err := os.OpenFile(uploadPath(session.UUID), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Errorf("failed to open the file of upload session %s: %v", session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	defer file.Close()
+
+	// drop the data of the chunk which was written but not recorded
+	if err = file.Truncate(session.Offset); err == nil {
+		_, err = file.Seek(session.Offset, io.SeekStart)
+	}
+	if err != nil {
+		log.Errorf("failed to seek the file of upload session %s: %v", session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	var body io.Reader = u.Ctx.Request.Body
+	if session.Size > 0 {
+		// read one more byte to detect the chunk exceeding the size
+		body = io.LimitReader(body, session.Size-session.Offset+1)
+	}
+	n, err := io.Copy(file, body)
+	if err != nil {
+		log.Errorf("failed to write the chunk of upload session %s: %v", session.UUID, err)
+		if n == 0 {
+			u.CustomAbort(http.StatusInternalServerError, "")
+		}
+		// keep the data received, the client can resume from the new offset
+	}
+
+	if session.Size > 0 && session.Offset+n > session.Size {
+		if err := file.Truncate(session.Offset); err != nil {
+			log.Errorf("failed to truncate the file of upload session %s: %v", session.UUID, err)
+		}
+		u.CustomAbort(http.StatusBadRequest, fmt.Sprintf("the chunk exceeds the size %d", session.Size))
+	}
+
+	session.Offset += n
+	if err = dao.UpdateUploadSessionOffset(session.UUID, session.Offset); err != nil {
+		log.Errorf("failed to update the offset of upload session %s: %v", session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	u.Ctx.Output.SetStatus(http.StatusAccepted)
+	u.Data["json"] = session
+	u.ServeJSON()
+}
+
+// Finalize handles POST /api/v1/uploads/:uuid/finalize, it imports the uploaded archive as a job
+// and returns the ID of the job, the progress can be checked via /api/v1/jobs/:jid
+func (u *UploadAPIV1) Finalize() {
+	lock := lockUploadSession(u.session.UUID)
+	defer releaseUploadSession(u.session.UUID, lock)
+
+	session, err := dao.GetUploadSession(u.session.UUID)
+	if err != nil {
+		log.Errorf("failed to get upload session %s: %v", u.session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if session == nil {
+		u.CustomAbort(http.StatusNotFound, fmt.Sprintf("upload session %s not found", u.session.UUID))
+	}
+	if session.Status != models.UploadSessionUploading {
+		u.CustomAbort(http.StatusConflict, fmt.Sprintf("upload session %s has been finalized", session.UUID))
+	}
+	if session.Offset == 0 || (session.Size > 0 && session.Offset != session.Size) {
+		u.CustomAbort(http.StatusBadRequest, fmt.Sprintf("the upload is incomplete, %d of %d bytes are uploaded",
+			session.Offset, session.Size))
+	}
+
+	user, err := dao.GetUser(models.User{UserID: u.userID})
+	if err != nil || user == nil {
+		log.Errorf("failed to get user %d: %v", u.userID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	// the chunk which was written but not recorded is dropped before importing
+	if err = os.Truncate(uploadPath(session.UUID), session.Offset); err != nil {
+		log.Errorf("failed to truncate the file of upload session %s: %v", session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	project, err := dao.GetProjectByName(session.ProjectName)
+	if err != nil {
+		log.Errorf("failed to get project %s: %v", session.ProjectName, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if project == nil {
+		u.CustomAbort(http.StatusNotFound, fmt.Sprintf("project %s not found", session.ProjectName))
+	}
+
+	jobID, err := dao.CreateJob(models.Job{
+		Type:      uploadImagesJobType,
+		Message:   fmt.Sprintf("import the archive uploaded in session %s", session.UUID),
+		UserID:    u.userID,
+		ProjectID: project.ProjectID,
+	})
+	if err != nil {
+		log.Errorf("CreateJob error: %v", err)
+		u.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("CreateJob error: %v", err))
+	}
+
+	finalized, err := dao.FinalizeUploadSession(session.UUID, jobID)
+	if err != nil {
+		log.Errorf("failed to finalize upload session %s: %v", session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if !finalized {
+		u.CustomAbort(http.StatusConflict, fmt.Sprintf("upload session %s has been finalized", session.UUID))
+	}
+
+	go runUploadImagesJob(jobID, user.Username, session.ProjectName, session.Repo, session.Tag,
+		uploadPath(session.UUID))
+
+	u.CustomAbort(http.StatusCreated, strconv.FormatInt(jobID, 10))
+}
+
+// Delete handles DELETE /api/v1/uploads/:uuid, it aborts the upload
+func (u *UploadAPIV1) Delete() {
+	lock := lockUploadSession(u.session.UUID)
+	defer releaseUploadSession(u.session.UUID, lock)
+
+	if err := removeUploadSession(u.session); err != nil {
+		log.Errorf("failed to remove upload session %s: %v", u.session.UUID, err)
+		u.CustomAbort(http.StatusInternalServerError, "")
+	}
+}
+
+// CleanUploadSessions removes the upload sessions which are not updated for a day periodically,
+// the file of finalized sessions has been removed by the job
+func CleanUploadSessions() {
+	for {
+		sessions, err := dao.GetStaleUploadSessions(time.Now().Add(-uploadSessionTTL))
+		if err != nil {
+			log.Errorf("failed to get stale upload sessions: %v", err)
+		}
+
+		for _, session := range sessions {
+			log.Debugf("remove stale upload session %s", session.UUID)
+			if err = removeUploadSession(session); err != nil {
+				log.Errorf("failed to remove upload session %s: %v", session.UUID, err)
+			}
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
+
+func removeUploadSession(session *models.UploadSession) error {
+	if session.Status == models.UploadSessionUploading {
+		if err := os.Remove(uploadPath(session.UUID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return dao.DeleteUploadSession(session.UUID)
+}
+
+func lockUploadSession(uuid string) *sync.Mutex {
+	uploadLocks.Lock()
+	lock, ok := uploadLocks.locks[uuid]
+	if !ok {
+		lock = &sync.Mutex{}
+		uploadLocks.locks[uuid] = lock
+	}
+	uploadLocks.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+// releaseUploadSession unlocks the session and forgets its lock, the requests waiting for the
+// lock find the session finalized or removed once they get it
+func releaseUploadSession(uuid string, lock *sync.Mutex) {
+	uploadLocks.Lock()
+	delete(uploadLocks.locks, uuid)
+	uploadLocks.Unlock()
+
+	lock.Unlock()
+}
+
+func uploadDir() string {
+	dir := os.Getenv("UPLOAD_DIR")
+	if len(dir) == 0 {
+		dir = filepath.Join(os.TempDir(), "harbor-uploads")
+	}
+	return dir
+}
+
+func uploadPath(uuid string) string {
+	return filepath.Join(uploadDir(), uuid)
+}
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -62,6 +63,23 @@ func hasProjectAdminRole(userID int, projectID int64) bool {
 	return false
 }
 
+// hasProjectPushRole returns whether the user can push images into the project
+func hasProjectPushRole(userID int, projectID int64) bool {
+	roles, err := listRoles(userID, projectID)
+	if err != nil {
+		log.Errorf("error occurred in getProjectPermission: %v", err)
+		return false
+	}
+
+	for _, role := range roles {
+		if role.RoleID == models.PROJECTADMIN || role.RoleID == models.DEVELOPER {
+			return true
+		}
+	}
+
+	return false
+}
+
 //sysadmin has all privileges to all projects
 func listRoles(userID int, projectID int64) ([]models.Role, error) {
 	roles := make([]models.Role, 0, 1)
@@ -176,10 +194,22 @@ func TriggerReplicationByRepository(repository string, tags []string, operation
 	}
 
 	for _, policy := range policies {
-		if policy.Enabled == 0 {
+		// the policies pulling into the project are not triggered by the changes of the project
+		if policy.Enabled == 0 || policy.Mode == models.RepModePull {
+			continue
+		}
+		if !utils.MatchPatterns(policy.RepoFilter, repository) {
+			log.Debugf("%s doesn't match the repository filter of policy %d: %s", repository, policy.ID, policy.RepoFilter)
 			continue
 		}
-		if err := TriggerReplication(policy.ID, repository, tags, operation); err != nil {
+		policyTags := tags
+		if len(tags) != 0 {
+			if policyTags = utils.FilterByPatterns(policy.TagFilter, tags); len(policyTags) == 0 {
+				log.Debugf("no tag of %s matches the tag filter of policy %d: %s", repository, policy.ID, policy.TagFilter)
+				continue
+			}
+		}
+		if err := TriggerReplication(policy.ID, repository, policyTags, operation); err != nil {
 			log.Errorf("failed to trigger replication of policy %d for %s: %v", policy.ID, repository, err)
 		} else {
 			log.Infof("replication of policy %d for %s triggered", policy.ID, repository)
@@ -533,11 +563,50 @@ func buildReplicationURL() string {
 	return fmt.Sprintf("%s/api/jobs/replication", url)
 }
 
+func buildJobQueueURL() string {
+	url := getJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/queue", url)
+}
+
+func buildJobDryRunURL(policyID int64) string {
+	url := getJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/dryrun?policy_id=%d", url, policyID)
+}
+
+func buildJobVerifyURL() string {
+	url := getJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/verify", url)
+}
+
 func buildJobLogURL(jobID string) string {
 	url := getJobServiceURL()
 	return fmt.Sprintf("%s/api/jobs/replication/%s/log", url, jobID)
 }
 
+// deleteJobLog removes the log of the job in job service
+func deleteJobLog(jobID int64) error {
+	req, err := http.NewRequest("DELETE", buildJobLogURL(strconv.FormatInt(jobID, 10)), nil)
+	if err != nil {
+		return err
+	}
+	addAuthentication(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%d %s", resp.StatusCode, string(b))
+}
+
 func buildReplicationActionURL() string {
 	url := getJobServiceURL()
 	return fmt.Sprintf("%s/api/jobs/replication/actions", url)
@@ -90,6 +90,8 @@ func main() {
 	}
 
 	go api.SyncImageAnalysis()
+	go api.CleanUploadSessions()
+	go api.CleanJobs()
 
 	beego.Run()
 }
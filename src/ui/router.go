@@ -62,6 +62,9 @@ func initRouters() {
 	beego.Router("/api/projects/:id", &api.ProjectAPI{})
 	beego.Router("/api/projects/:id/publicity", &api.ProjectAPI{}, "put:ToggleProjectPublic")
 	beego.Router("/api/statistics", &api.StatisticAPI{})
+	beego.Router("/api/statistics/top_repos", &api.StatisticAPI{}, "get:GetTopRepos")
+	beego.Router("/api/statistics/usage", &api.StatisticAPI{}, "get:GetUsage")
+	beego.Router("/api/statistics/unused_repos", &api.StatisticAPI{}, "get:GetUnusedRepos")
 	beego.Router("/api/projects/:id([0-9]+)/logs/filter", &api.ProjectAPI{}, "post:FilterAccessLog")
 
 	beego.Router("/api/labels/?:id", &api.LabelAPI{})
@@ -78,6 +81,8 @@ func initRouters() {
 	beego.Router("/api/repositories/conditions", &api.RepositoryAPI{}, "post:GetRepositoryWithConditions")
 	beego.Router("/api/repositories/tags", &api.RepositoryAPI{}, "get:GetTags")
 	beego.Router("/api/repositories/manifests", &api.RepositoryAPI{}, "get:GetManifests")
+	beego.Router("/api/repositories/diff", &api.RepositoryAPI{}, "get:GetDiff")
+	beego.Router("/api/repositories/export", &api.RepositoryAPI{}, "get:Export")
 	beego.Router("/api/repositories/vulnerabilities", &api.RepositoryAPI{}, "get:GetVulnerabilities")
 	beego.Router("/api/repositories/unmarked", &api.RepositoryAPI{}, "post:GetUnmarkedRepos")
 	beego.Router("/api/repositories/list", &api.RepositoryAPI{}, "get:List")
@@ -85,14 +90,22 @@ func initRouters() {
 	beego.Router("/api/jobs/replication/", &api.RepJobAPI{}, "get:List")
 	beego.Router("/api/jobs/replication/:id([0-9]+)", &api.RepJobAPI{})
 	beego.Router("/api/jobs/replication/:id([0-9]+)/log", &api.RepJobAPI{}, "get:GetLog")
+	beego.Router("/api/jobs/replication/queue", &api.RepJobAPI{}, "get:GetQueue")
 	beego.Router("/api/policies/replication/:id([0-9]+)", &api.RepPolicyAPI{})
 	beego.Router("/api/policies/replication", &api.RepPolicyAPI{}, "get:List")
 	beego.Router("/api/policies/replication", &api.RepPolicyAPI{}, "post:Post")
 	beego.Router("/api/policies/replication/:id([0-9]+)/enablement", &api.RepPolicyAPI{}, "put:UpdateEnablement")
+	beego.Router("/api/policies/replication/:id([0-9]+)/schedule", &api.RepPolicyAPI{}, "get:GetSchedule")
+	beego.Router("/api/policies/replication/:id([0-9]+)/trigger", &api.RepPolicyAPI{}, "post:Trigger")
+	beego.Router("/api/policies/replication/:id([0-9]+)/statistics", &api.RepPolicyAPI{}, "get:GetStatistics")
+	beego.Router("/api/policies/replication/:id([0-9]+)/dryrun", &api.RepPolicyAPI{}, "get:DryRun")
+	beego.Router("/api/policies/replication/:id([0-9]+)/verification", &api.RepPolicyAPI{}, "post:Verify;get:GetVerification")
 	beego.Router("/api/targets/", &api.TargetAPI{}, "get:List")
 	beego.Router("/api/targets/", &api.TargetAPI{}, "post:Post")
 	beego.Router("/api/targets/:id([0-9]+)", &api.TargetAPI{})
 	beego.Router("/api/targets/:id([0-9]+)/policies/", &api.TargetAPI{}, "get:ListPolicies")
+	beego.Router("/api/targets/:id([0-9]+)/transfer", &api.TargetAPI{}, "put:UpdateTransferSettings")
+	beego.Router("/api/targets/:id([0-9]+)/statistics", &api.TargetAPI{}, "get:GetStatistics")
 	beego.Router("/api/targets/ping", &api.TargetAPI{}, "post:Ping")
 	beego.Router("/api/users/:id/sysadmin", &api.UserAPI{}, "put:ToggleUserAdminRole")
 	beego.Router("/api/repositories/top", &api.RepositoryAPI{}, "get:GetTopRepos")
@@ -114,10 +127,17 @@ func initV1Routers() {
 	// repos
 	beego.Router("/api/v1/repos", &api.RepositoryAPIV1{}, "get:List;post:UploadImages")
 	beego.Router("/api/v1/repos/:rid", &api.RepositoryAPIV1{}, "get:Get;delete:Delete")
+	beego.Router("/api/v1/repos/:rid/move", &api.RepositoryAPIV1{}, "post:Move")
 	beego.Router("/api/v1/repos/:rid/tags", &api.RepositoryAPIV1{}, "get:GetTags")
 	beego.Router("/api/v1/repos/:rid/tags/:tag", &api.RepositoryAPIV1{}, "get:GetManifests;delete:Delete")
 
 	// jobs
-	beego.Router("/api/v1/jobs", &api.JobAPIV1{}, "post:Post")
+	beego.Router("/api/v1/jobs", &api.JobAPIV1{}, "get:List;post:Post")
 	beego.Router("/api/v1/jobs/:jid", &api.JobAPIV1{}, "get:GetJob")
+	beego.Router("/api/v1/jobs/:jid/cancel", &api.JobAPIV1{}, "post:Cancel")
+
+	// uploads
+	beego.Router("/api/v1/uploads", &api.UploadAPIV1{}, "post:Post")
+	beego.Router("/api/v1/uploads/:uuid", &api.UploadAPIV1{}, "get:Get;put:Put;delete:Delete")
+	beego.Router("/api/v1/uploads/:uuid/finalize", &api.UploadAPIV1{}, "post:Finalize")
 }
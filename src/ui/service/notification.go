@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
@@ -59,6 +60,7 @@ func (n *NotificationHandler) Post() {
 
 		project, _ := utils.ParseRepository(repository)
 		tag := event.Target.Tag
+		digest := event.Target.Digest
 		action := event.Action
 
 		user := event.Actor.Name
@@ -70,21 +72,29 @@ func (n *NotificationHandler) Post() {
 			if err := dao.AccessLog(user, project, repository, tag, action); err != nil {
 				log.Errorf("failed to add access log: %v", err)
 			}
+			if err := dao.IncreaseRepoDailyStat(repository, tag, action, time.Now()); err != nil {
+				log.Errorf("failed to increase the daily %s count of %s:%s: %v", action, repository, tag, err)
+			}
 		}()
 		if action == "push" {
 			go func() {
-				exist := dao.RepositoryExists(repository)
-				if exist {
-					return
-				}
-				log.Debugf("Add repository %s into DB.", repository)
-				repoRecord := models.RepoRecord{Name: repository, OwnerName: user, ProjectName: project}
-				if err := dao.AddRepository(repoRecord); err != nil {
-					log.Errorf("Error happens when adding repository: %v", err)
+				if !dao.RepositoryExists(repository) {
+					log.Debugf("Add repository %s into DB.", repository)
+					repoRecord := models.RepoRecord{Name: repository, OwnerName: user, ProjectName: project}
+					if err := dao.AddRepository(repoRecord); err != nil {
+						log.Errorf("Error happens when adding repository: %v", err)
+					}
+
+					if err := cache.RefreshCatalogCache(); err != nil {
+						log.Errorf("failed to refresh cache: %v", err)
+					}
 				}
 
-				if err := cache.RefreshCatalogCache(); err != nil {
-					log.Errorf("failed to refresh cache: %v", err)
+				if len(tag) == 0 {
+					return
+				}
+				if err := dao.AddOrUpdateRepoTag(repository, tag, digest); err != nil {
+					log.Errorf("failed to record tag %s:%s: %v", repository, tag, err)
 				}
 			}()
 
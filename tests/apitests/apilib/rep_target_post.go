@@ -35,4 +35,7 @@ type RepTargetPost struct {
 
 	// The target server password.
 	Password string `json:"password,omitempty"`
+
+	// The target type, 0 means Harbor and 1 means docker registry.
+	Type int32 `json:"type,omitempty"`
 }
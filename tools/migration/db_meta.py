@@ -140,3 +140,63 @@ class Repository(Base):
     update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
 
 
+
+class RepositoryTag(Base):
+    __tablename__ = "repository_tag"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    repo_name = sa.Column(sa.String(255), sa.ForeignKey('repository.name', ondelete='CASCADE'), nullable=False)
+    tag = sa.Column(sa.String(128), nullable=False)
+    digest = sa.Column(sa.String(128), nullable=False)
+    creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+    update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
+
+    __table_args__ = (sa.Index('digest', "digest"), sa.UniqueConstraint('repo_name', 'tag'))
+
+class RepositoryDailyStat(Base):
+    __tablename__ = "repository_daily_stat"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    project_id = sa.Column(sa.Integer, sa.ForeignKey('project.project_id', ondelete='CASCADE'), nullable=False)
+    repo_name = sa.Column(sa.String(255), nullable=False)
+    tag = sa.Column(sa.String(128), nullable=False)
+    day = sa.Column(sa.Date, nullable=False)
+    pull_count = sa.Column(sa.Integer, server_default=sa.text("'0'"), nullable=False)
+    push_count = sa.Column(sa.Integer, server_default=sa.text("'0'"), nullable=False)
+
+    __table_args__ = (sa.Index('day_project', "day", "project_id"), sa.UniqueConstraint('repo_name', 'tag', 'day'))
+
+class UploadSession(Base):
+    __tablename__ = "upload_session"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    uuid = sa.Column(sa.String(64), nullable=False, unique=True)
+    user_id = sa.Column(sa.Integer, sa.ForeignKey('user.user_id'), nullable=False)
+    project_name = sa.Column(sa.String(41), nullable=False)
+    repo = sa.Column(sa.String(256))
+    tag = sa.Column(sa.String(128))
+    size = sa.Column(sa.BigInteger, server_default=sa.text("'0'"), nullable=False)
+    offset = sa.Column(sa.BigInteger, server_default=sa.text("'0'"), nullable=False)
+    status = sa.Column(sa.String(32), nullable=False)
+    job_id = sa.Column(sa.Integer)
+    creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+    update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
+
+class Job(Base):
+    __tablename__ = "job"
+
+    job_id = sa.Column(sa.Integer, primary_key=True)
+    type = sa.Column(sa.String(255), nullable=False)
+    status = sa.Column(sa.String(64), nullable=False, server_default=sa.text("'pending'"))
+    progress = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    message = sa.Column(sa.String(1024), nullable=False)
+    user_id = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    project_id = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    result = sa.Column(sa.Text)
+    error_detail = sa.Column(sa.Text)
+    start_time = sa.Column(mysql.TIMESTAMP, nullable=True)
+    end_time = sa.Column(mysql.TIMESTAMP, nullable=True)
+    creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+    update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
+
+    __table_args__ = (sa.Index('status_end_time', "status", "end_time"), sa.Index('user_type', "user_id", "type"))
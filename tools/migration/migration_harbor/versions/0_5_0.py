@@ -0,0 +1,100 @@
+# Copyright (c) 2008-2016 VMware, Inc. All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""0.4.0 to 0.5.0
+
+Revision ID: 0.4.0
+Revises: 
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '0.5.0'
+down_revision = '0.4.0'
+branch_labels = None
+depends_on = None
+
+from alembic import op
+from db_meta import *
+
+from sqlalchemy.dialects import mysql
+
+def upgrade():
+    """
+    update schema&data
+    """
+    bind = op.get_bind()
+    #create tables: repository_tag, repository_daily_stat, upload_session
+    RepositoryTag.__table__.create(bind)
+    RepositoryDailyStat.__table__.create(bind)
+    UploadSession.__table__.create(bind)
+
+    #add the status, progress, owner and result of the jobs to table job, it is created if missing
+    if 'job' not in sa.inspect(bind).get_table_names():
+        Job.__table__.create(bind)
+    else:
+        op.alter_column('job', 'message', type_=sa.String(1024), existing_type=sa.String(255), existing_nullable=False)
+        op.add_column('job', sa.Column('status', sa.String(64), nullable=False, server_default=sa.text("'pending'")))
+        op.add_column('job', sa.Column('progress', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+        op.add_column('job', sa.Column('user_id', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+        op.add_column('job', sa.Column('project_id', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+        op.add_column('job', sa.Column('result', sa.Text))
+        op.add_column('job', sa.Column('error_detail', sa.Text))
+        op.add_column('job', sa.Column('start_time', mysql.TIMESTAMP, nullable=True))
+        op.add_column('job', sa.Column('end_time', mysql.TIMESTAMP, nullable=True))
+        op.add_column('job', sa.Column('update_time', mysql.TIMESTAMP, server_default=sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP")))
+        op.create_index('status_end_time', 'job', ['status', 'end_time'])
+        op.create_index('user_type', 'job', ['user_id', 'type'])
+
+    #add the mode, filters, schedule and verification result to table replication_policy
+    op.add_column('replication_policy', sa.Column('mode', sa.String(16), nullable=False, server_default=sa.text("'push'")))
+    op.add_column('replication_policy', sa.Column('repo_filter', sa.String(256)))
+    op.add_column('replication_policy', sa.Column('tag_filter', sa.String(256)))
+    op.add_column('replication_policy', sa.Column('verification', sa.Text))
+    op.add_column('replication_policy', sa.Column('last_run_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_policy', sa.Column('next_run_time', mysql.TIMESTAMP, nullable=True))
+
+    #add the credential, TLS and transfer settings to table replication_target
+    op.add_column('replication_target', sa.Column('credential_type', sa.String(16), nullable=False, server_default=sa.text("'basic'")))
+    op.add_column('replication_target', sa.Column('token', sa.Text))
+    op.add_column('replication_target', sa.Column('insecure', mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_target', sa.Column('ca_cert', sa.Text))
+    op.add_column('replication_target', sa.Column('client_cert', sa.Text))
+    op.add_column('replication_target', sa.Column('client_key', sa.Text))
+    op.add_column('replication_target', sa.Column('bandwidth_limit', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_target', sa.Column('transfer_windows', sa.String(256)))
+
+    #add the type, retry, lease and statistics of the jobs to table replication_job
+    op.add_column('replication_job', sa.Column('job_type', sa.String(64), nullable=False, server_default=sa.text("'replication'")))
+    op.add_column('replication_job', sa.Column('parameters', sa.Text))
+    op.add_column('replication_job', sa.Column('attempts', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('next_run_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_job', sa.Column('worker', sa.String(128)))
+    op.add_column('replication_job', sa.Column('heartbeat_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_job', sa.Column('start_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_job', sa.Column('end_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_job', sa.Column('blobs_transferred', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('blobs_skipped', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('bytes_transferred', sa.BigInteger, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('manifests', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('tag_results', sa.Text))
+    op.add_column('replication_job', sa.Column('blobs', mysql.MEDIUMTEXT))
+    op.add_column('replication_job', sa.Column('uploads', sa.Text))
+    op.create_index('status_next_run', 'replication_job', ['status', 'next_run_time'])
+
+def downgrade():
+    """
+    Downgrade has been disabled.
+    """
+    pass